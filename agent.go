@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Outcomes of --add-to-agent
+const (
+	agentAdded      = "added"       // ssh-add loaded the key
+	agentNotRunning = "not-running" // No agent to talk to
+	agentNoSSHAdd   = "no-ssh-add"  // ssh-add is not installed
+	agentFailed     = "failed"      // Anything else, e.g. a wrong passphrase
+)
+
+// agentStartHint tells users without an agent how to start one
+const agentStartHint = `start one with eval "$(ssh-agent -s)" and run ssh-add again`
+
+// sshAddArgs returns the ssh-add arguments that load privateKeyPath. On macOS
+// the passphrase is also stored in the keychain so the key survives a reboot.
+func sshAddArgs(privateKeyPath string) []string {
+	if runtime.GOOS == "darwin" {
+		return []string{"--apple-use-keychain", privateKeyPath}
+	}
+	return []string{privateKeyPath}
+}
+
+// agentRunning reports whether an ssh-agent can be reached. Windows' OpenSSH
+// agent is a service on a named pipe and needs no SSH_AUTH_SOCK.
+func agentRunning() bool {
+	return os.Getenv("SSH_AUTH_SOCK") != "" || runtime.GOOS == "windows"
+}
+
+// addToAgent loads privateKeyPath into the running ssh-agent. A passphrase is
+// asked for by ssh-add itself, which needs a terminal. It returns one of the
+// agent* outcomes and, unless the key was added, what went wrong.
+func addToAgent(privateKeyPath string, hasPassphrase bool) (string, string) {
+	if _, err := exec.LookPath("ssh-add"); err != nil {
+		return agentNoSSHAdd, "ssh-add was not found on your PATH"
+	}
+	if !agentRunning() {
+		return agentNotRunning, "no ssh-agent is running (SSH_AUTH_SOCK is not set); " + agentStartHint
+	}
+
+	args := sshAddArgs(privateKeyPath)
+	logDetail("%s", formatCommand("ssh-add", args))
+	cmd := execCommand("ssh-add", args...)
+	if hasPassphrase {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return agentFailed, "the key has a passphrase and there is no terminal to ask for it; run " + formatCommand("ssh-add", args)
+		}
+		cmd.Stdin = os.Stdin // ssh-add prompts on the terminal itself
+	}
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return agentAdded, ""
+	}
+
+	message := strings.TrimSpace(string(output))
+	// ssh-add exits with 2 when it cannot connect to the agent
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		return agentNotRunning, fmt.Sprintf("could not connect to ssh-agent (%s); %s", message, agentStartHint)
+	}
+	if message == "" {
+		message = err.Error()
+	}
+	return agentFailed, message
+}
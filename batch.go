@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/x/ansi"
+	"gopkg.in/yaml.v3"
+)
+
+// loadBatchFile reads a list of contexts from a YAML or JSON file (JSON is valid YAML)
+func loadBatchFile(path string) ([]FormData, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", stylePath.Render(path), err)
+	}
+
+	// Entries written by export carry an exported block, which is skipped
+	var exported []exportedContext
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true) // Catch typos in field names instead of silently ignoring them
+	if err := decoder.Decode(&exported); err != nil {
+		return nil, usageError(fmt.Errorf("failed to parse '%s' (expected a list of contexts): %w", stylePath.Render(path), err))
+	}
+	if len(exported) == 0 {
+		return nil, usageError(fmt.Errorf("no contexts found in '%s'", stylePath.Render(path)))
+	}
+	entries := make([]FormData, len(exported))
+	for i, entry := range exported {
+		entries[i] = entry.FormData
+	}
+	return entries, nil
+}
+
+// batchReport is the --output json form of a batch run
+type batchReport struct {
+	Results  []any          `json:"results"`
+	Failures []batchFailure `json:"failures"`
+}
+
+// batchFailure records a context that could not be set up
+type batchFailure struct {
+	Directory string `json:"directory"`
+	Error     string `json:"error"`
+}
+
+// checkKeySizeFields rejects a batch entry choosing a size its key type does
+// not take, e.g. rsa_bits for an ed25519 key. It runs before
+// applyFormDefaults, which fills in every size.
+func checkKeySizeFields(data FormData) error {
+	keyType := data.KeyType
+	if keyType == "" {
+		keyType = keyTypes[0]
+	}
+	for name, size := range keySizes {
+		if *size.size(&data) != 0 && keyType != name {
+			return usageError(fmt.Errorf("%s only applies to key_type %s, not %s", size.field, name, keyType))
+		}
+	}
+	return nil
+}
+
+// applyFormDefaults fills in the values the flags and form would otherwise default
+func applyFormDefaults(data *FormData) {
+	if data.Provider == "" {
+		data.Provider = providerGitHub
+		if data.ProviderHost != "" {
+			data.Provider = providerCustom
+		}
+	}
+	if data.KeyType == "" {
+		data.KeyType = recommendedKeyType(data.Provider)
+	}
+	for _, size := range keySizes {
+		if *size.size(data) == 0 {
+			*size.size(data) = size.defaultSize
+		}
+	}
+	if data.SignMethod == "" {
+		data.SignMethod = signMethodSSH
+		if data.GPGKey != "" || data.GPGProgram != "" {
+			data.SignMethod = signMethodGPG
+		}
+	}
+	if data.SignMethod == signMethodGPG {
+		data.SignCommits = true
+	}
+	if data.InitialBranch != "" || data.Remote != "" {
+		data.GitInit = true
+	}
+}
+
+// runBatch sets up every context listed in path, continuing past failures and
+// reporting all of them at the end
+func runBatch(path string, opts cliOptions) error {
+	entries, err := loadBatchFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Each key would overwrite the previous one on the clipboard
+	opts.NoClipboard = true
+	// Batch mode never prompts, so failed contexts are rolled back automatically
+	opts.NonInteractive = true
+
+	failures := []string{}
+	report := batchReport{Results: []any{}, Failures: []batchFailure{}}
+	for i, data := range entries {
+		sizeErr := checkKeySizeFields(data)
+		applyFormDefaults(&data)
+		label := fmt.Sprintf("[%d/%d] %s", i+1, len(entries), data.DirectoryName)
+
+		err := sizeErr
+		if err == nil {
+			err = resolveFormPaths(&data)
+		}
+		if err == nil {
+			err = validateFormData(data)
+		}
+		if err == nil {
+			err = checkDependencies(data, true, true)
+		}
+		var result *setupResult
+		if err == nil {
+			result, err = processFormData(data, opts)
+		}
+		if err == nil && opts.GitHubUpload && !opts.DryRun && githubUploadApplies(data) {
+			err = uploadToGitHub(result, githubToken(opts))
+		}
+		if err == nil && data.TestConnection && !opts.DryRun {
+			err = runConnectionTest(result, false)
+		}
+		if err != nil {
+			if verbosity == levelQuiet {
+				logError("%s %v", label+":", err)
+			}
+			failures = append(failures, styleError.Render(label+":")+" "+err.Error())
+			report.Failures = append(report.Failures, batchFailure{Directory: data.DirectoryName, Error: ansi.Strip(err.Error())})
+			continue
+		}
+		if opts.Output == outputJSON {
+			report.Results = append(report.Results, result.jsonValue())
+			continue
+		}
+		if verbosity == levelQuiet && !result.DryRun {
+			printPublicKeys(result)
+			continue
+		}
+		printBorderedMessages(append([]string{styleInfo.Render(label), ""}, renderSetupResult(result)...))
+	}
+
+	if opts.Output == outputJSON {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else if verbosity > levelQuiet {
+		summary := []string{fmt.Sprintf("Processed %d contexts: %d succeeded, %d failed", len(entries), len(entries)-len(failures), len(failures))}
+		if len(failures) > 0 {
+			summary = append(summary, "")
+			summary = append(summary, failures...)
+		} else {
+			summary[0] = styleGood.Render(summary[0])
+		}
+		printBorderedMessages(summary)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d contexts failed", len(failures), len(entries))
+	}
+	return nil
+}
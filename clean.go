@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ini/ini"
+)
+
+// cleanOptions holds the flags of the clean subcommand
+type cleanOptions struct {
+	AssumeYes bool
+	DryRun    bool
+}
+
+// includeCleanup is what clean does about the includeIf sections of one
+// normalized condition
+type includeCleanup struct {
+	Keep        string   // Section kept, empty when every section is removed
+	Remove      []string // Redundant or malformed sections to delete
+	Conflicting []string // Sections that include different files, left alone
+}
+
+// newCleanFlagSet defines the flags of the clean subcommand, storing their values in opts
+func newCleanFlagSet(opts *cleanOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" clean", flag.ContinueOnError)
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	addNoBorderFlag(fs)
+	addHomeFlag(fs)
+	fs.BoolVar(&opts.AssumeYes, "yes", false, "do not ask for confirmation before changing the global config")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "only report what would be removed")
+	return fs
+}
+
+// planIncludeCleanup groups the includeIf sections of cfg by their normalized
+// condition (see normalizeIncludeCondition) and decides, for every group with
+// more than one section, which one to keep. Sections that include the same
+// file are redundant; the one this tool would write now is kept, else the
+// first. Sections without a path are malformed and always removed.
+func planIncludeCleanup(cfg *ini.File, globalGitConfigPath string) []includeCleanup {
+	groups := map[string][]*ini.Section{}
+	order := []string{}
+	malformed := []string{}
+	for _, section := range cfg.Sections() {
+		match := includeIfPattern.FindStringSubmatch(section.Name())
+		if match == nil {
+			continue
+		}
+		if strings.TrimSpace(section.Key("path").String()) == "" {
+			malformed = append(malformed, section.Name())
+			continue
+		}
+		condition := normalizeIncludeCondition(match[1])
+		if _, ok := groups[condition]; !ok {
+			order = append(order, condition)
+		}
+		groups[condition] = append(groups[condition], section)
+	}
+
+	cleanups := []includeCleanup{}
+	if len(malformed) > 0 {
+		cleanups = append(cleanups, includeCleanup{Remove: malformed})
+	}
+	for _, condition := range order {
+		sections := groups[condition]
+		if len(sections) < 2 {
+			continue
+		}
+		names := []string{}
+		conflict := false
+		target := resolveIncludePath(globalGitConfigPath, sections[0].Key("path").String())
+		for _, section := range sections {
+			names = append(names, section.Name())
+			if !samePath(resolveIncludePath(globalGitConfigPath, section.Key("path").String()), target) {
+				conflict = true
+			}
+		}
+		if conflict {
+			cleanups = append(cleanups, includeCleanup{Conflicting: names})
+			continue
+		}
+
+		// Prefer the spelling setup writes today: forward slashes and a trailing slash
+		cleanup := includeCleanup{Keep: names[0]}
+		if canonical := `includeIf "` + condition + `"`; slices.Contains(names, canonical) {
+			cleanup.Keep = canonical
+		}
+		for _, name := range names {
+			if name != cleanup.Keep {
+				cleanup.Remove = append(cleanup.Remove, name)
+			}
+		}
+		cleanups = append(cleanups, cleanup)
+	}
+	return cleanups
+}
+
+// writeBackupCopy copies path to a timestamped file next to it and returns its name
+func writeBackupCopy(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to back up '%s': %w", stylePath.Render(path), err)
+	}
+	backupPath := path + ".bak-" + time.Now().Format("20060102-150405")
+	if err := os.WriteFile(backupPath, content, configFileMode); err != nil {
+		return "", fmt.Errorf("failed to write backup '%s': %w", stylePath.Render(backupPath), err)
+	}
+	return backupPath, nil
+}
+
+// runClean implements the clean subcommand, removing duplicate and malformed
+// includeIf sections that older runs left in the global config
+func runClean(args []string) error {
+	var opts cleanOptions
+	fs := newCleanFlagSet(&opts)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+	if fs.NArg() > 0 {
+		return usageError(fmt.Errorf("usage: %s clean [--dry-run] [--yes]", appName))
+	}
+
+	globalGitConfigPath, err := resolveGlobalGitConfigPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadGitConfig(globalGitConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+	}
+
+	cleanups := planIncludeCleanup(cfg, globalGitConfigPath)
+	messages := []string{styleInfo.Render("Contexts in") + " " + stylePath.Render(globalGitConfigPath), ""}
+	toRemove := []string{}
+	conflicts := 0
+	for _, cleanup := range cleanups {
+		switch {
+		case len(cleanup.Conflicting) > 0:
+			conflicts++
+			messages = append(messages, styleError.Render("conflict")+" these include different files for the same directory; remove the wrong one by hand:")
+			for _, sectionName := range cleanup.Conflicting {
+				path := resolveIncludePath(globalGitConfigPath, cfg.Section(sectionName).Key("path").String())
+				messages = append(messages, "     ["+sectionName+"] -> "+stylePath.Render(path))
+			}
+		case cleanup.Keep == "":
+			for _, sectionName := range cleanup.Remove {
+				messages = append(messages, styleWarn.Render("remove")+"   ["+sectionName+"] (no path)")
+			}
+			toRemove = append(toRemove, cleanup.Remove...)
+		default:
+			messages = append(messages, styleGood.Render("keep")+"     ["+cleanup.Keep+"]")
+			for _, sectionName := range cleanup.Remove {
+				messages = append(messages, styleWarn.Render("remove")+"   ["+sectionName+"] (duplicate)")
+			}
+			toRemove = append(toRemove, cleanup.Remove...)
+		}
+	}
+
+	if len(toRemove) == 0 {
+		if conflicts == 0 {
+			messages = append(messages, styleGood.Render("No duplicate or malformed includeIf sections found."))
+		}
+		printBorderedMessages(messages)
+		return conflictsError(conflicts)
+	}
+
+	if opts.DryRun {
+		messages = append(messages, "", styleInfo.Render(fmt.Sprintf("Would remove %d includeIf sections", len(toRemove))))
+		printBorderedMessages(messages)
+		return conflictsError(conflicts)
+	}
+	printBorderedMessages(messages)
+
+	ok, err := confirm(fmt.Sprintf("Remove %d includeIf sections from %s?", len(toRemove), globalGitConfigPath), opts.AssumeYes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return abortError("aborted, the global config was not changed")
+	}
+
+	backupPath, err := writeBackupCopy(globalGitConfigPath)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockConfigFile(globalGitConfigPath)
+	if err != nil {
+		return err
+	}
+	err = editGitConfigFile(globalGitConfigPath, toRemove, nil)
+	unlock()
+	if err != nil {
+		return fmt.Errorf("failed to save updated global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+	}
+	printBorderedMessages([]string{
+		styleWarn.Render(fmt.Sprintf("Removed %d includeIf sections from:", len(toRemove))) + " " + stylePath.Render(globalGitConfigPath),
+		styleInfo.Render("Backup of the previous version:") + " " + stylePath.Render(backupPath),
+	})
+	return conflictsError(conflicts)
+}
+
+// conflictsError reports the conflicting groups clean could not resolve, if any
+func conflictsError(conflicts int) error {
+	if conflicts == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d directories are included from more than one file", conflicts)
+}
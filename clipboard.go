@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/aymanbagabas/go-osc52/v2"
+	"github.com/charmbracelet/huh"
+	"golang.org/x/term"
+)
+
+// Clipboard methods reported by copyToClipboard and copyWithFallbacks
+const (
+	clipboardSystem = "system"
+	clipboardOSC52  = "osc52"
+	clipboardFile   = "file" // The key was saved to a file instead
+)
+
+// Choices offered when the system clipboard fails, besides the methods above
+const (
+	clipboardRetry = "retry"
+	clipboardSkip  = "skip"
+)
+
+// writeClipboard puts text on the system clipboard; tests replace it
+var writeClipboard = clipboard.WriteAll
+
+// copyToClipboard copies text to the system clipboard. When that fails (e.g.
+// over SSH or without clipboard utilities) and a terminal is attached, it falls
+// back to an OSC52 escape sequence that asks the terminal emulator to set its
+// clipboard. It returns the method that was used.
+func copyToClipboard(text string) (string, error) {
+	err := writeClipboard(text)
+	if err == nil {
+		return clipboardSystem, nil
+	}
+
+	out := os.Stderr
+	if !term.IsTerminal(int(out.Fd())) {
+		out = os.Stdout
+		if !term.IsTerminal(int(out.Fd())) {
+			return "", err
+		}
+	}
+	if oscErr := sendOSC52(text, out); oscErr != nil {
+		return "", fmt.Errorf("%v; OSC52 fallback failed: %w", err, oscErr)
+	}
+	return clipboardOSC52, nil
+}
+
+// sendOSC52 writes the OSC52 sequence setting the clipboard to text to out,
+// wrapped for tmux or screen when running inside one
+func sendOSC52(text string, out *os.File) error {
+	seq := osc52.New(text)
+	if os.Getenv("TMUX") != "" {
+		seq = seq.Tmux()
+	} else if os.Getenv("STY") != "" {
+		seq = seq.Screen()
+	}
+	_, err := seq.WriteTo(out)
+	return err
+}
+
+// copyWithFallbacks copies text to the system clipboard and, when that fails,
+// asks the user what to do instead: send it through the terminal (OSC52), try
+// again, save it to a file or skip. OSC52 is not the silent fallback here as
+// there is no telling whether the terminal honored it. It returns the method
+// used and, for clipboardFile, the file.
+func copyWithFallbacks(text string) (string, string, error) {
+	err := writeClipboard(text)
+	for err != nil {
+		choice := clipboardOSC52
+		askErr := runField(huh.NewSelect[string]().
+			Title("Could not copy the public key: "+err.Error()).
+			Options(
+				huh.NewOption("Send it to the terminal's clipboard (OSC52, works over SSH in most terminals)", clipboardOSC52),
+				huh.NewOption("Try the system clipboard again", clipboardRetry),
+				huh.NewOption("Save it to a file", clipboardFile),
+				huh.NewOption("Skip, I will copy it from the output", clipboardSkip),
+			).
+			Value(&choice),
+		)
+		if askErr != nil {
+			return "", "", err // Report the clipboard error, not the cancelled prompt
+		}
+
+		switch choice {
+		case clipboardOSC52:
+			if err := sendOSC52(text, os.Stdout); err != nil {
+				return "", "", fmt.Errorf("OSC52 failed: %w", err)
+			}
+			return clipboardOSC52, "", nil
+		case clipboardFile:
+			path, err := writeKeyFile(text)
+			if err != nil {
+				return "", "", err
+			}
+			return clipboardFile, path, nil
+		case clipboardSkip:
+			return "", "", nil
+		}
+		err = writeClipboard(text)
+	}
+	return clipboardSystem, "", nil
+}
+
+// writeKeyFile saves a public key to a new file in the temporary directory
+// and returns its path
+func writeKeyFile(text string) (string, error) {
+	file, err := os.CreateTemp("", appName+"-*.pub")
+	if err != nil {
+		return "", fmt.Errorf("failed to create a file for the public key: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(strings.TrimSpace(text) + "\n"); err != nil {
+		return "", fmt.Errorf("failed to write public key to '%s': %w", stylePath.Render(file.Name()), err)
+	}
+	return file.Name(), nil
+}
+
+// writePubkeyOut writes key to path for --pubkey-out, creating the
+// directories above it, and records the path in result
+func writePubkeyOut(result *setupResult, key, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return fmt.Errorf("failed to create directory for '%s': %w", stylePath.Render(path), err)
+	}
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(key)+"\n"), configFileMode); err != nil {
+		return fmt.Errorf("failed to write public key to '%s': %w", stylePath.Render(path), err)
+	}
+	result.PubkeyOutPath = path
+	return nil
+}
+
+// copyPublicKey copies key for the user and records how in result. Runs that
+// may prompt get the interactive fallbacks of copyWithFallbacks, all others
+// the automatic OSC52 fallback of copyToClipboard.
+func copyPublicKey(result *setupResult, key string, opts cliOptions) {
+	interactive := !opts.AssumeYes && !opts.NonInteractive && opts.Output == outputText &&
+		term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+	var err error
+	if interactive {
+		result.ClipboardMethod, result.KeyFile, err = copyWithFallbacks(key)
+	} else {
+		result.ClipboardMethod, err = copyToClipboard(key)
+	}
+	switch {
+	case err != nil:
+		result.ClipboardError = err.Error()
+	case result.ClipboardMethod == clipboardSystem || result.ClipboardMethod == clipboardOSC52:
+		result.ClipboardCopied = true
+	}
+}
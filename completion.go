@@ -0,0 +1,346 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// completionShells are the shells the completion subcommand writes scripts for
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// subcommand describes a subcommand for the completion scripts
+type subcommand struct {
+	name        string
+	description string
+	flags       func() *flag.FlagSet // nil when the subcommand takes no flags
+	dirArg      bool                 // The positional argument is a directory
+	words       []string             // Fixed values for the positional argument
+}
+
+// subcommands lists every subcommand in the order they are offered
+func subcommands() []subcommand {
+	return []subcommand{
+		{name: "list", description: "list the configured contexts", flags: newListFlagSet},
+		{name: "remove", description: "remove the context of a directory", flags: func() *flag.FlagSet { return newRemoveFlagSet(&removeOptions{}) }, dirArg: true},
+		{name: "edit", description: "change the identity or signing of a context", flags: func() *flag.FlagSet { return newEditFlagSet(&editOptions{}) }, dirArg: true},
+		{name: "export", description: "print a directory's context as a --from-file entry", flags: func() *flag.FlagSet { return newExportFlagSet(&exportOptions{}) }, dirArg: true},
+		{name: "rotate", description: "replace the SSH key of a directory's context", flags: func() *flag.FlagSet { return newRotateFlagSet(&rotateOptions{}) }, dirArg: true},
+		{name: "show", description: "print the public key of a directory's context again", flags: func() *flag.FlagSet { return newShowFlagSet(&showOptions{}) }, dirArg: true},
+		{name: "status", description: "show which context applies here", flags: newStatusFlagSet},
+		{name: "doctor", description: "check that every context still works", flags: newDoctorFlagSet},
+		{name: "clean", description: "remove duplicate includeIf sections from the global config", flags: func() *flag.FlagSet { return newCleanFlagSet(&cleanOptions{}) }},
+		{name: "version", description: "print the version and those of git and ssh", flags: func() *flag.FlagSet { return newVersionFlagSet(&versionOptions{}) }},
+		{name: "completion", description: "print a shell completion script", words: completionShells},
+	}
+}
+
+// completionFlag is a flag as the completion scripts see it
+type completionFlag struct {
+	name   string
+	usage  string
+	isBool bool
+	values []string // Fixed values to offer, if any
+	path   string   // "file" or "dir" when the value is a path
+}
+
+// completionFlags lists the flags of fs with what their values complete to
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	curves := []string{}
+	for _, bits := range ecdsaCurves {
+		curves = append(curves, strconv.Itoa(bits))
+	}
+	sizes := []string{}
+	for _, bits := range rsaKeySizes {
+		sizes = append(sizes, strconv.Itoa(bits))
+	}
+	values := map[string][]string{
+		flagRSABits:      sizes,
+		flagSignMethod:   signMethods,
+		flagOnConflict:   conflictActions,
+		flagOnInclude:    includeConflictActions,
+		flagKeyType:      keyTypes,
+		flagCurve:        curves,
+		flagMatch:        includeMatches,
+		flagProvider:     providers,
+		flagHostKeyCheck: hostKeyCheckModes,
+		flagAutoCRLF:     autoCRLFValues,
+		flagAuth:         authMethods,
+		flagFileMode:     fileModeValues,
+		flagPullRebase:   append([]string{"true", "false"}, pullRebaseModes...),
+		flagFetchPrune:   {"true", "false"},
+		flagFormat:       exportFormats,
+		flagOutput:       outputFormats,
+		flagPathStyle:    pathStyles,
+		flagIncludeStyle: includePathStyles,
+		flagTheme:        themeNames,
+		flagScope:        scopes,
+	}
+	paths := map[string]string{
+		flagDir:          "dir",
+		flagSSHDir:       "dir",
+		flagExisting:     "file",
+		flagSigningKey:   "file",
+		flagKnownHosts:   "file",
+		flagLocalConfig:  "file",
+		flagTemplateCfg:  "file",
+		"from-file":      "file",
+		"home":           "dir",
+		flagImportPubkey: "file",
+	}
+
+	flags := []completionFlag{}
+	fs.VisitAll(func(f *flag.Flag) {
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			name:   f.Name,
+			usage:  f.Usage,
+			isBool: ok && boolFlag.IsBoolFlag(),
+			values: values[f.Name],
+			path:   paths[f.Name],
+		})
+	})
+	return flags
+}
+
+// setupFlagSet returns the flag set of the setup command, for completion
+func setupFlagSet() *flag.FlagSet {
+	fs, _ := newSetupFlagSet(&FormData{}, &cliOptions{})
+	return fs
+}
+
+// runCompletion implements the completion subcommand
+func runCompletion(args []string) error {
+	if len(args) != 1 || !slices.Contains(completionShells, args[0]) {
+		return usageError(fmt.Errorf("usage: %s completion %s", appName, strings.Join(completionShells, "|")))
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	}
+	return nil
+}
+
+// completionFunction is the name of the shell function behind the bash and zsh scripts
+func completionFunction() string {
+	return "_" + strings.ReplaceAll(appName, "-", "_")
+}
+
+// flagNames returns the flags of fs as a space-separated list of --names
+func flagNames(fs *flag.FlagSet) string {
+	names := []string{}
+	for _, f := range completionFlags(fs) {
+		names = append(names, "--"+f.name)
+	}
+	return strings.Join(names, " ")
+}
+
+// bashCompletion returns the bash completion script
+func bashCompletion() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# bash completion for %s\n#\n", appName)
+	fmt.Fprintf(&b, "# Load it in the current shell with:\n#   source <(%s completion bash)\n", appName)
+	fmt.Fprintf(&b, "# or install it for every session:\n#   %s completion bash > ~/.local/share/bash-completion/completions/%s\n\n", appName, appName)
+
+	fmt.Fprintf(&b, "%s() {\n", completionFunction())
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("    COMPREPLY=()\n\n")
+
+	// Flag values, from every command (flags sharing a name take the same values)
+	flagSets := []*flag.FlagSet{setupFlagSet()}
+	for _, sub := range subcommands() {
+		if sub.flags != nil {
+			flagSets = append(flagSets, sub.flags())
+		}
+	}
+	seen := map[string]bool{}
+	b.WriteString("    case \"$prev\" in\n")
+	for _, fs := range flagSets {
+		for _, f := range completionFlags(fs) {
+			if f.isBool || seen[f.name] {
+				continue
+			}
+			seen[f.name] = true
+			fmt.Fprintf(&b, "        --%s|-%s)\n", f.name, f.name)
+			switch {
+			case f.values != nil:
+				fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(f.values, " "))
+			case f.path == "dir":
+				b.WriteString("            compopt -o filenames 2>/dev/null\n")
+				b.WriteString("            COMPREPLY=($(compgen -d -- \"$cur\"))\n")
+			case f.path == "file":
+				b.WriteString("            compopt -o filenames 2>/dev/null\n")
+				b.WriteString("            COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+			}
+			b.WriteString("            return ;;\n")
+		}
+	}
+	b.WriteString("    esac\n\n")
+
+	// Subcommands are only recognized as the first argument
+	names := []string{}
+	for _, sub := range subcommands() {
+		names = append(names, sub.name)
+	}
+	b.WriteString("    if [[ $COMP_CWORD -eq 1 && \"$cur\" != -* ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(names, " "))
+	b.WriteString("        return\n    fi\n\n")
+
+	b.WriteString("    case \"${COMP_WORDS[1]}\" in\n")
+	for _, sub := range subcommands() {
+		fmt.Fprintf(&b, "        %s)\n", sub.name)
+		if sub.flags != nil {
+			fmt.Fprintf(&b, "            if [[ \"$cur\" == -* ]]; then\n                COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n                return\n            fi\n", flagNames(sub.flags()))
+		}
+		switch {
+		case sub.dirArg:
+			b.WriteString("            compopt -o filenames 2>/dev/null\n")
+			b.WriteString("            COMPREPLY=($(compgen -d -- \"$cur\"))\n")
+		case sub.words != nil:
+			b.WriteString("            [[ $COMP_CWORD -eq 2 ]] && ")
+			fmt.Fprintf(&b, "COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(sub.words, " "))
+		}
+		b.WriteString("            ;;\n")
+	}
+	fmt.Fprintf(&b, "        *)\n            COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n            ;;\n", flagNames(setupFlagSet()))
+	b.WriteString("    esac\n}\n\n")
+	fmt.Fprintf(&b, "complete -F %s %s\n", completionFunction(), appName)
+	return b.String()
+}
+
+// zshQuote escapes s for use inside a single-quoted _arguments spec description
+func zshQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+	return strings.ReplaceAll(s, "'", `'\''`)
+}
+
+// zshArguments renders the _arguments specs for the flags of fs
+func zshArguments(fs *flag.FlagSet) []string {
+	specs := []string{}
+	for _, f := range completionFlags(fs) {
+		spec := fmt.Sprintf("'--%s[%s]", f.name, zshQuote(f.usage))
+		switch {
+		case f.isBool:
+		case f.values != nil:
+			spec += fmt.Sprintf(":%s:(%s)", f.name, strings.Join(f.values, " "))
+		case f.path == "dir":
+			spec += fmt.Sprintf(":%s:_files -/", f.name)
+		case f.path == "file":
+			spec += fmt.Sprintf(":%s:_files", f.name)
+		default:
+			spec += fmt.Sprintf(":%s: ", f.name)
+		}
+		specs = append(specs, spec+"'")
+	}
+	return specs
+}
+
+// zshCompletion returns the zsh completion script
+func zshCompletion() string {
+	var b strings.Builder
+	fn := completionFunction()
+	fmt.Fprintf(&b, "#compdef %s\n", appName)
+	fmt.Fprintf(&b, "# zsh completion for %s\n#\n", appName)
+	fmt.Fprintf(&b, "# Load it in the current shell (after compinit) with:\n#   source <(%s completion zsh)\n", appName)
+	fmt.Fprintf(&b, "# or save it as _%s in a directory on your $fpath:\n#   %s completion zsh > \"${fpath[1]}/_%s\"\n\n", appName, appName, appName)
+
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString("    local -a subcommands\n    subcommands=(\n")
+	for _, sub := range subcommands() {
+		fmt.Fprintf(&b, "        '%s:%s'\n", sub.name, zshQuote(sub.description))
+	}
+	b.WriteString("    )\n\n")
+	b.WriteString("    if (( CURRENT == 2 )) && [[ \"$words[2]\" != -* ]]; then\n")
+	b.WriteString("        _describe -t commands command subcommands\n        return\n    fi\n\n")
+
+	b.WriteString("    case \"$words[2]\" in\n")
+	for _, sub := range subcommands() {
+		fmt.Fprintf(&b, "        %s)\n", sub.name)
+		specs := []string{}
+		if sub.flags != nil {
+			specs = zshArguments(sub.flags())
+		}
+		switch {
+		case sub.dirArg:
+			specs = append(specs, "'1:directory:_files -/'")
+		case sub.words != nil:
+			specs = append(specs, fmt.Sprintf("'1:%s:(%s)'", sub.name, strings.Join(sub.words, " ")))
+		}
+		if len(specs) > 0 {
+			b.WriteString("            shift words\n            (( CURRENT-- ))\n")
+			fmt.Fprintf(&b, "            _arguments \\\n                %s\n", strings.Join(specs, " \\\n                "))
+		}
+		b.WriteString("            ;;\n")
+	}
+	fmt.Fprintf(&b, "        *)\n            _arguments \\\n                %s\n            ;;\n", strings.Join(zshArguments(setupFlagSet()), " \\\n                "))
+	b.WriteString("    esac\n}\n\n")
+
+	fmt.Fprintf(&b, "if [ \"$funcstack[1]\" = \"%s\" ]; then\n    %s \"$@\"\nelse\n    compdef %s %s\nfi\n", fn, fn, fn, appName)
+	return b.String()
+}
+
+// fishQuote quotes s as a single-quoted fish string
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// fishFlags renders the complete commands for the flags of fs under condition
+func fishFlags(fs *flag.FlagSet, condition string) []string {
+	lines := []string{}
+	for _, f := range completionFlags(fs) {
+		line := fmt.Sprintf("complete -c %s -n %s -l %s", appName, fishQuote(condition), f.name)
+		switch {
+		case f.isBool:
+		case f.values != nil:
+			line += " -x -a " + fishQuote(strings.Join(f.values, " "))
+		case f.path == "dir":
+			line += " -x -a '(__fish_complete_directories)'"
+		case f.path == "file":
+			line += " -r -F"
+		default:
+			line += " -x"
+		}
+		lines = append(lines, line+" -d "+fishQuote(f.usage))
+	}
+	return lines
+}
+
+// fishCompletion returns the fish completion script
+func fishCompletion() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# fish completion for %s\n#\n", appName)
+	fmt.Fprintf(&b, "# Load it in the current shell with:\n#   %s completion fish | source\n", appName)
+	fmt.Fprintf(&b, "# or install it for every session:\n#   %s completion fish > ~/.config/fish/completions/%s.fish\n\n", appName, appName)
+
+	names := []string{}
+	for _, sub := range subcommands() {
+		names = append(names, sub.name)
+	}
+	noSubcommand := "not __fish_seen_subcommand_from " + strings.Join(names, " ")
+
+	fmt.Fprintf(&b, "complete -c %s -f\n\n", appName)
+	for _, sub := range subcommands() {
+		fmt.Fprintf(&b, "complete -c %s -n '__fish_is_first_arg' -a %s -d %s\n", appName, sub.name, fishQuote(sub.description))
+	}
+	b.WriteString("\n")
+	for _, sub := range subcommands() {
+		condition := "__fish_seen_subcommand_from " + sub.name
+		if sub.flags != nil {
+			b.WriteString(strings.Join(fishFlags(sub.flags(), condition), "\n") + "\n")
+		}
+		switch {
+		case sub.dirArg:
+			fmt.Fprintf(&b, "complete -c %s -n %s -a '(__fish_complete_directories)'\n", appName, fishQuote(condition))
+		case sub.words != nil:
+			fmt.Fprintf(&b, "complete -c %s -n %s -a %s\n", appName, fishQuote(condition), fishQuote(strings.Join(sub.words, " ")))
+		}
+	}
+	b.WriteString("\n" + strings.Join(fishFlags(setupFlagSet(), noSubcommand), "\n") + "\n")
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// sectionHeaderPattern matches a section header line of a git config file,
+// capturing the name between the brackets
+var sectionHeaderPattern = regexp.MustCompile(`^\s*\[([^\]]*)\]`)
+
+// includeEntry is an include section to append and the path it loads
+type includeEntry struct {
+	Section string // Full section name, e.g. includeIf "gitdir:/home/me/work/"
+	Path    string
+}
+
+// editGitConfigFile removes the sections named in remove from the config at
+// path and appends the includes in add. Every other line is left exactly as
+// it was, so comments, blank lines and indentation survive, unlike a round
+// trip through go-ini.
+func editGitConfigFile(path string, remove []string, add []includeEntry) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	text := removeConfigSections(string(content), remove)
+	for _, entry := range add {
+		text = appendConfigSection(text, entry.Section, "path", entry.Path)
+	}
+	return writeFileAtomic(path, []byte(text))
+}
+
+// removeConfigSections returns content without the sections named in names,
+// each from its header up to the next header. Comments and blank lines right
+// before the next header are kept, as they usually describe that section.
+// Several headers with the same name are all removed, as git merges them.
+func removeConfigSections(content string, names []string) string {
+	if len(names) == 0 {
+		return content
+	}
+	lines := strings.SplitAfter(content, "\n")
+	kept := make([]string, 0, len(lines))
+	skipping := false
+	pending := []string{} // Comments and blank lines seen since the last key of a removed section
+	for _, line := range lines {
+		if match := sectionHeaderPattern.FindStringSubmatch(line); match != nil {
+			if skipping {
+				kept = append(kept, pending...)
+				pending = pending[:0]
+			}
+			skipping = slices.Contains(names, strings.TrimSpace(match[1]))
+			if skipping {
+				continue
+			}
+		}
+		if !skipping {
+			kept = append(kept, line)
+			continue
+		}
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			pending = append(pending, line)
+		} else {
+			pending = pending[:0]
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// configSectionsText returns the sections of content named in names, each
+// from its header up to the next header, without the comments and blank lines
+// that end it
+func configSectionsText(content string, names []string) string {
+	kept := []string{}
+	pending := []string{} // Comments and blank lines seen since the last key of a kept section
+	keeping := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if match := sectionHeaderPattern.FindStringSubmatch(line); match != nil {
+			keeping = slices.Contains(names, strings.TrimSpace(match[1]))
+			pending = pending[:0]
+		}
+		if !keeping {
+			continue
+		}
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			pending = append(pending, line)
+			continue
+		}
+		kept = append(kept, pending...)
+		pending = pending[:0]
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "")
+}
+
+// appendConfigSection returns content with a section holding key = value
+// added at the end, in the layout git config itself writes, and with the
+// file's line endings
+func appendConfigSection(content, name, key, value string) string {
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += newline
+	}
+	return content + fmt.Sprintf("[%s]%s\t%s = %s%s", name, newline, key, quoteConfigValue(value), newline)
+}
+
+// quoteConfigValue quotes value for a git config file if git would otherwise
+// cut it at a comment character or drop surrounding spaces
+func quoteConfigValue(value string) string {
+	if !strings.ContainsAny(value, "#;\"\\") && strings.TrimSpace(value) == value {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/go-ini/ini"
+	"golang.org/x/term"
+)
+
+// What to do with a local config that already exists, accepted by --on-conflict
+const (
+	conflictOverwrite = "overwrite" // Replace the file, the default without a terminal
+	conflictMerge     = "merge"     // Keep its other settings and only set the keys this tool writes
+	conflictAbort     = "abort"     // Stop before anything is changed
+)
+
+// conflictActions lists the values accepted by --on-conflict
+var conflictActions = []string{conflictOverwrite, conflictMerge, conflictAbort}
+
+// How the local config was written, reported in the output
+const (
+	localConfigCreated     = "created"
+	localConfigOverwritten = "overwritten"
+	localConfigMerged      = "merged"
+)
+
+// validateOnConflict checks the value of --on-conflict
+func validateOnConflict(s string) error {
+	if !slices.Contains(conflictActions, s) {
+		return fmt.Errorf("unsupported action '%s' (supported: %s)", s, strings.Join(conflictActions, ", "))
+	}
+	return nil
+}
+
+// resolveLocalConfigConflict decides what happens to the local config at path
+// if it already exists: --on-conflict if given, else the user's choice, else
+// overwrite. It returns "" when there is no file, and an error for abort.
+func resolveLocalConfigConflict(path string, data FormData, opts cliOptions) (string, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to check local config '%s': %w", stylePath.Render(path), err)
+	}
+
+	action := data.OnConflict
+	if action == "" {
+		action = conflictOverwrite
+		if !opts.NonInteractive && !opts.AssumeYes && term.IsTerminal(int(os.Stdin.Fd())) {
+			var err error
+			if action, err = selectConflictAction(path); err != nil {
+				return "", err
+			}
+		}
+	}
+	if action == conflictAbort {
+		return "", abortError("local config '%s' already exists; aborted without changes", stylePath.Render(path))
+	}
+	return action, nil
+}
+
+// selectConflictAction asks what to do with the existing local config at
+// path, with merge preselected so its other settings survive
+func selectConflictAction(path string) (string, error) {
+	action := conflictMerge
+	err := runField(huh.NewSelect[string]().
+		Title(path+" already exists").
+		Description("Merge keeps its other settings and only sets the keys written by "+appName).
+		Options(
+			huh.NewOption("Merge", conflictMerge),
+			huh.NewOption("Overwrite", conflictOverwrite),
+			huh.NewOption("Abort", conflictAbort),
+		).
+		Value(&action),
+	)
+	return action, err
+}
+
+// mergeGitConfig sets every key of cfg in base, leaving base's other sections
+// and keys alone
+func mergeGitConfig(base, cfg *ini.File) {
+	for _, section := range cfg.Sections() {
+		if section.Name() == ini.DefaultSection && len(section.Keys()) == 0 {
+			continue
+		}
+		target := base.Section(section.Name())
+		for _, key := range section.Keys() {
+			target.Key(key.Name()).SetValue(key.Value())
+		}
+	}
+}
+
+// What to do with an includeIf for the same directory or remote that loads a
+// different file, accepted by --on-include-conflict
+const (
+	includeReplace = "replace" // Point it at the new local config, the default with --yes
+	includeKeep    = "keep"    // Leave it alone, so the new local config is not applied
+	includeAbort   = "abort"   // Stop and undo the changes made so far
+)
+
+// includeConflictActions lists the values accepted by --on-include-conflict
+var includeConflictActions = []string{includeReplace, includeKeep, includeAbort}
+
+// validateOnIncludeConflict checks the value of --on-include-conflict
+func validateOnIncludeConflict(s string) error {
+	if !slices.Contains(includeConflictActions, s) {
+		return fmt.Errorf("unsupported action '%s' (supported: %s)", s, strings.Join(includeConflictActions, ", "))
+	}
+	return nil
+}
+
+// resolveIncludeConflict decides what happens to the includeIf sectionName of
+// the global config at globalPath, which loads existingPaths instead of
+// localConfigPath: --on-include-conflict if given, replace with --yes, else
+// the user's choice. Without a terminal it is an error, as is abort.
+func resolveIncludeConflict(sectionName, globalPath, localConfigPath string, existingPaths []string, data FormData, assumeYes bool) (string, error) {
+	action := data.OnIncludeConflict
+	if action == "" {
+		switch {
+		case assumeYes:
+			action = includeReplace
+		case !term.IsTerminal(int(os.Stdin.Fd())):
+			return "", fmt.Errorf("[%s] in '%s' already includes '%s'; pass --on-include-conflict replace or keep", sectionName, stylePath.Render(globalPath), stylePath.Render(strings.Join(existingPaths, "', '")))
+		default:
+			var err error
+			if action, err = selectIncludeConflictAction(sectionName, localConfigPath, existingPaths); err != nil {
+				return "", err
+			}
+		}
+	}
+	if action == includeAbort {
+		return "", abortError("[%s] in '%s' already includes '%s'; aborted", sectionName, stylePath.Render(globalPath), stylePath.Render(strings.Join(existingPaths, "', '")))
+	}
+	return action, nil
+}
+
+// selectIncludeConflictAction asks whether the includeIf sectionName should
+// keep loading existingPaths or load localConfigPath instead
+func selectIncludeConflictAction(sectionName, localConfigPath string, existingPaths []string) (string, error) {
+	action := includeReplace
+	err := runField(huh.NewSelect[string]().
+		Title("["+sectionName+"] already includes "+strings.Join(existingPaths, ", ")).
+		Description("Only one config can apply to the directory; keeping the existing include leaves "+localConfigPath+" unused").
+		Options(
+			huh.NewOption("Replace it with "+localConfigPath, includeReplace),
+			huh.NewOption("Keep the existing include", includeKeep),
+			huh.NewOption("Abort", includeAbort),
+		).
+		Value(&action),
+	)
+	return action, err
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// minSigningGitVersion is the first git release that supports SSH commit signing
+var minSigningGitVersion = [3]int{2, 34, 0}
+
+// minHasconfigGitVersion is the first git release that supports includeIf "hasconfig:remote.*.url:"
+var minHasconfigGitVersion = [3]int{2, 36, 0}
+
+// minOnbranchGitVersion is the first git release that supports includeIf "onbranch:"
+var minOnbranchGitVersion = [3]int{2, 23, 0}
+
+// minInitialBranchGitVersion is the first git release that supports `git init -b`
+var minInitialBranchGitVersion = [3]int{2, 28, 0}
+
+// gitVersionPattern extracts the numeric version from `git --version` output,
+// e.g. "git version 2.39.2 (Apple Git-143)" or "git version 2.41.0.windows.1"
+var gitVersionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Installation hints shown when a dependency is missing
+const (
+	sshKeygenInstallHint = "Install the OpenSSH client:\n" +
+		"  Debian/Ubuntu: sudo apt install openssh-client\n" +
+		"  Fedora/RHEL:   sudo dnf install openssh-clients\n" +
+		"  macOS:         included with the OS (or brew install openssh)\n" +
+		"  Windows:       Settings > Apps > Optional features > OpenSSH Client, or install Git for Windows"
+	gitInstallHint = "Install or upgrade git from https://git-scm.com/downloads (or your package manager)"
+)
+
+// checkDependencies verifies that the external tools needed for data are installed.
+// keyTypeKnown and signKnown tell whether data.KeyType and data.SignCommits are
+// final yet, so the check can run before the form and again after it.
+func checkDependencies(data FormData, keyTypeKnown, signKnown bool) (err error) {
+	defer func() { err = withExitCode(exitDependency, err) }()
+
+	if keyTypeKnown && data.ExistingKey == "" && !usesHTTPS(data) && !sshKeygenAvailable() {
+		if isSecurityKeyType(data.KeyType) {
+			return fmt.Errorf("ssh-keygen was not found on your PATH, but it is required for %s keys.\n%s", data.KeyType, sshKeygenInstallHint)
+		}
+		if !data.NativeKeygen {
+			logWarn("ssh-keygen was not found on your PATH, keys will be generated with the built-in generator.")
+		}
+	}
+	if keyTypeKnown && data.ExistingKey == "" && !usesHTTPS(data) && !useNativeKeygen(data) {
+		if err := checkKeyTypeSupported(data.KeyType, data.ECDSACurve, supportedKeyAlgorithms()); err != nil {
+			return err
+		}
+	}
+
+	if signKnown && signsWithSSH(data) {
+		if err := checkGitVersion(minSigningGitVersion, "SSH commit signing", "run without signing or use --sign-method gpg"); err != nil {
+			return err
+		}
+	}
+	if signKnown && signsWithGPG(data) {
+		if gpgProgram(data.GPGProgram) == "" {
+			return fmt.Errorf("gpg was not found on your PATH, but it is required for GPG signing.\n%s", gpgInstallHint)
+		}
+	}
+	// Older git silently ignores the condition, so the identity would never apply
+	if effectiveIncludeMatch(data) != matchGitdir {
+		if err := checkGitVersion(minHasconfigGitVersion, "remote URL matching", "match by directory only"); err != nil {
+			return err
+		}
+	}
+	if data.Branch != "" {
+		if err := checkGitVersion(minOnbranchGitVersion, "branch matching", "match by directory only"); err != nil {
+			return err
+		}
+	}
+	if data.GitInit {
+		if _, err := exec.LookPath("git"); err != nil {
+			return fmt.Errorf("git was not found on your PATH, but it is required for --%s.\n%s", flagGitInit, gitInstallHint)
+		}
+	}
+	if data.InitialBranch != "" {
+		if err := checkGitVersion(minInitialBranchGitVersion, "choosing the initial branch", "leave out --"+flagInitialBranch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGitVersion verifies that git is installed and at least minVersion, the
+// first release supporting feature; alternative is what the user can do instead
+func checkGitVersion(minVersion [3]int, feature, alternative string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git was not found on your PATH, but it is required for %s.\n%s", feature, gitInstallHint)
+	}
+	output, err := execCommand("git", "--version").Output()
+	if err != nil {
+		return fmt.Errorf("failed to run 'git --version': %w", err)
+	}
+
+	version, ok := parseGitVersion(string(output))
+	if !ok {
+		// Unknown format: don't block the user on a version we can't read
+		return nil
+	}
+	if compareVersions(version, minVersion) < 0 {
+		return fmt.Errorf("%s is too old for %s (requires git %d.%d+).\n%s, or %s",
+			strings.TrimSpace(string(output)), feature, minVersion[0], minVersion[1], gitInstallHint, alternative)
+	}
+	return nil
+}
+
+// parseGitVersion extracts major, minor and patch from `git --version` output
+func parseGitVersion(output string) ([3]int, bool) {
+	var version [3]int
+	match := gitVersionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return version, false
+	}
+	for i := range version {
+		if match[i+1] != "" {
+			version[i], _ = strconv.Atoi(match[i+1])
+		}
+	}
+	return version, true
+}
+
+// compareVersions returns -1, 0 or 1 depending on whether a is lower than, equal to or higher than b
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// supportedKeyAlgorithms returns the key algorithms the installed OpenSSH
+// supports, as listed by `ssh -Q key`, or nil when they cannot be told
+func supportedKeyAlgorithms() []string {
+	output, err := execCommand("ssh", "-Q", "key").Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(output))
+}
+
+// keyAlgorithm returns the OpenSSH name of the algorithm of a keyType key,
+// with curve picking the ecdsa one
+func keyAlgorithm(keyType string, curve int) string {
+	switch keyType {
+	case "ed25519":
+		return "ssh-ed25519"
+	case "rsa":
+		return "ssh-rsa"
+	case "ecdsa":
+		if curve == 0 {
+			curve = ecdsaCurves[0]
+		}
+		return fmt.Sprintf("ecdsa-sha2-nistp%d", curve)
+	case "ed25519-sk":
+		return "sk-ssh-ed25519@openssh.com"
+	case "ecdsa-sk":
+		return "sk-ecdsa-sha2-nistp256@openssh.com"
+	}
+	return keyType
+}
+
+// checkKeyTypeSupported verifies that OpenSSH, whose key algorithms are
+// algorithms, can generate a keyType key. An empty list means the check could
+// not run, which lets ssh-keygen have the last word.
+func checkKeyTypeSupported(keyType string, curve int, algorithms []string) error {
+	if len(algorithms) == 0 || slices.Contains(algorithms, keyAlgorithm(keyType, curve)) {
+		return nil
+	}
+	hint := "Upgrade OpenSSH"
+	if isSecurityKeyType(keyType) {
+		hint = "Security keys require OpenSSH 8.2+ built with FIDO support (libfido2); upgrade or reinstall OpenSSH"
+	}
+	alternative := "ed25519"
+	if keyType == "ed25519" {
+		alternative = "rsa"
+	}
+	return fmt.Errorf("the installed ssh-keygen cannot generate %s keys (`ssh -Q key` does not list %s).\n%s, or choose another key type, e.g. --%s %s",
+		keyType, keyAlgorithm(keyType, curve), hint, flagKeyType, alternative)
+}
+
+// availableKeyTypes returns the key types that can be generated on this system
+func availableKeyTypes() []string {
+	if !sshKeygenAvailable() {
+		return nativeKeyTypes
+	}
+	algorithms := supportedKeyAlgorithms()
+	if len(algorithms) == 0 {
+		return keyTypes
+	}
+	available := []string{}
+	for _, keyType := range keyTypes {
+		if slices.Contains(algorithms, keyAlgorithm(keyType, 0)) {
+			available = append(available, keyType)
+		}
+	}
+	return available
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// doctorCheck is the outcome of one check on a context
+type doctorCheck struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// doctorReport holds the checks of one context
+type doctorReport struct {
+	Context configContext
+	Checks  []doctorCheck
+}
+
+// healthy reports whether every check of the context passed
+func (r doctorReport) healthy() bool {
+	for _, check := range r.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// gitdirConditionPath returns the directory of an includeIf "gitdir:" or
+// "gitdir/i:" condition as a local path. ok is false for other conditions.
+func gitdirConditionPath(condition string) (string, bool) {
+	pattern, ok := strings.CutPrefix(condition, "gitdir:")
+	if !ok {
+		if pattern, ok = strings.CutPrefix(condition, "gitdir/i:"); !ok {
+			return "", false
+		}
+	}
+	if rest, ok := strings.CutPrefix(pattern, "~/"); ok {
+		if homeDir, err := userHomeDir(); err == nil {
+			pattern = filepath.ToSlash(filepath.Join(homeDir, rest))
+		}
+	}
+	pattern = strings.TrimSuffix(strings.TrimSuffix(pattern, "**"), "/")
+	return filepath.FromSlash(convertFromLinuxPath(pattern)), true
+}
+
+// isSetupContext reports whether ctx looks like one this tool wrote: a gitdir,
+// remote URL or branch condition that includes a directory's .gitconfig, or a file
+// elsewhere (--local-config) whose core.sshCommand names a key or that sets
+// a credential helper (--auth https)
+func isSetupContext(ctx configContext) bool {
+	_, isGitdir := gitdirConditionPath(ctx.Condition)
+	if !isGitdir && !strings.HasPrefix(ctx.Condition, hasconfigPrefix) && !strings.HasPrefix(ctx.Condition, onbranchPrefix) {
+		return false
+	}
+	if filepath.Base(ctx.ConfigPath) == defaultLocalConfigName {
+		return true
+	}
+	local, err := loadGitConfig(ctx.ConfigPath)
+	if err != nil {
+		return false
+	}
+	return sshCommandKeyPath(local.Section("core").Key("sshCommand").String()) != "" || local.Section("credential").HasKey("helper")
+}
+
+// checkPrivateKeyFile checks that a private key exists and only its owner can read it
+func checkPrivateKeyFile(path string) doctorCheck {
+	check := doctorCheck{Name: "SSH key " + path}
+	info, err := os.Stat(path)
+	if err != nil {
+		check.Detail = "missing"
+		return check
+	}
+	// Windows has no Unix permission bits to check
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0077 != 0 {
+		check.Detail = fmt.Sprintf("mode %04o, ssh refuses keys others can read; run chmod 600 %s", perm, path)
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+// diagnoseContext runs every check on ctx
+func diagnoseContext(ctx configContext) doctorReport {
+	report := doctorReport{Context: ctx}
+	add := func(name string, ok bool, detail string) {
+		report.Checks = append(report.Checks, doctorCheck{Name: name, OK: ok, Detail: detail})
+	}
+
+	if dir, ok := gitdirConditionPath(ctx.Condition); ok {
+		_, err := os.Stat(dir)
+		add("Directory "+dir, err == nil, "missing")
+	}
+
+	// Nothing more can be checked without the local config
+	if ctx.Missing {
+		add("Local config "+ctx.ConfigPath, false, "missing")
+		return report
+	}
+	local, err := loadGitConfig(ctx.ConfigPath)
+	if err != nil {
+		add("Local config "+ctx.ConfigPath, false, err.Error())
+		return report
+	}
+	add("Local config "+ctx.ConfigPath, true, "")
+
+	// HTTPS contexts have no key to check
+	keyPath := sshCommandKeyPath(local.Section("core").Key("sshCommand").String())
+	if keyPath == "" && local.Section("credential").HasKey("helper") {
+		add("credential.helper "+local.Section("credential").Key("helper").String(), true, "")
+		return report
+	}
+	if keyPath == "" {
+		add("core.sshCommand", false, "no -i key file set")
+		return report
+	}
+	report.Checks = append(report.Checks, checkPrivateKeyFile(keyPath))
+	_, err = os.Stat(keyPath + ".pub")
+	add("Public key "+keyPath+".pub", err == nil, "missing")
+	return report
+}
+
+// renderDoctorReport turns a context's checks into styled lines
+func renderDoctorReport(report doctorReport) []string {
+	header := styleGood.Render("OK  ")
+	if !report.healthy() {
+		header = styleError.Render("FAIL")
+	}
+	messages := []string{header + " [" + report.Context.Section + "]"}
+	for _, check := range report.Checks {
+		if check.OK {
+			messages = append(messages, "     "+styleGood.Render("ok")+"   "+check.Name)
+		} else {
+			messages = append(messages, "     "+styleError.Render("fail")+" "+check.Name+": "+styleError.Render(check.Detail))
+		}
+	}
+	return messages
+}
+
+// newDoctorFlagSet defines the flags of the doctor subcommand
+func newDoctorFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" doctor", flag.ContinueOnError)
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	addNoBorderFlag(fs)
+	addHomeFlag(fs)
+	return fs
+}
+
+// runDoctor implements the doctor subcommand, checking that every context set
+// up by this tool still has its directory, local config and key files
+func runDoctor(args []string) error {
+	fs := newDoctorFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+	if fs.NArg() > 0 {
+		return usageError(fmt.Errorf("usage: %s doctor", appName))
+	}
+
+	globalGitConfigPath, contexts, err := loadContexts()
+	if err != nil {
+		return err
+	}
+
+	messages := []string{styleInfo.Render("Contexts in") + " " + stylePath.Render(globalGitConfigPath), ""}
+	checked, failed, skipped := 0, 0, 0
+	for _, ctx := range contexts {
+		if !isSetupContext(ctx) {
+			skipped++
+			continue
+		}
+		report := diagnoseContext(ctx)
+		checked++
+		if !report.healthy() {
+			failed++
+		}
+		messages = append(messages, renderDoctorReport(report)...)
+	}
+
+	if checked == 0 {
+		messages = append(messages, styleWarn.Render("No contexts set up by "+appName+" were found."))
+	} else {
+		messages = append(messages, "")
+		if failed == 0 {
+			messages = append(messages, styleGood.Render(fmt.Sprintf("All %d contexts look healthy", checked)))
+		} else {
+			messages = append(messages, styleError.Render(fmt.Sprintf("%d of %d contexts have problems", failed, checked)))
+		}
+	}
+	if skipped > 0 {
+		messages = append(messages, styleInfo.Render(fmt.Sprintf("Skipped %d includeIf sections not written by %s", skipped, appName)))
+	}
+	printBorderedMessages(messages)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d contexts have problems", failed, checked)
+	}
+	return nil
+}
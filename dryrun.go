@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// planFormData describes what processFormData would do for data without
+// touching the filesystem or running ssh-keygen
+func planFormData(data FormData, absPath string, opts cliOptions) ([]string, []configDump, error) {
+	messages := []string{styleWarn.Render("Dry run: no changes will be made"), ""}
+
+	// 1. Target directory
+	scope := effectiveScope(data)
+	if _, err := os.Stat(absPath); err == nil {
+		if scope != scopeGlobalOnly {
+			messages = append(messages, styleInfo.Render("Directory already exists:")+" "+stylePath.Render(absPath))
+		}
+	} else if os.IsNotExist(err) {
+		messages = append(messages, styleInfo.Render("Would create directory:")+" "+stylePath.Render(absPath))
+	} else {
+		return nil, nil, fmt.Errorf("failed to check directory status '%s': %w", stylePath.Render(absPath), err)
+	}
+	if conflict := identityConflict(absPath, data.GitEmail); conflict != "" && scope == scopeUser {
+		hint := " (setup asks before going ahead, or needs --force)"
+		if opts.Force {
+			hint = " (going ahead because of --force)"
+		}
+		messages = append(messages, styleWarn.Render("Warning: "+conflict+hint))
+	}
+
+	// 2. SSH key, or none for HTTPS
+	var privateKeyPath, publicKeyPath string
+	if warning := providerKeyWarning(data); warning != "" && !usesHTTPS(data) {
+		messages = append(messages, styleWarn.Render("Warning: "+warning))
+	}
+	if usesHTTPS(data) {
+		messages = append(messages, styleKey.Render("Would use credential helper:")+" "+styleKeyText.Render(credentialHelper(data)))
+	} else if data.ExistingKey != "" {
+		if err := validateExistingKey(data.ExistingKey); err != nil {
+			return nil, nil, err
+		}
+		privateKeyPath, publicKeyPath = data.ExistingKey, data.ExistingKey+".pub"
+		messages = append(messages, styleKey.Render("Would use existing SSH key:")+" "+stylePath.Render(privateKeyPath))
+	} else {
+		var err error
+		_, privateKeyPath, publicKeyPath, err = sshKeyPaths(data.SSHDir, data.KeyName)
+		if err != nil {
+			return nil, nil, err
+		}
+		messages = append(messages, styleKey.Render("Would generate SSH key:")+" "+stylePath.Render(privateKeyPath))
+		if useNativeKeygen(data) {
+			messages = append(messages, styleKeyText.Render("using the built-in "+data.KeyType+" generator (ssh-keygen not used)"))
+		} else {
+			messages = append(messages, styleKeyText.Render(formatCommand("ssh-keygen", redactKeygenArgs(sshKeygenArgs(data, privateKeyPath)))))
+		}
+		if isSecurityKeyType(data.KeyType) {
+			messages = append(messages, styleWarn.Render(securityKeyNotice(data)))
+		}
+	}
+
+	// 3. Local .gitconfig
+	var buf bytes.Buffer
+	var signingPrivateKeyPath, signingPublicKeyPath string
+	paths := configPaths{
+		PrivateKey: styledPath(privateKeyPath),
+		PublicKey:  styledPath(publicKeyPath),
+	}
+	if signsWithSSH(data) && data.SigningKey != "" {
+		if err := validateExistingKey(data.SigningKey); err != nil {
+			return nil, nil, err
+		}
+		paths.SigningKey = styledPath(data.SigningKey + ".pub")
+		messages = append(messages, styleKey.Render("Would sign with existing key:")+" "+stylePath.Render(data.SigningKey))
+	} else if signsWithSSH(data) && data.SeparateSigningKey {
+		var err error
+		_, signingPrivateKeyPath, signingPublicKeyPath, err = sshKeyPaths(data.SSHDir, signingKeyName(data.KeyName))
+		if err != nil {
+			return nil, nil, err
+		}
+		paths.SigningKey = styledPath(signingPublicKeyPath)
+		messages = append(messages, styleKey.Render("Would generate signing key:")+" "+stylePath.Render(signingPrivateKeyPath))
+	}
+	if signsWithGPG(data) {
+		messages = append(messages, styleKey.Render("Would sign with GPG key:")+" "+styleKeyText.Render(data.GPGKey))
+		if data.GPGProgram != "" {
+			messages = append(messages, styleKey.Render("Would set gpg.program:")+" "+stylePath.Render(data.GPGProgram))
+		}
+	}
+	if signsWithSSH(data) {
+		allowedSignersFile, err := allowedSignersPath()
+		if err != nil {
+			return nil, nil, err
+		}
+		paths.AllowedSigners = styledPath(allowedSignersFile)
+		messages = append(messages, styleWarn.Render("Would add "+strings.Join(identityEmails(data), ", ")+" and the public key to:")+" "+stylePath.Render(allowedSignersFile))
+	}
+	if data.KnownHostsFile != "" {
+		paths.KnownHosts = styledPath(data.KnownHostsFile)
+		if _, err := os.Stat(data.KnownHostsFile); err != nil {
+			messages = append(messages, styleWarn.Render("Would create known hosts file:")+" "+stylePath.Render(data.KnownHostsFile))
+		}
+	}
+	commitTemplatePath, err := commitTemplateFile(absPath, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if commitTemplatePath != "" {
+		if err := checkCommitTemplate(commitTemplatePath, data.CommitTemplateText); err != nil {
+			return nil, nil, err
+		}
+		paths.CommitTemplate = styledPath(commitTemplatePath)
+		if _, err := os.Stat(commitTemplatePath); err != nil {
+			messages = append(messages, styleWarn.Render("Would create commit template:")+" "+stylePath.Render(commitTemplatePath))
+		}
+	}
+	localCfg, err := applyTemplateConfig(buildLocalGitConfig(data, paths), data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := localCfg.WriteTo(&buf); err != nil {
+		return nil, nil, fmt.Errorf("failed to render local .gitconfig: %w", err)
+	}
+	messages = append(messages, "")
+
+	// The repo and global-only scopes set the same keys in an existing config
+	var includeDump configDump
+	var localConfigPath string
+	if scope != scopeUser {
+		scopeConfig := filepath.Join(absPath, ".git", "config") // Where git init would create it
+		if scope == scopeGlobalOnly || isGitRepo(absPath) {
+			if scopeConfig, err = scopeConfigPath(absPath, data); err != nil {
+				return nil, nil, err
+			}
+		}
+		messages = append(messages, styleWarn.Render("Would set in the "+scopeConfigLabel(data)+":")+" "+stylePath.Render(scopeConfig))
+		messages = append(messages, styleKeyText.Render(strings.TrimSpace(buf.String())))
+		includeDump = configDump{Label: scopeConfigLabel(data), Path: scopeConfig, Content: buf.String()}
+	} else {
+		if localConfigPath, err = localConfigFile(absPath, data); err != nil {
+			return nil, nil, err
+		}
+		if _, err := os.Stat(localConfigPath); err != nil {
+			messages = append(messages, styleWarn.Render("Would write local .gitconfig:")+" "+stylePath.Render(localConfigPath))
+		} else if data.OnConflict == conflictAbort {
+			return nil, nil, fmt.Errorf("local config '%s' already exists; setup would abort without changes", stylePath.Render(localConfigPath))
+		} else if data.OnConflict == "" {
+			messages = append(messages, styleWarn.Render("Would ask whether to merge into or overwrite the existing local .gitconfig:")+" "+stylePath.Render(localConfigPath))
+		} else if data.OnConflict == conflictMerge {
+			messages = append(messages, styleWarn.Render("Would merge into the existing local .gitconfig:")+" "+stylePath.Render(localConfigPath))
+		} else {
+			messages = append(messages, styleWarn.Render("Would overwrite the existing local .gitconfig:")+" "+stylePath.Render(localConfigPath))
+		}
+		messages = append(messages, styleKeyText.Render(strings.TrimSpace(buf.String())))
+	}
+
+	// 4. Global .gitconfig, or the repository's own
+	if useRepoConfig(absPath, data) {
+		messages = append(messages, "")
+		repoConfig := filepath.Join(absPath, ".git", "config") // Where git init would create it
+		if isGitRepo(absPath) {
+			var err error
+			if repoConfig, err = repoConfigPath(absPath); err != nil {
+				return nil, nil, err
+			}
+		}
+		messages = append(messages, styleWarn.Render("Would add to the repository config (unless already included):")+" "+stylePath.Render(repoConfig))
+		section := repoIncludeSection(data.Branch)
+		messages = append(messages, styleKeyText.Render("["+section+"]\npath = "+repoIncludePath(repoConfig, localConfigPath)))
+		includeDump = configDump{Label: "include in the repository config", Path: repoConfig,
+			Content: appendConfigSection("", section, "path", repoIncludePath(repoConfig, localConfigPath))}
+	} else if scope == scopeUser {
+		globalGitConfigPath, err := resolveGlobalGitConfigPath()
+		if err != nil {
+			return nil, nil, err
+		}
+		sectionNames, includeIfPathValue := includeIfSections(absPath, localConfigPath, data)
+		if rel, ok := relativeIncludePath(globalGitConfigPath, localConfigPath); ok && data.RelativeInclude {
+			includeIfPathValue = rel
+		}
+		messages = append(messages, "")
+		messages = append(messages, styleWarn.Render("Would add to global .gitconfig:")+" "+stylePath.Render(globalGitConfigPath))
+		globalCfg, err := loadGitConfig(globalGitConfigPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+		}
+		includeAction := data.OnIncludeConflict
+		if includeAction == "" && opts.AssumeYes {
+			includeAction = includeReplace
+		}
+		includeDump = configDump{Label: "includeIf in global .gitconfig", Path: globalGitConfigPath}
+		for _, sectionName := range sectionNames {
+			messages = append(messages, styleKeyText.Render(fmt.Sprintf("[%s]\npath = %s", sectionName, includeIfPathValue)))
+			includeDump.Content = appendConfigSection(includeDump.Content, sectionName, "path", includeIfPathValue)
+			_, conflicts := matchingIncludes(globalCfg, globalGitConfigPath, sectionName, localConfigPath)
+			for _, section := range conflicts {
+				existingPath := resolveIncludePath(globalGitConfigPath, section.Key("path").String())
+				switch includeAction {
+				case includeKeep:
+					messages = append(messages, styleError.Render("Would keep ["+section.Name()+"], which stays active instead:")+" "+stylePath.Render(existingPath))
+				case includeAbort:
+					return nil, nil, fmt.Errorf("[%s] in '%s' already includes '%s'; setup would abort", section.Name(), stylePath.Render(globalGitConfigPath), stylePath.Render(existingPath))
+				case includeReplace:
+					messages = append(messages, styleWarn.Render("Would replace ["+section.Name()+"], which includes:")+" "+stylePath.Render(existingPath))
+				default:
+					messages = append(messages, styleWarn.Render("Would ask whether to replace ["+section.Name()+"], which includes:")+" "+stylePath.Render(existingPath))
+				}
+			}
+		}
+	}
+
+	// 5. ssh config
+	if data.SSHHostAlias != "" {
+		sshDir, err := defaultSSHDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		messages = append(messages, "")
+		messages = append(messages, styleWarn.Render("Would add to ssh config (unless Host "+data.SSHHostAlias+" exists):")+" "+stylePath.Render(filepath.Join(sshDir, "config")))
+		messages = append(messages, styleKeyText.Render(strings.TrimSpace(sshConfigHostBlock(data.SSHHostAlias, sshHostName(data), styledPath(privateKeyPath)))))
+	}
+	if !usesHTTPS(data) {
+		if warning := sshConfigConflictWarning(data); warning != "" {
+			messages = append(messages, "")
+			messages = append(messages, styleWarn.Render("Warning: "+warning))
+		}
+	}
+
+	// 6. git init
+	if data.GitInit {
+		messages = append(messages, "")
+		if isGitRepo(absPath) {
+			messages = append(messages, styleInfo.Render("Already a git repository, would skip git init:")+" "+stylePath.Render(absPath))
+		} else {
+			messages = append(messages, styleGood.Render("Would initialize a git repository:")+" "+styleKeyText.Render(formatCommand("git", gitInitArgs(absPath, data.InitialBranch))))
+		}
+	}
+	if data.AppendToGitignore {
+		root, _, _, ok := enclosingRepo(absPath)
+		if !ok && data.GitInit {
+			root, ok = absPath, true
+		}
+		entries := []string{}
+		if ok {
+			entries = gitignoreEntries(root, []string{privateKeyPath, publicKeyPath, signingPrivateKeyPath, signingPublicKeyPath, localConfigPath})
+		}
+		if len(entries) > 0 {
+			messages = append(messages, styleWarn.Render("Would add to "+filepath.Join(root, ".gitignore")+" (unless listed):")+" "+styleKeyText.Render(strings.Join(entries, " ")))
+		} else {
+			messages = append(messages, styleInfo.Render("No files of the context inside a git repository, would leave .gitignore alone"))
+		}
+	}
+	if data.Remote != "" {
+		messages = append(messages, styleGood.Render("Would add remote origin (unless one exists):")+" "+styleKeyText.Render(data.Remote))
+		if warning := remoteHostWarning(data); warning != "" {
+			messages = append(messages, styleWarn.Render("Warning: "+warning))
+		}
+	}
+
+	if opts.AddToAgent {
+		messages = append(messages, "")
+		messages = append(messages, styleInfo.Render("Would add the key to ssh-agent:")+" "+styleKeyText.Render(formatCommand("ssh-add", sshAddArgs(privateKeyPath))))
+		if !agentRunning() {
+			messages = append(messages, styleWarn.Render("No ssh-agent is running, so this would be skipped; "+agentStartHint))
+		}
+	}
+	if opts.PubkeyOut != "" {
+		messages = append(messages, "")
+		messages = append(messages, styleInfo.Render("Would write the public key to:")+" "+stylePath.Render(opts.PubkeyOut))
+	}
+	if opts.GitHubUpload && data.Provider == providerGitHub {
+		kinds := "an authentication key"
+		if signsWithSSH(data) {
+			kinds = "an authentication and a signing key"
+		}
+		messages = append(messages, "")
+		messages = append(messages, styleInfo.Render("Would add the public key to GitHub ("+githubAPIURL()+") as "+kinds))
+	}
+
+	if data.TestConnection {
+		messages = append(messages, "")
+		messages = append(messages, styleInfo.Render("Would test the SSH connection to git@"+testHost(data)))
+	}
+
+	if !opts.DumpConfig {
+		return messages, nil, nil
+	}
+	if scope != scopeUser {
+		return messages, []configDump{includeDump}, nil
+	}
+	return messages, []configDump{{Label: "local .gitconfig", Path: localConfigPath, Content: buf.String()}, includeDump}, nil
+}
+
+// redactKeygenArgs hides the passphrase argument of an ssh-keygen invocation
+func redactKeygenArgs(args []string) []string {
+	redacted := append([]string(nil), args...)
+	for i := 0; i < len(redacted)-1; i++ {
+		if redacted[i] == "-N" && redacted[i+1] != "" {
+			redacted[i+1] = "********"
+		}
+	}
+	return redacted
+}
+
+// formatCommand renders a command line, quoting empty and space-containing arguments
+func formatCommand(name string, args []string) string {
+	parts := []string{name}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			arg = fmt.Sprintf("%q", arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"golang.org/x/term"
+)
+
+// editOptions holds the flags of the edit subcommand
+type editOptions struct {
+	Username  string
+	Email     string
+	Sign      bool
+	AssumeYes bool
+	DryRun    bool
+}
+
+// newEditFlagSet defines the flags of the edit subcommand, storing their values in opts
+func newEditFlagSet(opts *editOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" edit", flag.ContinueOnError)
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	addNoBorderFlag(fs)
+	addHomeFlag(fs)
+	fs.StringVar(&opts.Username, flagUsername, "", "new user.name (skips the form)")
+	fs.StringVar(&opts.Email, flagEmail, "", "new user.email (skips the form)")
+	fs.BoolVar(&opts.Sign, flagSign, false, "sign commits and tags with the context's SSH key; --sign=false turns signing off (skips the form)")
+	fs.BoolVar(&opts.AssumeYes, "yes", false, "do not ask for confirmation before changing the local config")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "only show the changes")
+	return fs
+}
+
+// configChange is one key edit changes in a local config
+type configChange struct {
+	Key string
+	Old string
+	New string
+}
+
+// contextSettings are the values of a local config that edit can change
+type contextSettings struct {
+	Username string
+	Email    string
+	Sign     bool
+}
+
+// loadContextSettings reads the editable values of the local config at path
+func loadContextSettings(path string) (contextSettings, error) {
+	local, err := loadGitConfig(path)
+	if err != nil {
+		return contextSettings{}, fmt.Errorf("failed to load '%s': %w", stylePath.Render(path), err)
+	}
+	sign, _ := local.Section("commit").Key("gpgsign").Bool()
+	return contextSettings{
+		Username: local.Section("user").Key("name").String(),
+		Email:    local.Section("user").Key("email").String(),
+		Sign:     sign,
+	}, nil
+}
+
+// pickContext asks which of the contexts in the global config to edit and
+// returns its local config. Contexts matching by directory and by remote
+// share one file, so each file is offered once.
+func pickContext(contexts []configContext) (string, error) {
+	options := []huh.Option[string]{}
+	seen := map[string]bool{}
+	for _, ctx := range contexts {
+		if ctx.Missing || seen[ctx.ConfigPath] {
+			continue
+		}
+		seen[ctx.ConfigPath] = true
+		label := ctx.ConfigPath
+		if ctx.UserEmail != "" {
+			label += fmt.Sprintf("  %s <%s>", ctx.UserName, ctx.UserEmail)
+		}
+		options = append(options, huh.NewOption(label, ctx.ConfigPath))
+	}
+	if len(options) == 0 {
+		return "", fmt.Errorf("no contexts to edit; set one up with %s --dir <directory>", appName)
+	}
+
+	var path string
+	err := runField(huh.NewSelect[string]().
+		Title("Context to Edit").
+		Options(options...).
+		Value(&path),
+	)
+	return path, err
+}
+
+// editSettingsForm lets the user change the settings of the context in path,
+// starting from their current values
+func editSettingsForm(path string, settings *contextSettings) error {
+	return huh.NewForm(huh.NewGroup(
+		huh.NewInput().
+			Title("Git Username").
+			Description(path).
+			Value(&settings.Username).
+			Validate(validateUsername),
+		huh.NewInput().
+			Title("Git Email").
+			Value(&settings.Email).
+			Validate(validateEmail),
+		huh.NewConfirm().
+			Title("Sign Commits and Tags?").
+			Description("Uses the context's SSH key; requires Git 2.34+").
+			Value(&settings.Sign),
+	)).WithTheme(formTheme()).Run()
+}
+
+// planContextEdit lists the keys of the local config at path to change so it
+// holds settings instead of current. Turning signing on where the config has
+// no signing key signs with the SSH key from core.sshCommand.
+func planContextEdit(path string, current, settings contextSettings) ([]configChange, error) {
+	changes := []configChange{}
+	if settings.Username != current.Username {
+		changes = append(changes, configChange{"user.name", current.Username, settings.Username})
+	}
+	if settings.Email != current.Email {
+		changes = append(changes, configChange{"user.email", current.Email, settings.Email})
+	}
+	if settings.Sign == current.Sign {
+		return changes, nil
+	}
+
+	value := strconv.FormatBool(settings.Sign)
+	if settings.Sign {
+		local, err := loadGitConfig(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load '%s': %w", stylePath.Render(path), err)
+		}
+		if local.Section("user").Key("signingkey").String() == "" {
+			keyPath := sshCommandKeyPath(local.Section("core").Key("sshCommand").String())
+			if keyPath == "" {
+				return nil, fmt.Errorf("'%s' sets no key with core.sshCommand -i to sign with", stylePath.Render(path))
+			}
+			changes = append(changes,
+				configChange{"gpg.format", local.Section("gpg").Key("format").String(), "ssh"},
+				configChange{"user.signingkey", "", styledPath(keyPath + ".pub")},
+			)
+		}
+	}
+	return append(changes,
+		configChange{"commit.gpgsign", strconv.FormatBool(current.Sign), value},
+		configChange{"tag.gpgsign", strconv.FormatBool(current.Sign), value},
+	), nil
+}
+
+// applyContextEdit writes changes to the local config at path with git
+// config, so the rest of the file keeps its layout and comments
+func applyContextEdit(path string, changes []configChange) error {
+	for _, change := range changes {
+		output, err := execCommand("git", "config", "--file", path, change.Key, change.New).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to set %s in '%s': %w\n%s", change.Key, stylePath.Render(path), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// trustSigningKey adds the SSH signing key of the local config at path to the
+// allowed signers file for email, so git can verify the context's own
+// signatures after the email changed or signing was turned on
+func trustSigningKey(path, email string) (string, error) {
+	local, err := loadGitConfig(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to load '%s': %w", stylePath.Render(path), err)
+	}
+	if local.Section("gpg").Key("format").String() != "ssh" {
+		return "", nil
+	}
+	keyFile := signingKeyFile(path, local.Section("user").Key("signingkey").String())
+	if keyFile == "" {
+		return "", nil
+	}
+	publicKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read signing key '%s': %w", stylePath.Render(keyFile), err)
+	}
+	allowedSignersFile, added, err := addAllowedSigner(email, string(publicKey))
+	if err != nil || !added {
+		return "", err
+	}
+	if local.Section(`gpg "ssh"`).Key("allowedSignersFile").String() == "" {
+		if err := applyContextEdit(path, []configChange{{Key: "gpg.ssh.allowedSignersFile", New: styledPath(allowedSignersFile)}}); err != nil {
+			return "", err
+		}
+	}
+	return allowedSignersFile, nil
+}
+
+// runEdit implements the edit subcommand, changing the identity or signing of
+// an existing context without touching its SSH key
+func runEdit(args []string) error {
+	var opts editOptions
+	fs := newEditFlagSet(&opts)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return usageError(fmt.Errorf("usage: %s edit [--username NAME] [--email EMAIL] [--sign[=false]] [--yes] [<directory>]", appName))
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set[flagUsername] {
+		if err := validateUsername(opts.Username); err != nil {
+			return usageError(fmt.Errorf("invalid --%s: %w", flagUsername, err))
+		}
+	}
+	if set[flagEmail] {
+		if err := validateEmail(opts.Email); err != nil {
+			return usageError(fmt.Errorf("invalid --%s: %w", flagEmail, err))
+		}
+	}
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+
+	// Find the local config: the directory's, or the one picked from the list
+	var path string
+	if len(positional) == 1 {
+		absPath, err := resolveTargetDir(positional[0])
+		if err != nil {
+			return err
+		}
+		globalGitConfigPath, err := resolveGlobalGitConfigPath()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadGitConfig(globalGitConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+		}
+		path = contextConfigPath(cfg, globalGitConfigPath, absPath)
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("no context found for '%s' ('%s' does not exist)", stylePath.Render(absPath), stylePath.Render(path))
+		}
+	} else {
+		if !interactive {
+			return usageError(fmt.Errorf("name the directory of the context to edit: %s edit <directory>", appName))
+		}
+		_, contexts, err := loadContexts()
+		if err != nil {
+			return err
+		}
+		if path, err = pickContext(contexts); err != nil {
+			return err
+		}
+	}
+
+	current, err := loadContextSettings(path)
+	if err != nil {
+		return err
+	}
+	settings := current
+	if set[flagUsername] || set[flagEmail] || set[flagSign] {
+		if set[flagUsername] {
+			settings.Username = opts.Username
+		}
+		if set[flagEmail] {
+			settings.Email = opts.Email
+		}
+		if set[flagSign] {
+			settings.Sign = opts.Sign
+		}
+	} else {
+		if !interactive {
+			return usageError(fmt.Errorf("pass --%s, --%s or --%s to change the context without a terminal", flagUsername, flagEmail, flagSign))
+		}
+		if err := editSettingsForm(path, &settings); err != nil {
+			return fmt.Errorf("Form cancelled or failed: %w", err)
+		}
+	}
+	if settings.Sign && !current.Sign {
+		if err := withExitCode(exitDependency, checkGitVersion(minSigningGitVersion, "SSH commit signing", "leave signing off")); err != nil {
+			return err
+		}
+	}
+
+	changes, err := planContextEdit(path, current, settings)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		printBorderedMessages([]string{styleInfo.Render("Nothing to change in") + " " + stylePath.Render(path)})
+		return nil
+	}
+
+	messages := []string{styleInfo.Render("Changes to") + " " + stylePath.Render(path), ""}
+	for _, change := range changes {
+		old := change.Old
+		if old == "" {
+			old = "(not set)"
+		}
+		messages = append(messages, fmt.Sprintf("%-16s %s -> %s", change.Key, old, styleKeyText.Render(change.New)))
+	}
+	printBorderedMessages(messages)
+	if opts.DryRun {
+		return nil
+	}
+	ok, err := confirm("Apply these changes?", opts.AssumeYes || !interactive)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return abortError("aborted, the context was not changed")
+	}
+
+	restore, err := backupFile(path)
+	if err != nil {
+		return err
+	}
+	if err := applyContextEdit(path, changes); err != nil {
+		return errors.Join(err, restore())
+	}
+	done := []string{styleGood.Render("Updated") + " " + stylePath.Render(path)}
+	if settings.Sign && slices.ContainsFunc(changes, func(c configChange) bool { return c.Key == "user.email" || c.Key == "commit.gpgsign" }) {
+		allowedSignersFile, err := trustSigningKey(path, settings.Email)
+		if err != nil {
+			return err
+		}
+		if allowedSignersFile != "" {
+			done = append(done, styleWarn.Render("Added "+settings.Email+" to allowed signers:")+" "+stylePath.Render(allowedSignersFile))
+		}
+	}
+	printBorderedMessages(done)
+	return nil
+}
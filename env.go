@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix starts the environment variables that give setup flags a default
+const envPrefix = "GITCONFIG_"
+
+// envNames returns the environment variables read for the flag name: the
+// name in upper case with dashes as underscores, e.g. GITCONFIG_KEY_TYPE,
+// and without them, e.g. GITCONFIG_KEYTYPE
+func envNames(name string) []string {
+	upper := strings.ToUpper(name)
+	names := []string{envPrefix + strings.ReplaceAll(upper, "-", "_")}
+	if strings.Contains(name, "-") {
+		names = append(names, envPrefix+strings.ReplaceAll(upper, "-", ""))
+	}
+	return names
+}
+
+// applyEnvDefaults sets every flag of fs not in set from its GITCONFIG_*
+// variable, if one is set and not empty, and returns the variable used for
+// each flag it set. Flags are not marked as set, so the form still asks those
+// questions, starting from the variable's value.
+func applyEnvDefaults(fs *flag.FlagSet, set map[string]bool) (map[string]string, error) {
+	fromEnv := map[string]string{}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		for _, env := range envNames(f.Name) {
+			value := os.Getenv(env)
+			if value == "" {
+				continue
+			}
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s value '%s': %w", env, value, setErr)
+				return
+			}
+			fromEnv[f.Name] = env
+			return
+		}
+	})
+	return fromEnv, err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+
+	"github.com/charmbracelet/huh"
+)
+
+// Exit codes, so scripts can tell why a run failed
+const (
+	exitFailure    = 1 // Anything not covered below, including failed --from-file contexts
+	exitUsage      = 2 // Invalid or missing flags and values
+	exitDependency = 3 // A required tool (ssh-keygen, git, gpg) is missing or too old
+	exitFilesystem = 4 // A file or directory could not be read or written, or is in the way
+	exitAborted    = 5 // The user cancelled, or --on-conflict abort stopped the run
+)
+
+// exitCodeHelp documents the exit codes at the end of --help
+const exitCodeHelp = `
+Exit codes:
+  0  success
+  1  other failure (also when some --from-file contexts fail)
+  2  invalid or missing flags
+  3  a required tool (ssh-keygen, git, gpg) is missing or too old
+  4  a file or directory could not be read or written, or is in the way
+  5  aborted by the user or an abort action
+`
+
+// exitError attaches an exit code to an error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode marks err to exit with code; nil stays nil
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code, err}
+}
+
+// usageError marks err as a problem with the flags or values given
+func usageError(err error) error {
+	return withExitCode(exitUsage, err)
+}
+
+// abortError reports that the run stopped because the user (or an abort
+// action) asked it to
+func abortError(format string, args ...any) error {
+	return withExitCode(exitAborted, fmt.Errorf(format, args...))
+}
+
+// exitCode picks the exit code for err: the one attached with withExitCode,
+// else one derived from the kind of error, else exitFailure
+func exitCode(err error) int {
+	var coded *exitError
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	switch {
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.Is(err, huh.ErrUserAborted):
+		return exitAborted
+	case errors.Is(err, exec.ErrNotFound):
+		return exitDependency
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return exitFilesystem
+	}
+	return exitFailure
+}
+
+// exitOnError prints err and exits with its exit code if err is not nil
+func exitOnError(err error) {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	logError("%v", err)
+	os.Exit(exitCode(err))
+}
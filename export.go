@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-ini/ini"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats accepted by export --format
+const (
+	exportYAML = "yaml"
+	exportJSON = "json"
+)
+
+// exportFormats lists the values accepted by export --format
+var exportFormats = []string{exportYAML, exportJSON}
+
+// exportOptions holds the flags of the export subcommand
+type exportOptions struct {
+	Format string
+}
+
+// exportDetails describes how an exported context is set up on this machine.
+// It is informational only: --from-file skips it, as the paths and keys
+// belong to the machine the context was exported from.
+type exportDetails struct {
+	ConfigFile       string   `json:"config_file" yaml:"config_file"`
+	Conditions       []string `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+	Key              string   `json:"key,omitempty" yaml:"key,omitempty"` // Path of the private key, never its content
+	PublicKey        string   `json:"public_key,omitempty" yaml:"public_key,omitempty"`
+	Fingerprint      string   `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	SigningPublicKey string   `json:"signing_public_key,omitempty" yaml:"signing_public_key,omitempty"`
+}
+
+// exportedContext is one entry of an export: the batch file fields that
+// recreate the context, plus the details of the exported setup
+type exportedContext struct {
+	FormData `yaml:",inline"`
+	Exported *exportDetails `json:"exported,omitempty" yaml:"exported,omitempty"`
+}
+
+// newExportFlagSet defines the flags of the export subcommand, storing their values in opts
+func newExportFlagSet(opts *exportOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" export", flag.ContinueOnError)
+	addHomeFlag(fs)
+	fs.StringVar(&opts.Format, flagFormat, exportYAML, "output format: "+strings.Join(exportFormats, ", "))
+	return fs
+}
+
+// validateExportFormat checks the value of export --format
+func validateExportFormat(s string) error {
+	if !slices.Contains(exportFormats, s) {
+		return fmt.Errorf("unsupported format '%s' (supported: %s)", s, strings.Join(exportFormats, ", "))
+	}
+	return nil
+}
+
+// homeRelativePath returns path as a ~/ path when it is inside the home
+// directory, so it carries over to machines with another home
+func homeRelativePath(path string) string {
+	homeDir, err := userHomeDir()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(homeDir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return "~/" + filepath.ToSlash(rel)
+}
+
+// contextRelativePath returns path relative to the context directory dir when
+// it is inside it, else as homeRelativePath does, the way --local-config and
+// --commit-template take it
+func contextRelativePath(dir, path string) string {
+	if rel, err := filepath.Rel(dir, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return homeRelativePath(path)
+}
+
+// publicKeyType returns the --key-type and, for rsa, the size of a public key
+func publicKeyType(key ssh.PublicKey) (string, int) {
+	switch key.Type() {
+	case ssh.KeyAlgoED25519:
+		return "ed25519", 0
+	case ssh.KeyAlgoSKED25519:
+		return "ed25519-sk", 0
+	case ssh.KeyAlgoSKECDSA256:
+		return "ecdsa-sk", 0
+	case ssh.KeyAlgoECDSA256:
+		return "ecdsa", 256
+	case ssh.KeyAlgoECDSA384:
+		return "ecdsa", 384
+	case ssh.KeyAlgoECDSA521:
+		return "ecdsa", 521
+	case ssh.KeyAlgoRSA:
+		if cryptoKey, ok := key.(ssh.CryptoPublicKey); ok {
+			if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok {
+				return "rsa", rsaKey.N.BitLen()
+			}
+		}
+		return "rsa", 0
+	}
+	return "", 0
+}
+
+// sshCommandOptions returns the -o options of a core.sshCommand by name
+func sshCommandOptions(sshCommand string) map[string]string {
+	options := map[string]string{}
+	words := splitShellWords(sshCommand)
+	for i := 0; i < len(words)-1; i++ {
+		if words[i].value == "-o" {
+			name, value, _ := strings.Cut(words[i+1].value, "=")
+			options[name] = strings.Trim(value, `"`)
+		}
+	}
+	return options
+}
+
+// exportContext describes the context of absPath, whose local config is
+// localConfigPath, as the batch entry that recreates it. Only public keys are
+// read; the private key is named, never opened.
+func exportContext(absPath, localConfigPath string, local *ini.File, contexts []configContext) (exportedContext, error) {
+	data := FormData{
+		DirectoryName: homeRelativePath(absPath),
+		GitUsername:   local.Section("user").Key("name").String(),
+		GitEmail:      local.Section("user").Key("email").String(),
+	}
+	details := &exportDetails{ConfigFile: localConfigPath}
+	if !samePath(localConfigPath, filepath.Join(absPath, defaultLocalConfigName)) {
+		data.LocalConfig = contextRelativePath(absPath, localConfigPath)
+	}
+
+	// How the context is matched
+	matchesDir := false
+	for _, ctx := range contexts {
+		if !samePath(ctx.ConfigPath, localConfigPath) {
+			continue
+		}
+		details.Conditions = append(details.Conditions, ctx.Condition)
+		switch {
+		case strings.HasPrefix(ctx.Condition, hasconfigPrefix):
+			data.RemoteURL = strings.TrimPrefix(ctx.Condition, hasconfigPrefix)
+		case strings.HasPrefix(ctx.Condition, onbranchPrefix):
+			data.Branch = strings.TrimPrefix(ctx.Condition, onbranchPrefix)
+		default:
+			matchesDir = true
+		}
+	}
+	if data.RemoteURL != "" && !matchesDir {
+		data.IncludeMatch = matchRemote
+	}
+
+	// The key, or the credential helper of an HTTPS context
+	core := local.Section("core")
+	if helper := local.Section("credential").Key("helper").String(); helper != "" {
+		data.Auth, data.CredentialHelper = authHTTPS, helper
+	}
+	if keyPath := sshCommandKeyPath(core.Key("sshCommand").String()); keyPath != "" {
+		details.Key = keyPath
+		if name := filepath.Base(keyPath); !isDefaultKeyName(absPath, name) {
+			data.KeyName = name // A generated name is left out, so the new machine gets its own
+		}
+		if sshDir, err := defaultSSHDir(); err == nil && !samePath(filepath.Dir(keyPath), sshDir) {
+			data.SSHDir = homeRelativePath(filepath.Dir(keyPath))
+		}
+		key, err := readImportedKey(keyPath + ".pub")
+		if err != nil {
+			return exportedContext{}, err
+		}
+		details.PublicKey, details.Fingerprint = key.Content, key.Fingerprint
+		data.KeyType, data.RSABits = publicKeyType(key.key)
+		if data.KeyType == "ecdsa" {
+			data.ECDSACurve, data.RSABits = data.RSABits, 0
+		}
+		if fields := strings.Fields(key.Content); len(fields) > 2 && !isDefaultKeyComment(strings.Join(fields[2:], " "), data) {
+			data.KeyComment = strings.Join(fields[2:], " ")
+		}
+		options := sshCommandOptions(core.Key("sshCommand").String())
+		if knownHosts := options["UserKnownHostsFile"]; knownHosts != "" {
+			data.KnownHostsFile = homeRelativePath(convertFromLinuxPath(knownHosts))
+		}
+		data.HostKeyChecking = options["StrictHostKeyChecking"]
+	}
+
+	// Signing
+	for scope, section := range map[string]string{signScopeCommits: "commit", signScopeTags: "tag", signScopePushes: "push"} {
+		if value := local.Section(section).Key("gpgsign").String(); value != "" && value != "false" {
+			data.SignScopes = append(data.SignScopes, scope)
+		}
+	}
+	if len(data.SignScopes) > 0 {
+		slices.SortFunc(data.SignScopes, func(a, b string) int { return slices.Index(signScopes, a) - slices.Index(signScopes, b) })
+		data.SignCommits = true
+		signingKey := local.Section("user").Key("signingkey").String()
+		if local.Section("gpg").Key("format").String() == "ssh" {
+			data.SignMethod = signMethodSSH
+			if signingPath := signingKeyFile(localConfigPath, signingKey); signingPath != "" && !samePath(signingPath, details.Key+".pub") {
+				data.SeparateSigningKey = true
+				if signing, err := readImportedKey(signingPath); err == nil {
+					details.SigningPublicKey = signing.Content
+				}
+			}
+		} else {
+			data.SignMethod, data.GPGKey = signMethodGPG, signingKey
+			data.GPGProgram = local.Section("gpg").Key("program").String()
+		}
+	}
+
+	// Everything else setup can write
+	data.Editor = core.Key("editor").String()
+	data.AutoCRLF = core.Key("autocrlf").String()
+	data.FileMode = core.Key("fileMode").String()
+	data.PullRebase = local.Section("pull").Key("rebase").String()
+	data.FetchPrune = local.Section("fetch").Key("prune").String()
+	data.DefaultBranch = local.Section("init").Key("defaultBranch").String()
+	data.HTTPProxy = local.Section("http").Key("proxy").String()
+	for _, section := range local.Sections() {
+		if proxyURL, ok := strings.CutPrefix(section.Name(), `http "`); ok && data.HTTPProxy == "" && section.HasKey("proxy") {
+			data.HTTPProxy, data.HTTPProxyURL = section.Key("proxy").String(), strings.TrimSuffix(proxyURL, `"`)
+		}
+	}
+	data.GitProxy = core.Key("gitProxy").String()
+	if template := local.Section("commit").Key("template").String(); template != "" {
+		data.CommitTemplate = contextRelativePath(absPath, resolveIncludePath(localConfigPath, convertFromLinuxPath(template)))
+	}
+	return exportedContext{FormData: data, Exported: details}, nil
+}
+
+// runExport implements the export subcommand, printing a directory's context
+// as a --from-file entry that recreates it on another machine
+func runExport(args []string) error {
+	var opts exportOptions
+	fs := newExportFlagSet(&opts)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError(fmt.Errorf("usage: %s export [--format yaml|json] <directory>", appName))
+	}
+	if err := validateExportFormat(opts.Format); err != nil {
+		return usageError(fmt.Errorf("invalid --%s: %w", flagFormat, err))
+	}
+
+	absPath, err := resolveTargetDir(positional[0])
+	if err != nil {
+		return err
+	}
+	globalGitConfigPath, contexts, err := loadContexts()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadGitConfig(globalGitConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+	}
+	localConfigPath := contextConfigPath(cfg, globalGitConfigPath, absPath)
+	if _, err := os.Stat(localConfigPath); err != nil {
+		return fmt.Errorf("no context found for '%s' ('%s' does not exist)", stylePath.Render(absPath), stylePath.Render(localConfigPath))
+	}
+	local, err := loadGitConfig(localConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load '%s': %w", stylePath.Render(localConfigPath), err)
+	}
+
+	exported, err := exportContext(absPath, localConfigPath, local, contexts)
+	if err != nil {
+		return err
+	}
+	// A list, so the output is a batch file as it is
+	entries := []exportedContext{exported}
+	if opts.Format == exportJSON {
+		return printJSON(entries)
+	}
+	fmt.Printf("# Context exported by %s %s; recreate it with: %s --from-file <this file>\n", appName, appVersion, appName)
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(entries); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flag names for the values otherwise collected by the form
+const (
+	flagDir           = "dir"
+	flagKeyType       = "key-type"
+	flagUsername      = "username"
+	flagEmail         = "email"
+	flagEmails        = "emails"
+	flagSign          = "sign"
+	flagSignCommits   = "sign-commits"
+	flagSignTags      = "sign-tags"
+	flagSignPushes    = "sign-pushes"
+	flagSignMethod    = "sign-method"
+	flagGPGKey        = "gpg-key"
+	flagGPGProgram    = "gpg-program"
+	flagSeparate      = "separate-signing-key"
+	flagSigningKey    = "signing-key"
+	flagCurve         = "ecdsa-curve"
+	flagRSABits       = "rsa-bits"
+	flagExisting      = "existing-key"
+	flagSSHDir        = "ssh-dir"
+	flagKeyName       = "key-name"
+	flagComment       = "key-comment"
+	flagKDFRounds     = "kdf-rounds"
+	flagRemoteURL     = "remote-url"
+	flagBranch        = "branch"
+	flagMatch         = "match"
+	flagProvider      = "provider"
+	flagProviderHost  = "provider-host"
+	flagHostAlias     = "ssh-host-alias"
+	flagHostName      = "ssh-hostname"
+	flagGitInit       = "git-init"
+	flagInitialBranch = "initial-branch"
+	flagRemote        = "remote"
+	flagRepoLocal     = "repo-local"
+	flagLocalConfig   = "local-config"
+	flagKnownHosts    = "known-hosts"
+	flagHostKeyCheck  = "strict-host-key-checking"
+	flagTest          = "test"
+	flagTestHost      = "test-host"
+	flagImportPubkey  = "import-pubkey"
+	flagOutput        = "output"
+	flagWidth         = "width"
+	flagPathStyle     = "path-style"
+	flagIncludeStyle  = "include-path-style"
+	flagEmailFromGit  = "email-from-git"
+	flagTheme         = "theme"
+	flagKeygenTimeout = "keygen-timeout"
+	flagOnConflict    = "on-conflict"
+	flagOnInclude     = "on-include-conflict"
+	flagRelInclude    = "relative-include"
+	flagKeyOnly       = "key-only"
+	flagSKResident    = "sk-resident"
+	flagSKVerify      = "sk-verify-required"
+	flagTemplate      = "commit-template"
+	flagTemplateText  = "commit-template-text"
+	flagTemplateCfg   = "template-config"
+	flagEditor        = "editor"
+	flagAutoCRLF      = "autocrlf"
+	flagAuth          = "auth"
+	flagAttach        = "attach"
+	flagFormat        = "format"
+	flagGitignore     = "append-to-gitignore"
+	flagDumpConfig    = "dump-config"
+	flagPrintSSHCfg   = "print-ssh-config"
+	flagCredHelper    = "credential-helper"
+	flagFileMode      = "filemode"
+	flagPullRebase    = "pull-rebase"
+	flagFetchPrune    = "fetch-prune"
+	flagDefaultBranch = "default-branch"
+	flagPubkeyOut     = "pubkey-out"
+	flagScope         = "scope"
+	flagLogFile       = "log-file"
+	flagGitdirPat     = "gitdir-pattern"
+	flagHTTPProxy     = "http-proxy"
+	flagHTTPProxyURL  = "http-proxy-url"
+	flagGitProxy      = "git-proxy"
+)
+
+// cliOptions holds run-wide settings that are not part of a single directory context
+type cliOptions struct {
+	NonInteractive bool
+	DryRun         bool
+	AssumeYes      bool
+	NoClipboard    bool
+	AddToAgent     bool
+	ImportPubkey   string // Public key file, or - for stdin, to use instead of generating a key
+	Force          bool   // Set up an identity even where a repository already commits as someone else
+	FromFile       string
+	Output         string
+	KeepOnError    bool
+	GitHubUpload   bool
+	GitHubToken    string
+	NoRemember     bool // Neither prefill the form from nor save to the last-values file
+	ResetDefaults  bool
+	EmailFromGit   bool          // Take a missing username and email from the global git config, also without the form
+	KeygenTimeout  time.Duration // How long ssh-keygen may run; 0 for the default of the key type
+	DumpConfig     bool          // Print the local config and include sections after setup, or instead of it with --dry-run
+	PrintSSHConfig bool          // Print a Host block for the key to paste into an ssh config
+	PubkeyOut      string        // File to write the public key to as well
+	LogFile        string        // File to append the audit trail of the setup to, as JSON lines
+	EnvDefaults    []string      // Flags whose value came from a GITCONFIG_* variable
+}
+
+// newSetupFlagSet defines the flags of the setup command, storing their values
+// in data and opts. It also returns the --sign-* scope flags by name.
+func newSetupFlagSet(data *FormData, opts *cliOptions) (*flag.FlagSet, map[string]*bool) {
+	fs := flag.NewFlagSet(appName, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", appName)
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nEach flag defaults to a %s<FLAG> environment variable, e.g. %sKEY_TYPE for --%s.\n", envPrefix, envPrefix, flagKeyType)
+		fmt.Fprint(fs.Output(), exitCodeHelp)
+	}
+	fs.StringVar(&data.DirectoryName, flagDir, "", "directory to create or use (relative, absolute or ~/ path)")
+	fs.BoolVar(&data.Attach, flagAttach, false, "only attach the identity to an existing directory, e.g. a clone; fail instead of creating a missing one")
+	fs.StringVar(&data.KeyType, flagKeyType, keyTypes[0], "SSH key type ("+strings.Join(keyTypes, ", ")+")")
+	fs.IntVar(&data.ECDSACurve, flagCurve, ecdsaCurves[0], "curve size for ecdsa keys (256, 384, 521)")
+	fs.IntVar(&data.RSABits, flagRSABits, defaultRSABits, "size of rsa keys, a multiple of 8 from 2048 (e.g. 2048, 3072, 4096, 8192)")
+	fs.StringVar(&data.GitUsername, flagUsername, "", "Git username for this context")
+	fs.StringVar(&data.GitEmail, flagEmail, "", "Git email for this context")
+	fs.Func(flagEmails, "comma-separated emails of this context: the first becomes user.email, the others are noted in the local config and trusted as signers", func(s string) error {
+		var err error
+		data.GitEmail, data.AlternateEmails, err = parseEmails(s)
+		return err
+	})
+	fs.StringVar(&data.Auth, flagAuth, authSSH, "how the context authenticates: "+strings.Join(authMethods, ", ")+"; https sets credential.helper instead of generating an SSH key")
+	fs.StringVar(&data.CredentialHelper, flagCredHelper, "", "credential.helper for --auth https, e.g. store or \"cache --timeout=3600\" (default: "+defaultCredentialHelper(hostOS)+"); implies --auth https")
+	fs.StringVar(&data.ExistingKey, flagExisting, "", "reuse this private key (with a matching .pub) instead of generating one")
+	fs.StringVar(&data.SSHDir, flagSSHDir, "", "directory for new keys, created with mode 0700 if missing (default: ~/.ssh)")
+	fs.StringVar(&data.KeyName, flagKeyName, "", "file name of the new key in ~/.ssh (default: <dir>-<uuid>)")
+	fs.StringVar(&data.KeyComment, flagComment, "", "comment stored in the new key (default: <username>@<hostname> (<date>))")
+	fs.IntVar(&data.KDFRounds, flagKDFRounds, 0, "key derivation rounds (ssh-keygen -a) protecting the passphrase of the new key; more resist brute force but unlock slower (default: ssh-keygen's, 16)")
+	addSKOptionFlag(fs, data, flagSKResident, skResident, "store the -sk key on the security key itself (ssh-keygen -O resident), so ssh-keygen -K can restore it on another machine")
+	addSKOptionFlag(fs, data, flagSKVerify, skVerifyRequired, "require the security key's PIN on every use, not just a touch (ssh-keygen -O verify-required)")
+	fs.BoolVar(&data.KeyOnly, flagKeyOnly, false, "only generate a key (and show, copy or upload it); no directory or git config is touched")
+	fs.BoolVar(&data.NativeKeygen, "native", false, "generate the key in-process instead of running ssh-keygen (used automatically when ssh-keygen is missing)")
+	fs.StringVar(&data.RemoteURL, flagRemoteURL, "", "also match repos whose remote URL fits this glob, via includeIf hasconfig:remote.*.url (git 2.36+)")
+	fs.StringVar(&data.Branch, flagBranch, "", "apply the identity only on branches matching this glob (e.g. release/*), via includeIf onbranch (git 2.23+); replaces the directory match, so add --repo-local to limit it to one repository")
+	fs.StringVar(&data.GitdirPattern, flagGitdirPat, "", "write this glob as the includeIf gitdir: condition instead of the directory, e.g. \"~/work/**\" (written as given; git expands ~/ and **)")
+	fs.StringVar(&data.IncludeMatch, flagMatch, "", "when the identity applies: "+strings.Join(includeMatches, ", ")+" (default: gitdir, or both with --remote-url)")
+	fs.StringVar(&data.SSHHostAlias, flagHostAlias, "", "add a Host block with this alias to ~/.ssh/config")
+	fs.StringVar(&data.Provider, flagProvider, providerGitHub, "Git provider the key is for ("+strings.Join(providers, ", ")+")")
+	fs.StringVar(&data.ProviderHost, flagProviderHost, "", "host of a self-hosted provider, required for --provider custom (implied if --provider is not given)")
+	fs.StringVar(&data.SSHHostName, flagHostName, "", "HostName for the ~/.ssh/config entry (default: the provider's host)")
+	fs.BoolVar(&data.GitInit, flagGitInit, false, "run git init in the directory unless it already is a repository")
+	fs.StringVar(&data.InitialBranch, flagInitialBranch, "", "name of the first branch for git init -b (git 2.28+); implies --git-init")
+	fs.StringVar(&data.Remote, flagRemote, "", "add this URL as the origin remote (skipped if origin exists); implies --git-init")
+	fs.BoolVar(&data.AppendToGitignore, flagGitignore, false, "list the key files and local config in the .gitignore of the repository they are inside, if any")
+	fs.StringVar(&data.LocalConfig, flagLocalConfig, "", "file the context's settings are written to and included from, relative to the directory unless absolute or ~/ (default: .gitconfig)")
+	fs.StringVar(&data.TemplateConfig, flagTemplateCfg, "", "git config file with shared defaults (aliases, pull.rebase, ...) the local config starts from; the context's identity and keys are set on top")
+	fs.StringVar(&data.OnConflict, flagOnConflict, "", "what to do when the local config already exists: "+strings.Join(conflictActions, ", ")+" (default: ask with merge preselected, overwrite without a terminal)")
+	fs.StringVar(&data.OnIncludeConflict, flagOnInclude, "", "what to do when the global config already includes another file for the directory: "+strings.Join(includeConflictActions, ", ")+" (default: ask, replace with --yes)")
+	fs.StringVar(&data.CommitTemplate, flagTemplate, "", "set commit.template to this file, relative to the directory unless absolute or ~/; it must exist unless --commit-template-text is given")
+	fs.StringVar(&data.CommitTemplateText, flagTemplateText, "", "create the commit template from this text if it does not exist (default file: "+defaultCommitTemplateName+" in the directory)")
+	fs.StringVar(&data.Editor, flagEditor, "", "set core.editor for this context, e.g. \"code --wait\"")
+	fs.StringVar(&data.AutoCRLF, flagAutoCRLF, "", "set core.autocrlf for this context: "+strings.Join(autoCRLFValues, ", ")+" (default: git's)")
+	fs.StringVar(&data.FileMode, flagFileMode, "", "set core.fileMode for this context: "+strings.Join(fileModeValues, ", ")+" (default: git's)")
+	fs.StringVar(&data.PullRebase, flagPullRebase, "", "set pull.rebase for this context: true, false, "+strings.Join(pullRebaseModes, ", ")+" (default: git's)")
+	fs.StringVar(&data.FetchPrune, flagFetchPrune, "", "set fetch.prune for this context: true or false (default: git's)")
+	fs.StringVar(&data.HTTPProxy, flagHTTPProxy, "", "set http.proxy for this context, e.g. http://proxy.example.com:3128 (HTTP(S) remotes only; ssh ignores it)")
+	fs.StringVar(&data.HTTPProxyURL, flagHTTPProxyURL, "", "limit --http-proxy to remotes below this URL, as http.<url>.proxy, e.g. https://github.com")
+	fs.StringVar(&data.GitProxy, flagGitProxy, "", "set core.gitProxy, the command that connects to git:// remotes, for this context")
+	fs.StringVar(&data.DefaultBranch, flagDefaultBranch, "", "set init.defaultBranch for this context, the first branch of repositories created inside it (default: git's)")
+	fs.BoolVar(&data.RelativeInclude, flagRelInclude, false, "write the includeIf path relative to the global config when both are under the home directory, so the setup survives a moved or synced home")
+	fs.StringVar(&data.Scope, flagScope, "", "where the identity is written: user (a .gitconfig in the directory, included from the global config), repo (the repository's own .git/config) or global-only (the global config, no directory) (default: user)")
+	fs.BoolVar(&data.RepoLocal, flagRepoLocal, false, "when the directory is a repository (or --git-init makes it one), include its .gitconfig from the repository's own config instead of adding an includeIf to the global config")
+	fs.StringVar(&data.KnownHostsFile, flagKnownHosts, "", "keep this directory's host keys in a dedicated known_hosts file, created if missing")
+	fs.StringVar(&data.HostKeyChecking, flagHostKeyCheck, "", "StrictHostKeyChecking for the ssh command: "+strings.Join(hostKeyCheckModes, ", ")+" (default: ssh's own)")
+	fs.BoolVar(&data.TestConnection, flagTest, false, "test the SSH connection to the provider after setup (add the key first)")
+	fs.StringVar(&data.TestHost, flagTestHost, "", "host for --test (default: the --ssh-hostname value)")
+	fs.BoolVar(&data.SignCommits, flagSign, false, "sign with the generated SSH key (commits and tags unless --sign-* flags pick the scope)")
+	fs.StringVar(&data.SignMethod, flagSignMethod, signMethodSSH, "sign with an SSH key or a GPG key ("+strings.Join(signMethods, ", ")+"); implies --sign")
+	fs.StringVar(&data.GPGKey, flagGPGKey, "", "id or fingerprint of the GPG key to sign with (default: the only secret key, or the one for --email); implies --sign-method gpg")
+	fs.StringVar(&data.GPGProgram, flagGPGProgram, "", "gpg binary git signs with, set as gpg.program (default: gpg on the PATH, gpg2 without it, the full path on Windows); implies --sign-method gpg")
+	fs.BoolVar(&data.SeparateSigningKey, flagSeparate, false, "generate a second key for signing instead of signing with the authentication key; implies --sign")
+	fs.StringVar(&data.SigningKey, flagSigningKey, "", "sign with this existing private key (with a matching .pub); implies --separate-signing-key")
+	scopeFlags := map[string]*bool{
+		flagSignCommits: fs.Bool(flagSignCommits, false, "sign commits (commit.gpgsign); implies --sign"),
+		flagSignTags:    fs.Bool(flagSignTags, false, "sign tags (tag.gpgsign); implies --sign"),
+		flagSignPushes:  fs.Bool(flagSignPushes, false, "sign pushes when the server asks (push.gpgsign=if-asked); implies --sign"),
+	}
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print the planned changes without touching the filesystem")
+	fs.BoolVar(&opts.DumpConfig, flagDumpConfig, false, "print the local .gitconfig and the includeIf sections as written (or, with --dry-run, as they would be)")
+	fs.BoolVar(&opts.PrintSSHConfig, flagPrintSSHCfg, false, "print a ready-to-paste ~/.ssh/config Host block for the key to stdout (writes nothing; see --ssh-host-alias for that)")
+	fs.BoolVar(&opts.AssumeYes, "yes", false, "skip the summary confirmation after the form")
+	fs.BoolVar(&opts.NoClipboard, "no-clipboard", false, "do not copy the public key to the clipboard")
+	fs.BoolVar(&opts.AddToAgent, "add-to-agent", false, "load the key into the running ssh-agent with ssh-add (and the keychain on macOS)")
+	fs.StringVar(&opts.PubkeyOut, flagPubkeyOut, "", "also write the public key to this file, creating its directory, e.g. for configuration management")
+	fs.StringVar(&opts.LogFile, flagLogFile, "", "append every setup action (steps, commands, changes, errors) to this file as JSON lines, for audits; never logs secrets")
+	fs.StringVar(&opts.ImportPubkey, flagImportPubkey, "", "use this public key file (- for stdin) instead of generating one; only shows, copies and uploads it unless --existing-key names its private key")
+	fs.StringVar(&opts.FromFile, "from-file", "", "set up every context listed in this YAML or JSON file")
+	fs.BoolVar(&opts.GitHubUpload, "github-upload", false, "add the public key to your GitHub account (token from --github-token or GITHUB_TOKEN)")
+	fs.StringVar(&opts.GitHubToken, "github-token", "", "GitHub token with the admin:public_key scope; implies --github-upload")
+	fs.BoolVar(&opts.Force, "force", false, "set up the identity even if the directory is in a repository that commits with another email")
+	fs.BoolVar(&opts.KeepOnError, "keep-on-error", false, "leave partial changes in place when setup fails instead of undoing them")
+	fs.BoolVar(&opts.NoRemember, "no-remember", false, "do not prefill the form with the last values used, nor remember this run's")
+	fs.BoolVar(&opts.ResetDefaults, "reset-defaults", false, "forget the remembered form values")
+	fs.BoolVar(&opts.EmailFromGit, flagEmailFromGit, false, "use user.name and user.email of the global git config when --username or --email is not given, also with --non-interactive (the form always offers them)")
+	fs.DurationVar(&opts.KeygenTimeout, flagKeygenTimeout, 0, "give up on ssh-keygen after this long, e.g. 30s or 10m (default: 2m; no limit for -sk keys, which wait for a touch)")
+	fs.BoolVar(&opts.NonInteractive, "non-interactive", false, "never prompt; fail if required flags are missing")
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	addNoBorderFlag(fs)
+	addHomeFlag(fs)
+	addVerbosityFlag(fs, "quiet", "print only errors and the public key", levelQuiet)
+	addVerbosityFlag(fs, "verbose", "print each step, the ssh-keygen arguments and every config key written", levelVerbose)
+	fs.StringVar(&pathStyle, flagPathStyle, pathStyle, "how key paths (core.sshCommand, user.signingkey, IdentityFile) are written on Windows: "+strings.Join(pathStyles, ", ")+" (default detected from the environment)")
+	fs.StringVar(&includePathStyle, flagIncludeStyle, includePathStyle, "how includeIf conditions and include paths are written on Windows: "+strings.Join(includePathStyles, ", ")+" (default detected from the environment)")
+	fs.IntVar(&widthOverride, flagWidth, 0, "width of the output box (default: fit the terminal, 80 when not a terminal)")
+	fs.StringVar(&opts.Output, flagOutput, outputText, "output format ("+strings.Join(outputFormats, ", ")+")")
+	return fs, scopeFlags
+}
+
+// parseFlags parses the command line into FormData and run options.
+// The returned set records which flags were passed explicitly, so callers can
+// tell a flag that was not given apart from one set to its zero value.
+func parseFlags(args []string) (FormData, cliOptions, map[string]bool, error) {
+	var data FormData
+	var opts cliOptions
+
+	fs, scopeFlags := newSetupFlagSet(&data, &opts)
+	if err := fs.Parse(args); err != nil {
+		return data, opts, nil, err
+	}
+	if fs.NArg() > 0 {
+		return data, opts, nil, fmt.Errorf("unexpected argument '%s'", fs.Arg(0))
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["quiet"] && set["verbose"] {
+		return data, opts, nil, fmt.Errorf("--quiet and --verbose cannot be combined")
+	}
+
+	// GITCONFIG_* variables fill in what the flags leave out. They count as
+	// given below, but not for the form, which still asks with their values.
+	fromEnv, err := applyEnvDefaults(fs, set)
+	if err != nil {
+		return data, opts, nil, err
+	}
+	opts.EnvDefaults = slices.Sorted(maps.Keys(fromEnv))
+	for name := range fromEnv {
+		set[name] = true
+	}
+
+	// --emails replaces --email, so the form does not ask for it either
+	if set[flagEmails] {
+		if set[flagEmail] {
+			return data, opts, nil, fmt.Errorf("--%s and --%s cannot be combined; put the primary email first in --%s", flagEmail, flagEmails, flagEmails)
+		}
+		set[flagEmail] = true
+	}
+
+	// A size picks the key type it belongs to, and is rejected for any other
+	for name, size := range keySizes {
+		if !set[size.flag] {
+			continue
+		}
+		if !set[flagKeyType] {
+			data.KeyType = name
+			set[flagKeyType] = true
+		} else if data.KeyType != name {
+			return data, opts, nil, fmt.Errorf("--%s only applies to --%s %s, not %s", size.flag, flagKeyType, name, data.KeyType)
+		}
+	}
+
+	// Validate explicitly passed values with the same rules the form uses
+	validators := []struct {
+		name     string
+		validate func() error
+	}{
+		{flagDir, func() error { return validateDirectoryName(data.DirectoryName) }},
+		{flagKeyType, func() error { return validateKeyType(data.KeyType) }},
+		{flagCurve, func() error { return validateECDSACurve(data.ECDSACurve) }},
+		{flagRSABits, func() error { return validateRSABits(data.RSABits) }},
+		{flagSSHDir, func() error { return validateSSHDir(data.SSHDir) }},
+		{flagKeyName, func() error { return validateKeyName(data.KeyName, data.SSHDir) }},
+		{flagComment, func() error { return validateKeyComment(data.KeyComment) }},
+		{flagKDFRounds, func() error { return validateKDFRounds(data.KDFRounds) }},
+		{flagExisting, func() error { return validateExistingKey(data.ExistingKey) }},
+		{flagSigningKey, func() error { return validateExistingKey(data.SigningKey) }},
+		{flagSignMethod, func() error { return validateSignMethod(data.SignMethod) }},
+		{flagGPGProgram, func() error { return validateGPGProgram(data.GPGProgram) }},
+		{flagGPGKey, func() error { return validateGPGKey(data.GPGProgram, data.GPGKey) }},
+		{flagRemoteURL, func() error { return validateRemoteURL(data.RemoteURL) }},
+		{flagMatch, func() error { return validateIncludeMatch(data.IncludeMatch, data.RemoteURL) }},
+		{flagBranch, func() error { return validateBranchMatch(data) }},
+		{flagGitdirPat, func() error { return validateGitdirMatch(data) }},
+		{flagProvider, func() error { return validateProvider(data.Provider) }},
+		{flagProviderHost, func() error { return validateSSHHost(data.ProviderHost) }},
+		{flagHostAlias, func() error { return validateSSHHost(data.SSHHostAlias) }},
+		{flagHostName, func() error { return validateSSHHost(data.SSHHostName) }},
+		{flagTestHost, func() error { return validateSSHHost(data.TestHost) }},
+		{flagHostKeyCheck, func() error { return validateHostKeyCheck(data.HostKeyChecking) }},
+		{flagInitialBranch, func() error { return validateBranchName(data.InitialBranch) }},
+		{flagRemote, func() error { return validateGitRemote(data.Remote) }},
+		{flagLocalConfig, func() error { return validateLocalConfig(data.LocalConfig) }},
+		{flagTemplateCfg, func() error { return validateTemplateConfig(data.TemplateConfig) }},
+		{flagOnConflict, func() error { return validateOnConflict(data.OnConflict) }},
+		{flagOnInclude, func() error { return validateOnIncludeConflict(data.OnIncludeConflict) }},
+		{flagTemplate, func() error { return validateCommitTemplate(data.CommitTemplate) }},
+		{flagEditor, func() error { return validateEditor(data.Editor) }},
+		{flagAutoCRLF, func() error { return validateAutoCRLF(data.AutoCRLF) }},
+		{flagFileMode, func() error { return validateFileMode(data.FileMode) }},
+		{flagScope, func() error { return validateScope(data.Scope) }},
+		{flagPullRebase, func() error { return validatePullRebase(data.PullRebase) }},
+		{flagFetchPrune, func() error { return validateFetchPrune(data.FetchPrune) }},
+		{flagDefaultBranch, func() error { return validateBranchName(data.DefaultBranch) }},
+		{flagHTTPProxy, func() error { return validateHTTPProxy(data.HTTPProxy) }},
+		{flagHTTPProxyURL, func() error {
+			if data.HTTPProxy == "" {
+				return fmt.Errorf("it only applies with --%s", flagHTTPProxy)
+			}
+			return validateProxyURL(data.HTTPProxyURL)
+		}},
+		{flagGitProxy, func() error { return validateGitProxy(data.GitProxy) }},
+		{flagAuth, func() error { return validateAuthMethod(data.Auth) }},
+		{flagCredHelper, func() error { return validateCredentialHelper(data.CredentialHelper) }},
+		{flagUsername, func() error { return validateUsername(data.GitUsername) }},
+		{flagEmail, func() error { return validateEmail(data.GitEmail) }},
+		{flagOutput, func() error { return validateOutputFormat(opts.Output) }},
+		{flagWidth, func() error { return validateBoxWidth(widthOverride) }},
+		{flagPathStyle, func() error { return validatePathStyle(pathStyle) }},
+		{flagIncludeStyle, func() error { return validateIncludePathStyle(includePathStyle) }},
+		{flagKeygenTimeout, func() error { return validateKeygenTimeout(opts.KeygenTimeout) }},
+	}
+	for _, v := range validators {
+		if !set[v.name] {
+			continue
+		}
+		if err := v.validate(); err != nil {
+			if env := fromEnv[v.name]; env != "" {
+				return data, opts, nil, fmt.Errorf("invalid %s: %w", env, err)
+			}
+			return data, opts, nil, fmt.Errorf("invalid --%s: %w", v.name, err)
+		}
+	}
+
+	// Any --sign-* flag replaces the default scopes with exactly the chosen ones
+	if set[flagSignCommits] || set[flagSignTags] || set[flagSignPushes] {
+		for _, scope := range signScopes {
+			if *scopeFlags["sign-"+scope] {
+				data.SignScopes = append(data.SignScopes, scope)
+			}
+		}
+		if len(data.SignScopes) == 0 {
+			return data, opts, nil, fmt.Errorf("the --sign-* flags leave nothing to sign; enable at least one of them")
+		}
+		data.SignCommits = true
+		set[flagSign] = true
+	}
+
+	if err := resolveFormPaths(&data); err != nil {
+		return data, opts, nil, err
+	}
+	if data.SigningKey != "" {
+		data.SeparateSigningKey = true
+		set[flagSeparate] = true
+	}
+	if data.SeparateSigningKey {
+		data.SignCommits = true
+		set[flagSign] = true
+	}
+	if data.GPGProgram != "" {
+		if set[flagSignMethod] && data.SignMethod != signMethodGPG {
+			return data, opts, nil, fmt.Errorf("--%s needs --%s %s", flagGPGProgram, flagSignMethod, signMethodGPG)
+		}
+		data.SignMethod = signMethodGPG
+		set[flagSignMethod] = true
+	}
+	if data.GPGKey != "" {
+		if set[flagSignMethod] && data.SignMethod != signMethodGPG {
+			return data, opts, nil, fmt.Errorf("--%s needs --%s %s", flagGPGKey, flagSignMethod, signMethodGPG)
+		}
+		data.SignMethod = signMethodGPG
+		set[flagSignMethod] = true
+	}
+	if set[flagSignMethod] {
+		data.SignCommits = true
+		set[flagSign] = true
+	}
+	if data.SignMethod == signMethodGPG && data.SeparateSigningKey {
+		return data, opts, nil, fmt.Errorf("--%s and --%s only apply to SSH signing", flagSeparate, flagSigningKey)
+	}
+
+	// HTTPS contexts have no SSH key, so they can only sign with GPG
+	if data.CredentialHelper != "" {
+		if set[flagAuth] && data.Auth != authHTTPS {
+			return data, opts, nil, fmt.Errorf("--%s needs --%s %s", flagCredHelper, flagAuth, authHTTPS)
+		}
+		data.Auth = authHTTPS
+		set[flagAuth] = true
+	}
+	if usesHTTPS(data) {
+		for _, name := range httpsConflicts {
+			if set[name] {
+				return data, opts, nil, fmt.Errorf("--%s only applies to SSH, not --%s %s", name, flagAuth, authHTTPS)
+			}
+		}
+		if set[flagSignMethod] && data.SignMethod != signMethodGPG {
+			return data, opts, nil, fmt.Errorf("--%s %s has no SSH key to sign with; use --%s %s", flagAuth, authHTTPS, flagSignMethod, signMethodGPG)
+		}
+		data.SignMethod = signMethodGPG
+	}
+
+	if set[flagProviderHost] && !set[flagProvider] {
+		data.Provider = providerCustom
+		set[flagProvider] = true
+	}
+
+	// Without --key-type, new keys follow the provider's recommendation
+	if !set[flagKeyType] {
+		data.KeyType = recommendedKeyType(data.Provider)
+	}
+
+	if data.InitialBranch != "" || data.Remote != "" {
+		data.GitInit = true
+		set[flagGitInit] = true
+	}
+
+	// Without --key-type the form may still pick an -sk type
+	if len(data.SKOptions) > 0 && (set[flagKeyType] || opts.NonInteractive) {
+		if err := validateSKOptions(data); err != nil {
+			return data, opts, nil, err
+		}
+	}
+
+	for _, name := range scopeConflicts[data.Scope] {
+		if set[name] {
+			return data, opts, nil, fmt.Errorf("--%s does not apply to --%s %s", name, flagScope, data.Scope)
+		}
+	}
+
+	if data.KeyOnly {
+		for _, name := range keyOnlyConflicts {
+			if set[name] {
+				return data, opts, nil, fmt.Errorf("--%s only affects the git config, which --%s does not write", name, flagKeyOnly)
+			}
+		}
+		if opts.ImportPubkey != "" || opts.FromFile != "" {
+			return data, opts, nil, fmt.Errorf("--%s cannot be combined with --%s or --from-file", flagKeyOnly, flagImportPubkey)
+		}
+	}
+
+	if opts.ImportPubkey != "" && opts.FromFile != "" {
+		return data, opts, nil, fmt.Errorf("--%s cannot be combined with --from-file", flagImportPubkey)
+	}
+	if opts.ImportPubkey != "" && opts.ImportPubkey != importStdin {
+		absPath, err := resolveTargetDir(opts.ImportPubkey)
+		if err != nil {
+			return data, opts, nil, err
+		}
+		opts.ImportPubkey = absPath
+	}
+
+	if opts.PubkeyOut != "" {
+		if opts.FromFile != "" {
+			return data, opts, nil, fmt.Errorf("--%s cannot be combined with --from-file, as every context would write the same file", flagPubkeyOut)
+		}
+		absPath, err := resolveTargetDir(opts.PubkeyOut)
+		if err != nil {
+			return data, opts, nil, err
+		}
+		opts.PubkeyOut = absPath
+	}
+
+	if opts.LogFile != "" {
+		absPath, err := resolveTargetDir(opts.LogFile)
+		if err != nil {
+			return data, opts, nil, err
+		}
+		opts.LogFile = absPath
+	}
+
+	if opts.GitHubToken != "" {
+		opts.GitHubUpload = true
+	}
+	if opts.GitHubUpload && set[flagProvider] && data.Provider != providerGitHub {
+		return data, opts, nil, fmt.Errorf("--github-upload only works with --provider %s", providerGitHub)
+	}
+	if opts.GitHubUpload && githubToken(opts) == "" {
+		return data, opts, nil, fmt.Errorf("--github-upload needs a token: pass --github-token or set GITHUB_TOKEN")
+	}
+
+	for name := range fromEnv {
+		delete(set, name)
+	}
+	return data, opts, set, nil
+}
+
+// resolveFormPaths makes the key and key directory paths in data absolute
+// (expanding ~), since they end up in config files read from other directories
+func resolveFormPaths(data *FormData) error {
+	for _, path := range []*string{&data.ExistingKey, &data.SigningKey, &data.SSHDir, &data.KnownHostsFile} {
+		if *path == "" {
+			continue
+		}
+		absPath, err := resolveTargetDir(*path)
+		if err != nil {
+			return err
+		}
+		*path = absPath
+	}
+	return nil
+}
+
+// missingRequiredFlags returns the required flags that have no value in data
+func missingRequiredFlags(data FormData) []string {
+	missing := []string{}
+	if data.DirectoryName == "" && !data.KeyOnly && data.Scope != scopeGlobalOnly {
+		missing = append(missing, "--"+flagDir)
+	}
+	if data.GitUsername == "" && !data.KeyOnly {
+		missing = append(missing, "--"+flagUsername)
+	}
+	if data.GitEmail == "" && !data.KeyOnly {
+		missing = append(missing, "--"+flagEmail)
+	}
+	if data.Provider == providerCustom && data.ProviderHost == "" {
+		missing = append(missing, "--"+flagProviderHost)
+	}
+	return missing
+}
+
+// addSKOptionFlag registers a boolean flag that adds the security key option
+// to data.SKOptions
+func addSKOptionFlag(fs *flag.FlagSet, data *FormData, name, option, usage string) {
+	fs.BoolFunc(name, usage, func(s string) error {
+		on, err := strconv.ParseBool(s)
+		if err == nil && on && !slices.Contains(data.SKOptions, option) {
+			data.SKOptions = append(data.SKOptions, option)
+		}
+		return err
+	})
+}
+
+// addVerbosityFlag registers a boolean flag that sets the verbosity to level;
+// turning it off with =false goes back to the normal level
+func addVerbosityFlag(fs *flag.FlagSet, name, usage string, level int) {
+	fs.BoolFunc(name, usage, func(s string) error {
+		on, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		if on {
+			verbosity = level
+		} else if verbosity == level {
+			verbosity = levelNormal
+		}
+		return nil
+	})
+}
+
+// addNoColorFlag registers --no-color on fs; it takes effect as soon as it is parsed
+func addNoColorFlag(fs *flag.FlagSet) {
+	fs.BoolFunc("no-color", "disable colors and draw borders with ASCII characters (also set by NO_COLOR)", func(s string) error {
+		off, err := strconv.ParseBool(s)
+		if err == nil && off {
+			setColor(false)
+		}
+		return err
+	})
+}
+
+// addThemeFlag registers --theme on fs; like --no-color it takes effect as
+// soon as it is parsed, and never turns color back on
+func addThemeFlag(fs *flag.FlagSet) {
+	fs.Func(flagTheme, "colors of the output and forms: "+strings.Join(themeNames, ", ")+" (default "+themeCharm+")", func(s string) error {
+		if err := validateTheme(s); err != nil {
+			return err
+		}
+		themeName = s
+		setColor(colorEnabled)
+		return nil
+	})
+}
+
+// addNoBorderFlag registers --no-border on fs
+func addNoBorderFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&noBorder, "no-border", false, "print messages without the box, wrapped on spaces (also used in terminals narrower than "+strconv.Itoa(minBorderColumns)+" columns)")
+}
+
+// parseInterspersed parses args with fs while allowing flags to follow
+// positional arguments (the flag package stops at the first non-flag).
+// It returns the positional arguments in order.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, usageError(err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -0,0 +1,862 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+)
+
+// runForm prompts for every value not already provided via flags
+// (set holds the names of the flags that were passed) and stores the answers in data.
+func runForm(data *FormData, set map[string]bool) error {
+	// --key-only only asks about the key itself
+	ask := func(name string) bool {
+		return !set[name] && (!data.KeyOnly || slices.Contains(keyOnlyFormFlags, name)) &&
+			!slices.Contains(scopeConflicts[data.Scope], name)
+	}
+
+	// HTTPS contexts skip every question about the SSH key
+	if data.Auth == "" {
+		data.Auth = authSSH
+	}
+	https := func() bool { return usesHTTPS(*data) }
+
+	groups := []*huh.Group{}
+	if ask(flagAuth) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Authentication").
+				Description("How git talks to your provider; use HTTPS where a firewall blocks SSH").
+				Options(
+					huh.NewOption("SSH key", authSSH),
+					huh.NewOption("HTTPS with a credential helper", authHTTPS),
+				).
+				Value(&data.Auth),
+		))
+	}
+	if ask(flagCredHelper) {
+		if data.CredentialHelper == "" {
+			data.CredentialHelper = defaultCredentialHelper(hostOS)
+		}
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title("Credential Helper").
+				Description("credential.helper for this context, e.g. store (plain text file), cache --timeout=3600 or osxkeychain").
+				Value(&data.CredentialHelper).
+				Validate(validateCredentialHelper),
+		).WithHideFunc(func() bool { return !https() }))
+	}
+
+	fields := []huh.Field{}
+
+	if ask(flagDir) {
+		fields = append(fields, huh.NewInput().
+			Title("Directory Name").
+			Description("Enter the directory to create or use: a name relative to the current directory, an absolute path or a ~/ path").
+			Placeholder("projects").
+			Value(&data.DirectoryName).
+			Validate(func(s string) error {
+				if err := validateDirectoryName(s); err != nil || !data.Attach {
+					return err
+				}
+				absPath, err := resolveTargetDir(s)
+				if err != nil {
+					return err
+				}
+				return checkAttachDir(absPath)
+			}))
+	}
+
+	if ask(flagUsername) {
+		fields = append(fields, huh.NewInput().
+			Title("Git Username").
+			Description("Enter the Git username for this context").
+			Placeholder("username").
+			Value(&data.GitUsername).
+			Validate(validateUsername))
+	}
+
+	if ask(flagEmail) {
+		fields = append(fields, huh.NewInput().
+			Title("Git Email").
+			Description("Enter the Git email for this context").
+			Placeholder("user@example.com").
+			Value(&data.GitEmail).
+			Validate(validateEmail))
+	}
+
+	if ask(flagSign) {
+		fields = append(fields, huh.NewConfirm().
+			Title("Sign Commits?").
+			Description("Sign Git commits with this SSH key (Requires Git 2.34+) or a GPG key?").
+			Value(&data.SignCommits))
+	}
+
+	if len(fields) > 0 {
+		groups = append(groups, huh.NewGroup(fields...))
+	}
+
+	// What to sign only matters once signing is on
+	if len(data.SignScopes) == 0 {
+		data.SignScopes = append([]string(nil), defaultSignScopes...)
+	}
+	if ask(flagSignCommits) && ask(flagSignTags) && ask(flagSignPushes) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title("What to Sign").
+				Description("Pushes are only signed when the server asks for it (many hosts, GitHub included, don't)").
+				Options(huh.NewOptions(signScopes...)...).
+				Value(&data.SignScopes).
+				Validate(func(scopes []string) error {
+					if len(scopes) == 0 {
+						return fmt.Errorf("select at least one, or go back and turn signing off")
+					}
+					return nil
+				}),
+		).WithHideFunc(func() bool { return !data.SignCommits }))
+	}
+
+	// GPG signing uses a key already in the keyring instead of an SSH key
+	if data.SignMethod == "" {
+		data.SignMethod = signMethodSSH
+	}
+	if ask(flagSignMethod) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Signing Method").
+				Description("Sign with an SSH key, or with a GPG key you already have").
+				Options(
+					huh.NewOption("SSH key (Git 2.34+)", signMethodSSH),
+					huh.NewOption("GPG key (OpenPGP)", signMethodGPG),
+				).
+				Value(&data.SignMethod),
+		).WithHideFunc(func() bool { return !data.SignCommits || https() }))
+	}
+	if ask(flagGPGKey) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("GPG Key").
+				Description("The secret key to sign with (from gpg --list-secret-keys)").
+				OptionsFunc(func() []huh.Option[string] { return gpgKeyOptions(data.GPGProgram) }, &data.SignMethod).
+				Value(&data.GPGKey).
+				Validate(func(s string) error {
+					if s == "" {
+						return fmt.Errorf("gpg has no secret keys; create one with gpg --full-generate-key or go back and sign with SSH")
+					}
+					return nil
+				}),
+		).WithHideFunc(func() bool { return !data.SignCommits || (data.SignMethod != signMethodGPG && !https()) }))
+	}
+
+	// A separate signing key is either generated next to the auth key or picked from ~/.ssh
+	if ask(flagSeparate) {
+		signingKeyOptions := append([]huh.Option[string]{huh.NewOption("Generate a new signing key", "")}, existingKeyOptions()...)
+		groups = append(groups,
+			huh.NewGroup(
+				huh.NewConfirm().
+					Title("Use a Separate Signing Key?").
+					Description("Sign with a different key than the one used to authenticate").
+					Value(&data.SeparateSigningKey),
+			).WithHideFunc(func() bool { return !signsWithSSH(*data) || https() }),
+			huh.NewGroup(
+				huh.NewSelect[string]().
+					Title("Signing Key").
+					Description("Generate a new key or pick an existing one").
+					Options(signingKeyOptions...).
+					Value(&data.SigningKey),
+			).WithHideFunc(func() bool { return !signsWithSSH(*data) || !data.SeparateSigningKey || https() }),
+		)
+	}
+
+	// The provider decides the default host, where the key has to be added
+	// and which key type is recommended, so it is asked before the key
+	if data.Provider == "" {
+		data.Provider = providerGitHub
+	}
+	if ask(flagProvider) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Git Provider").
+				Description("Where the key will be used; pick Custom for a self-hosted or other host").
+				Options(
+					huh.NewOption("GitHub", providerGitHub),
+					huh.NewOption("GitLab", providerGitLab),
+					huh.NewOption("Bitbucket", providerBitbucket),
+					huh.NewOption("Gitea", providerGitea),
+					huh.NewOption("Custom", providerCustom),
+				).
+				Value(&data.Provider),
+		))
+	}
+	if ask(flagProviderHost) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title("Provider Host").
+				DescriptionFunc(func() string {
+					if data.Provider == providerCustom {
+						return "Host name of your Git server"
+					}
+					return "Host name of your self-hosted instance (leave empty for " + providerInfos[data.Provider].Host + ")"
+				}, &data.Provider).
+				Placeholder("git.example.com").
+				Value(&data.ProviderHost).
+				Validate(func(s string) error {
+					if s == "" && data.Provider != providerCustom {
+						return nil
+					}
+					return validateSSHHost(s)
+				}),
+		).WithHideFunc(func() bool { return !providerSelfHostable(data.Provider) }))
+	}
+
+	// Offer to reuse one of the keys already in ~/.ssh
+	useExisting := data.ExistingKey != ""
+	selectedKey := data.ExistingKey
+	if ask(flagExisting) {
+		if keyOptions := existingKeyOptions(); len(keyOptions) > 0 {
+			groups = append(groups,
+				huh.NewGroup(
+					huh.NewConfirm().
+						Title("Use an Existing SSH Key?").
+						Description("Reuse a key from your .ssh directory instead of generating a new one").
+						Value(&useExisting),
+				).WithHideFunc(https),
+				huh.NewGroup(
+					huh.NewSelect[string]().
+						Title("Existing SSH Key").
+						Description("Pick the private key to use (fingerprints shown to help you confirm)").
+						Options(keyOptions...).
+						Value(&selectedKey),
+				).WithHideFunc(func() bool { return !useExisting || https() }),
+			)
+		}
+	}
+
+	// Key generation settings are irrelevant when reusing a key
+	keyFields := []huh.Field{}
+	if ask(flagKeyType) {
+		recommended := recommendedKeyType(data.Provider)
+		keyFields = append(keyFields, huh.NewSelect[string]().
+			Title("SSH Key Type").
+			Description("Select the SSH key type (-sk types need a hardware security key)").
+			OptionsFunc(func() []huh.Option[string] {
+				// Follow the provider's recommendation until another type is picked
+				if data.KeyType == recommended {
+					data.KeyType = recommendedKeyType(data.Provider)
+				}
+				recommended = recommendedKeyType(data.Provider)
+				return keyTypeOptions(*data)
+			}, &data.Provider).
+			Value(&data.KeyType))
+	}
+
+	if ask(flagKeyName) {
+		keyFields = append(keyFields, huh.NewInput().
+			Title("Key Name").
+			Description("File name for the key in your .ssh directory (leave empty for <directory>-<uuid>)").
+			Placeholder("github-work").
+			Value(&data.KeyName).
+			Validate(func(s string) error {
+				if s == "" {
+					return nil
+				}
+				return validateKeyName(s, data.SSHDir)
+			}))
+	}
+	if ask(flagComment) {
+		keyFields = append(keyFields, huh.NewInput().
+			Title("Key Comment").
+			Description("Comment stored in the public key (leave empty for <username>@<hostname> (<date>))").
+			Value(&data.KeyComment).
+			Validate(validateKeyComment))
+	}
+
+	// The passphrase is never taken from flags so it doesn't end up in shell history
+	var passphraseConfirm string
+	keyFields = append(keyFields,
+		huh.NewInput().
+			Title("Key Passphrase").
+			Description("Protect the private key with a passphrase (leave empty for none)").
+			EchoMode(huh.EchoModePassword).
+			Value(&data.Passphrase),
+		huh.NewInput().
+			Title("Confirm Passphrase").
+			Description("Enter the passphrase again").
+			EchoMode(huh.EchoModePassword).
+			Value(&passphraseConfirm).
+			Validate(func(s string) error {
+				if s != data.Passphrase {
+					return fmt.Errorf("passphrases do not match")
+				}
+				return nil
+			}),
+	)
+	groups = append(groups, huh.NewGroup(keyFields...).WithHideFunc(func() bool { return useExisting || https() }))
+
+	// Extra rounds only protect a passphrase, so they are only asked for with one
+	kdfRounds := ""
+	if data.KDFRounds > 0 {
+		kdfRounds = strconv.Itoa(data.KDFRounds)
+	}
+	if ask(flagKDFRounds) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title("KDF Rounds").
+				Description("Key derivation rounds protecting the passphrase (ssh-keygen -a); more resist brute force but unlock slower. Leave empty for the default (16)").
+				Placeholder("100").
+				Value(&kdfRounds).
+				Validate(func(s string) error {
+					if s == "" {
+						return nil
+					}
+					rounds, err := strconv.Atoi(s)
+					if err != nil {
+						return fmt.Errorf("KDF rounds must be a positive number, e.g. 100")
+					}
+					return validateKDFRounds(rounds)
+				}),
+		).WithHideFunc(func() bool { return useExisting || https() || data.Passphrase == "" }))
+	}
+
+	// The curve is only relevant for ecdsa keys, so it lives in its own group
+	// that is hidden for every other key type
+	if ask(flagCurve) {
+		curveOptions := make([]huh.Option[int], 0, len(ecdsaCurves))
+		for _, bits := range ecdsaCurves {
+			curveOptions = append(curveOptions, huh.NewOption(fmt.Sprintf("P-%d", bits), bits))
+		}
+		groups = append(groups, huh.NewGroup(
+			huh.NewSelect[int]().
+				Title("ECDSA Curve").
+				Description("Select the curve size for the ecdsa key (256 is widely supported)").
+				Options(curveOptions...).
+				Value(&data.ECDSACurve),
+		).WithHideFunc(func() bool { return useExisting || https() || data.KeyType != "ecdsa" }))
+	}
+
+	// Likewise the size only matters for rsa keys
+	if ask(flagRSABits) {
+		sizeOptions := make([]huh.Option[int], 0, len(rsaKeySizes))
+		for _, bits := range rsaKeySizes {
+			sizeOptions = append(sizeOptions, huh.NewOption(fmt.Sprintf("%d bits", bits), bits))
+		}
+		// A remembered size outside the list would leave nothing selected
+		if !slices.Contains(rsaKeySizes, data.RSABits) {
+			sizeOptions = append(sizeOptions, huh.NewOption(fmt.Sprintf("%d bits", data.RSABits), data.RSABits))
+		}
+		groups = append(groups, huh.NewGroup(
+			huh.NewSelect[int]().
+				Title("RSA Key Size").
+				Description("Select the size of the rsa key (4096 recommended; 2048 for old hosts and some CI systems)").
+				Options(sizeOptions...).
+				Value(&data.RSABits),
+		).WithHideFunc(func() bool { return useExisting || https() || data.KeyType != "rsa" }))
+	}
+
+	// Security key options only apply to the -sk key types
+	if ask(flagSKResident) && ask(flagSKVerify) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title("Security Key Options").
+				Description("resident stores the key on the token so ssh-keygen -K can restore it; verify-required asks for the PIN on every use").
+				Options(huh.NewOptions(skOptions...)...).
+				Value(&data.SKOptions),
+		).WithHideFunc(func() bool { return useExisting || https() || !isSecurityKeyType(data.KeyType) }))
+	}
+
+	// Matching by remote URL is optional; the directory match stays the default
+	// A branch match replaces the directory and remote matches
+	if ask(flagRemoteURL) && !set[flagBranch] {
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title("Remote URL Pattern").
+				Description("Also apply this identity to repos whose remote matches, wherever they live (e.g. git@github.com:my-org/**). Leave empty to match by directory only. Requires Git 2.36+").
+				Value(&data.RemoteURL).
+				Validate(func(s string) error {
+					if s == "" {
+						return nil
+					}
+					return validateRemoteURL(s)
+				}),
+		))
+	}
+	if ask(flagMatch) && !set[flagBranch] {
+		groups = append(groups, huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Apply the Identity When").
+				Options(
+					huh.NewOption("The repo is inside the directory or its remote matches", matchBoth),
+					huh.NewOption("The repo's remote matches", matchRemote),
+					huh.NewOption("The repo is inside the directory", matchGitdir),
+				).
+				Value(&data.IncludeMatch),
+		).WithHideFunc(func() bool { return data.RemoteURL == "" }))
+	}
+	if ask(flagBranch) && !set[flagRemoteURL] && !set[flagMatch] {
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title("Branch Pattern").
+				Description("Only apply this identity on branches matching this glob (e.g. release/*), in every repository unless it is included from the repository's own config. Leave empty to match by directory. Requires Git 2.23+").
+				Value(&data.Branch).
+				Validate(func(s string) error {
+					if s == "" {
+						return nil
+					}
+					return validateBranchPattern(s)
+				}),
+		).WithHideFunc(func() bool { return data.RemoteURL != "" }))
+	}
+
+	// Optional ~/.ssh/config Host block
+	addHostAlias := data.SSHHostAlias != ""
+	if ask(flagHostAlias) {
+		groups = append(groups,
+			huh.NewGroup(
+				huh.NewConfirm().
+					Title("Add an SSH Host Alias?").
+					Description("Append a Host block for this key to ~/.ssh/config").
+					Value(&addHostAlias),
+			).WithHideFunc(https),
+			huh.NewGroup(
+				huh.NewInput().
+					Title("Host Alias").
+					Description("Name to use in remote URLs instead of the real host (e.g., github-work)").
+					Placeholder("github-work").
+					Value(&data.SSHHostAlias).
+					Validate(validateSSHHost),
+				huh.NewInput().
+					Title("Host Name").
+					Description("The real host the alias points to (leave empty for the provider's host)").
+					PlaceholderFunc(func() string { return providerHost(*data) }, []any{&data.Provider, &data.ProviderHost}).
+					Value(&data.SSHHostName).
+					Validate(func(s string) error {
+						if s == "" {
+							return nil
+						}
+						return validateSSHHost(s)
+					}),
+			).WithHideFunc(func() bool { return !addHostAlias || https() }),
+		)
+	}
+
+	if ask(flagGitInit) {
+		groups = append(groups,
+			huh.NewGroup(
+				huh.NewConfirm().
+					Title("Initialize a Git Repository?").
+					Description("Run git init in the directory so the identity applies right away (skipped if it already is a repository)").
+					Value(&data.GitInit),
+			),
+		)
+	}
+	if ask(flagInitialBranch) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title("Initial Branch").
+				Description("Name of the first branch (leave empty for git's default). Requires Git 2.28+").
+				Placeholder("main").
+				Value(&data.InitialBranch).
+				Validate(func(s string) error {
+					if s == "" {
+						return nil
+					}
+					return validateBranchName(s)
+				}),
+		).WithHideFunc(func() bool { return !data.GitInit }))
+	}
+	if ask(flagRemote) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title("Origin Remote URL").
+				Description("Add this URL as the origin remote (leave empty to skip). Use the host alias in SSH URLs if you added one").
+				Placeholder("git@github.com:owner/repo.git").
+				Value(&data.Remote).
+				Validate(func(s string) error {
+					if s == "" {
+						return nil
+					}
+					return validateGitRemote(s)
+				}),
+		).WithHideFunc(func() bool { return !data.GitInit }))
+	}
+
+	if ask(flagRepoLocal) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewConfirm().
+				Title("Include From the Repository Config?").
+				Description("Load the directory's .gitconfig from the repository's own .git/config instead of adding an includeIf to your global config").
+				Value(&data.RepoLocal),
+		).WithHideFunc(func() bool {
+			dir, err := resolveTargetDir(data.DirectoryName)
+			return !data.GitInit && (err != nil || !isGitRepo(dir))
+		}))
+	}
+
+	if ask(flagTemplate) && ask(flagTemplateText) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title("Commit Message Template").
+				Description("File for commit.template, relative to the directory unless absolute or ~/ (leave empty to skip)").
+				Placeholder(defaultCommitTemplateName).
+				Value(&data.CommitTemplate).
+				Validate(func(s string) error {
+					if s == "" {
+						return nil
+					}
+					return validateCommitTemplate(s)
+				}),
+		))
+		groups = append(groups, huh.NewGroup(
+			huh.NewText().
+				Title("Template Text").
+				Description("The template does not exist yet; it is created with this text").
+				Value(&data.CommitTemplateText).
+				Validate(func(s string) error {
+					if strings.TrimSpace(s) == "" {
+						return fmt.Errorf("enter the template text, or go back and clear the template")
+					}
+					return nil
+				}),
+		).WithHideFunc(func() bool {
+			if data.CommitTemplate == "" {
+				return true
+			}
+			dir, err := resolveTargetDir(data.DirectoryName)
+			if err != nil {
+				return true
+			}
+			path, err := commitTemplateFile(dir, *data)
+			if err != nil {
+				return true
+			}
+			_, err = os.Stat(path)
+			return err == nil
+		}))
+	}
+	if ask(flagEditor) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewInput().
+				Title("Editor").
+				Description("Command for core.editor in this context (leave empty to keep your default)").
+				Placeholder("code --wait").
+				Value(&data.Editor).
+				Validate(func(s string) error {
+					if s == "" {
+						return nil
+					}
+					return validateEditor(s)
+				}),
+		))
+	}
+
+	if ask(flagTest) {
+		groups = append(groups, huh.NewGroup(
+			huh.NewConfirm().
+				Title("Test the SSH Connection?").
+				Description("After setup, run ssh -T against your provider once you have added the key").
+				Value(&data.TestConnection),
+		).WithHideFunc(https))
+	}
+
+	if err := huh.NewForm(groups...).WithTheme(formTheme()).Run(); err != nil {
+		return err
+	}
+
+	if https() {
+		data.SignMethod = signMethodGPG
+		data.TestConnection = false
+		addHostAlias, useExisting = false, false
+	} else if !set[flagCredHelper] {
+		data.CredentialHelper = ""
+	}
+	if !addHostAlias {
+		data.SSHHostAlias = ""
+	}
+	if !data.GitInit {
+		data.InitialBranch, data.Remote = "", ""
+	}
+	if !isSecurityKeyType(data.KeyType) && !set[flagSKResident] && !set[flagSKVerify] {
+		data.SKOptions = nil
+	}
+	if !set[flagKDFRounds] {
+		data.KDFRounds = 0
+		if data.Passphrase != "" && kdfRounds != "" {
+			data.KDFRounds, _ = strconv.Atoi(kdfRounds) // Already validated
+		}
+	}
+	if !providerSelfHostable(data.Provider) && !set[flagProviderHost] {
+		data.ProviderHost = ""
+	}
+	if data.RemoteURL == "" && !set[flagMatch] {
+		data.IncludeMatch = ""
+	}
+	if data.RemoteURL != "" && !set[flagBranch] {
+		data.Branch = ""
+	}
+	if !signsWithSSH(*data) || !data.SeparateSigningKey {
+		data.SeparateSigningKey, data.SigningKey = false, ""
+	}
+	if !signsWithGPG(*data) && !set[flagGPGKey] {
+		data.GPGKey = ""
+	}
+	if !signsWithGPG(*data) && !set[flagGPGProgram] {
+		data.GPGProgram = ""
+	}
+	// Without a template the text would create one the user skipped
+	if data.CommitTemplate == "" && !set[flagTemplateText] {
+		data.CommitTemplateText = ""
+	}
+
+	// Only keep the picked key if the user actually chose to reuse one
+	if !set[flagExisting] {
+		data.ExistingKey = ""
+		if useExisting {
+			data.ExistingKey = selectedKey
+		}
+	}
+	return nil
+}
+
+// existingKeyOptions lists the keys in ~/.ssh as select options labelled with their fingerprint
+func existingKeyOptions() []huh.Option[string] {
+	sshDir, err := defaultSSHDir()
+	if err != nil {
+		return nil
+	}
+	keys, err := findSSHKeys(sshDir)
+	if err != nil {
+		return nil
+	}
+
+	options := []huh.Option[string]{}
+	for _, key := range keys {
+		fingerprint, err := publicKeyFingerprint(key + ".pub")
+		if err != nil {
+			continue // Skip files that merely look like keys
+		}
+		options = append(options, huh.NewOption(fmt.Sprintf("%s (%s)", filepath.Base(key), fingerprint), key))
+	}
+	return options
+}
+
+// keyTypeOptions lists the key types this machine can generate, marking the
+// one the provider of data recommends
+func keyTypeOptions(data FormData) []huh.Option[string] {
+	recommended := ""
+	if _, ok := keyRecommendations[data.Provider]; ok {
+		recommended = recommendedKeyType(data.Provider)
+	}
+	options := []huh.Option[string]{}
+	for _, keyType := range availableKeyTypes() {
+		label := keyType
+		if keyType == recommended {
+			label += " (recommended for " + providerName(data) + ")"
+		}
+		options = append(options, huh.NewOption(label, keyType))
+	}
+	return options
+}
+
+// gpgKeyOptions builds the select options for the GPG secret keys
+func gpgKeyOptions(program string) []huh.Option[string] {
+	keys, err := listGPGSecretKeys(program)
+	if err != nil {
+		return nil
+	}
+	options := []huh.Option[string]{}
+	for _, key := range keys {
+		options = append(options, huh.NewOption(gpgKeyOptionLabel(key), key.ID))
+	}
+	return options
+}
+
+// confirm asks a yes/no question, returning true right away when assumeYes is set
+func confirm(title string, assumeYes bool) (bool, error) {
+	if assumeYes {
+		return true, nil
+	}
+	ok := false
+	err := runField(huh.NewConfirm().
+		Title(title).
+		Value(&ok),
+	)
+	return ok, err
+}
+
+// Choices offered after the summary
+const (
+	reviewApply  = "apply"
+	reviewEdit   = "edit"
+	reviewCancel = "cancel"
+)
+
+// confirmSummary shows what setup is about to do and asks the user to apply
+// it, go back to the form, or cancel
+func confirmSummary(data FormData) (string, error) {
+	absPath, err := resolveTargetDir(data.DirectoryName)
+	if err != nil {
+		return "", err
+	}
+	globalGitConfigPath, err := resolveGlobalGitConfigPath()
+	if err != nil {
+		return "", err
+	}
+	localConfigPath, err := localConfigFile(absPath, data)
+	if err != nil {
+		return "", err
+	}
+
+	messages := []string{styleInfo.Render("Summary"), ""}
+
+	if _, err := os.Stat(absPath); err == nil {
+		messages = append(messages, "Directory:       "+stylePath.Render(absPath)+" (exists)")
+	} else {
+		messages = append(messages, "Directory:       "+stylePath.Render(absPath)+" (will be created)")
+	}
+
+	if usesHTTPS(data) {
+		messages = append(messages, "Authentication:  HTTPS, credential.helper "+credentialHelper(data))
+	} else if data.ExistingKey != "" {
+		messages = append(messages, "SSH key:         existing "+stylePath.Render(data.ExistingKey))
+	} else {
+		_, privateKeyPath, _, err := sshKeyPaths(data.SSHDir, data.KeyName)
+		if err != nil {
+			return "", err
+		}
+		keyDescription := "new " + data.KeyType
+		if data.KeyType == "rsa" {
+			keyDescription += fmt.Sprintf(" %d bits", data.RSABits)
+		}
+		if len(data.SKOptions) > 0 {
+			keyDescription += ", " + strings.Join(data.SKOptions, ", ")
+		}
+		if data.Passphrase != "" {
+			keyDescription += ", passphrase protected"
+		}
+		messages = append(messages, "SSH key:         "+stylePath.Render(privateKeyPath)+" ("+keyDescription+")")
+	}
+
+	if data.SigningKey != "" {
+		messages = append(messages, "Signing key:     existing "+stylePath.Render(data.SigningKey))
+	} else if signsWithSSH(data) && data.SeparateSigningKey {
+		_, privateKeyPath, _, err := sshKeyPaths(data.SSHDir, signingKeyName(data.KeyName))
+		if err != nil {
+			return "", err
+		}
+		messages = append(messages, "Signing key:     "+stylePath.Render(privateKeyPath)+" (new "+data.KeyType+")")
+	}
+
+	messages = append(messages, fmt.Sprintf("Git identity:    %s <%s>", data.GitUsername, data.GitEmail))
+	if len(data.AlternateEmails) > 0 {
+		messages = append(messages, fmt.Sprintf("Other emails:    %s", strings.Join(data.AlternateEmails, ", ")))
+	}
+	if signsWithGPG(data) {
+		gpgKey := data.GPGKey
+		if gpgKey == "" {
+			gpgKey = "from your keyring"
+		}
+		messages = append(messages, "Signing:         "+strings.Join(effectiveSignScopes(data), ", ")+" signed with GPG key "+gpgKey)
+		if data.GPGProgram != "" {
+			messages = append(messages, "gpg.program:     "+data.GPGProgram)
+		}
+	} else if data.SignCommits {
+		messages = append(messages, "Signing:         "+strings.Join(effectiveSignScopes(data), ", ")+" signed with the SSH key")
+	} else {
+		messages = append(messages, "Signing:         disabled")
+	}
+
+	if _, err := os.Stat(localConfigPath); err == nil {
+		action := "asked whether to merge or overwrite"
+		if data.OnConflict != "" {
+			action = data.OnConflict
+		}
+		messages = append(messages, "Local config:    "+stylePath.Render(localConfigPath)+" (exists, "+action+")")
+	} else {
+		messages = append(messages, "Local config:    "+stylePath.Render(localConfigPath))
+	}
+	if data.TemplateConfig != "" {
+		messages = append(messages, "Defaults from:   "+stylePath.Render(data.TemplateConfig))
+	}
+	if useRepoConfig(absPath, data) {
+		messages = append(messages, "Repo config:     include the local .gitconfig, global config unchanged")
+	} else {
+		sectionNames, _ := includeIfSections(absPath, localConfigPath, data)
+		for _, sectionName := range sectionNames {
+			messages = append(messages, "Global config:   add ["+sectionName+"] to "+stylePath.Render(globalGitConfigPath))
+		}
+	}
+	if commitTemplatePath, err := commitTemplateFile(absPath, data); err == nil && commitTemplatePath != "" {
+		if _, err := os.Stat(commitTemplatePath); err == nil {
+			messages = append(messages, "Commit template: "+stylePath.Render(commitTemplatePath))
+		} else {
+			messages = append(messages, "Commit template: "+stylePath.Render(commitTemplatePath)+" (will be created)")
+		}
+	}
+	if data.Editor != "" {
+		messages = append(messages, "Editor:          "+data.Editor)
+	}
+	if data.AutoCRLF != "" {
+		messages = append(messages, "core.autocrlf:   "+data.AutoCRLF)
+	}
+	if data.FileMode != "" {
+		messages = append(messages, "core.fileMode:   "+data.FileMode)
+	}
+	if data.PullRebase != "" {
+		messages = append(messages, "pull.rebase:     "+canonicalGitBool(data.PullRebase))
+	}
+	if data.FetchPrune != "" {
+		messages = append(messages, "fetch.prune:     "+canonicalGitBool(data.FetchPrune))
+	}
+	if data.DefaultBranch != "" {
+		messages = append(messages, "Default branch:  "+data.DefaultBranch)
+	}
+	if data.HTTPProxy != "" {
+		proxy := "HTTP proxy:      " + data.HTTPProxy
+		if data.HTTPProxyURL != "" {
+			proxy += " (for " + data.HTTPProxyURL + ")"
+		}
+		messages = append(messages, proxy)
+	}
+	if data.GitProxy != "" {
+		messages = append(messages, "core.gitProxy:   "+data.GitProxy)
+	}
+	if data.SSHHostAlias != "" {
+		messages = append(messages, fmt.Sprintf("SSH config:      Host %s -> %s", data.SSHHostAlias, sshHostName(data)))
+	}
+	if data.KnownHostsFile != "" {
+		messages = append(messages, "Known hosts:     "+stylePath.Render(data.KnownHostsFile))
+	}
+	if data.HostKeyChecking != "" {
+		messages = append(messages, "Host keys:       StrictHostKeyChecking="+data.HostKeyChecking)
+	}
+	if data.GitInit {
+		if isGitRepo(absPath) {
+			messages = append(messages, "Repository:      already initialized")
+		} else if data.InitialBranch != "" {
+			messages = append(messages, "Repository:      git init (branch "+data.InitialBranch+")")
+		} else {
+			messages = append(messages, "Repository:      git init")
+		}
+	}
+	if data.Remote != "" {
+		messages = append(messages, "Remote origin:   "+data.Remote)
+	}
+
+	printBorderedMessages(messages)
+	choice := reviewApply
+	err = runField(huh.NewSelect[string]().
+		Title("Apply these changes?").
+		Options(
+			huh.NewOption("Looks good, apply them", reviewApply),
+			huh.NewOption("Edit the answers again", reviewEdit),
+			huh.NewOption("Cancel", reviewCancel),
+		).
+		Value(&choice),
+	)
+	return choice, err
+}
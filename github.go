@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// GitHub REST API settings. GITHUB_API_URL points the upload at GitHub
+// Enterprise Server, as it does for GitHub Actions.
+const (
+	defaultGitHubAPIURL = "https://api.github.com"
+	githubAPIVersion    = "2022-11-28"
+	githubTimeout       = 30 * time.Second
+)
+
+// githubKey is a key created on the user's GitHub account
+type githubKey struct {
+	Kind  string `json:"kind"` // "authentication" or "signing"
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// githubAPIError is the error body returned by the GitHub API
+type githubAPIError struct {
+	Message string `json:"message"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// githubAPIURL returns the API base URL, without a trailing slash
+func githubAPIURL() string {
+	if url := os.Getenv("GITHUB_API_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return defaultGitHubAPIURL
+}
+
+// githubToken returns the token to upload with: --github-token, else GITHUB_TOKEN
+func githubToken(opts cliOptions) string {
+	if opts.GitHubToken != "" {
+		return opts.GitHubToken
+	}
+	return os.Getenv("GITHUB_TOKEN")
+}
+
+// addGitHubKey creates a key through endpoint ("user/keys" or
+// "user/ssh_signing_keys") and returns its id
+func addGitHubKey(token, endpoint, title, publicKey string) (int64, error) {
+	body, err := json.Marshal(map[string]string{"title": title, "key": publicKey})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, githubAPIURL()+"/"+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-GitHub-Api-Version", githubAPIVersion)
+	req.Header.Set("User-Agent", appName+"/"+appVersion)
+
+	client := &http.Client{Timeout: githubTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request to GitHub failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read GitHub response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return 0, githubError(resp.StatusCode, respBody, endpoint)
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return 0, fmt.Errorf("unexpected GitHub response: %w", err)
+	}
+	return created.ID, nil
+}
+
+// githubError turns a failed API response into an error that says what to fix
+func githubError(status int, body []byte, endpoint string) error {
+	var apiErr githubAPIError
+	_ = json.Unmarshal(body, &apiErr)
+	details := apiErr.Message
+	for _, e := range apiErr.Errors {
+		details += ": " + e.Message
+	}
+	if details == "" {
+		details = http.StatusText(status)
+	}
+
+	scope := "admin:public_key"
+	if endpoint == "user/ssh_signing_keys" {
+		scope = "admin:ssh_signing_key"
+	}
+	switch status {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("GitHub rejected the token (%s); check that it is valid and not expired", details)
+	case http.StatusForbidden, http.StatusNotFound:
+		return fmt.Errorf("GitHub refused the request (%s); the token needs the %s scope (or the matching fine-grained permission)", details, scope)
+	case http.StatusUnprocessableEntity:
+		if strings.Contains(strings.ToLower(details), "already in use") {
+			return fmt.Errorf("the key is already on a GitHub account (%s)", details)
+		}
+		return fmt.Errorf("GitHub did not accept the key (%s)", details)
+	default:
+		return fmt.Errorf("GitHub returned %d (%s)", status, details)
+	}
+}
+
+// githubUploadApplies reports whether --github-upload can add the key for
+// data, warning when the key is for another provider
+func githubUploadApplies(data FormData) bool {
+	if data.Provider == providerGitHub {
+		return true
+	}
+	logWarn("--github-upload only works with GitHub; add the key to %s yourself", providerName(data))
+	return false
+}
+
+// uploadToGitHub adds the context's public key to the GitHub account of the
+// token, as an authentication key and, when signing is enabled, a signing key
+func uploadToGitHub(result *setupResult, token string) error {
+	title := strings.TrimSuffix(filepath.Base(result.PublicKeyPath), ".pub")
+	if result.PublicKeyPath == "" {
+		// A key imported from stdin has no file name; its comment is the next best thing
+		title = appName
+		if fields := strings.Fields(result.PublicKey); len(fields) > 2 {
+			title = strings.Join(fields[2:], " ")
+		}
+	}
+
+	type upload struct{ kind, endpoint, title, publicKey string }
+	uploads := []upload{{"authentication", "user/keys", title, result.PublicKey}}
+	if result.SigningPublicKey != "" {
+		uploads = append(uploads, upload{"signing", "user/ssh_signing_keys", strings.TrimSuffix(filepath.Base(result.SigningPublicKeyPath), ".pub"), result.SigningPublicKey})
+	} else if signsWithSSH(result.data) {
+		uploads = append(uploads, upload{"signing", "user/ssh_signing_keys", title, result.PublicKey})
+	}
+	for _, upload := range uploads {
+		id, err := addGitHubKey(token, upload.endpoint, upload.title, upload.publicKey)
+		if err != nil {
+			result.GitHubError = err.Error()
+			return fmt.Errorf("failed to add the %s key to GitHub: %w", upload.kind, err)
+		}
+		result.GitHubKeys = append(result.GitHubKeys, githubKey{Kind: upload.kind, ID: id, Title: upload.title})
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Signing methods accepted by --sign-method
+const (
+	signMethodSSH = "ssh" // Sign with an SSH key (gpg.format=ssh)
+	signMethodGPG = "gpg" // Sign with an existing OpenPGP key from gpg
+)
+
+// signMethods lists the values accepted by --sign-method
+var signMethods = []string{signMethodSSH, signMethodGPG}
+
+// gpgInstallHint is shown when GPG signing is asked for without gpg
+const gpgInstallHint = "Install GnuPG from https://gnupg.org/download/ (or your package manager), or sign with --sign-method ssh"
+
+// gpgSecretKey is a secret key in the user's gpg keyring
+type gpgSecretKey struct {
+	ID          string // Long key id, used for user.signingkey
+	Fingerprint string
+	UserID      string // Primary user id, e.g. "Jane <jane@example.com>"
+	Card        string // Serial number of the smartcard that signs for it, "" for a key in the keyring
+}
+
+// validateSignMethod checks the value of --sign-method
+func validateSignMethod(s string) error {
+	if !slices.Contains(signMethods, s) {
+		return fmt.Errorf("unsupported signing method '%s' (supported: %s)", s, strings.Join(signMethods, ", "))
+	}
+	return nil
+}
+
+// signsWithSSH reports whether data signs with an SSH key, the default method
+func signsWithSSH(data FormData) bool {
+	return data.SignCommits && data.SignMethod != signMethodGPG
+}
+
+// signsWithGPG reports whether data signs with a GPG key
+func signsWithGPG(data FormData) bool {
+	return data.SignCommits && data.SignMethod == signMethodGPG
+}
+
+// gpgBinary returns the gpg program on the PATH: gpg, else gpg2, the name
+// some systems give GnuPG 2, or "" when there is neither
+func gpgBinary() string {
+	for _, name := range []string{"gpg", "gpg2"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// gpgProgram returns program, the --gpg-program of a context, or gpgBinary
+// when it has none
+func gpgProgram(program string) string {
+	if program != "" {
+		return program
+	}
+	return gpgBinary()
+}
+
+// validateGPGProgram checks the value of --gpg-program
+func validateGPGProgram(s string) error {
+	if strings.TrimSpace(s) == "" || strings.ContainsAny(s, "\r\n") {
+		return fmt.Errorf("gpg program must be a single non-empty line")
+	}
+	if _, err := exec.LookPath(s); err != nil {
+		return fmt.Errorf("gpg program '%s' was not found: %w", s, err)
+	}
+	return nil
+}
+
+// defaultGPGProgram returns the gpg.program a GPG-signing context needs, or ""
+// when git's default, gpg on the PATH, is the program the keys were listed with.
+// Git for Windows runs the gpg it bundles instead, which sees neither the keyring
+// nor the smartcard of a separately installed GnuPG, so there the full path is set.
+func defaultGPGProgram() string {
+	program := gpgBinary()
+	if hostOS == "windows" && program != "" {
+		if path, err := exec.LookPath(program); err == nil {
+			return filepath.ToSlash(path)
+		}
+	}
+	if program == "gpg" {
+		return ""
+	}
+	return program
+}
+
+// refreshGPGCard asks gpg about the smartcard plugged in, if any. This makes
+// gpg-agent learn the card, adding stubs for its keys to the keyring so they
+// are listed as secret keys; without a card the command fails, which is fine.
+func refreshGPGCard(program string) {
+	cmd := execCommand(program, "--card-status", "--with-colons")
+	_ = cmd.Run()
+}
+
+// listGPGSecretKeys returns the secret keys program (see gpgProgram) can sign
+// with, skipping revoked, expired and disabled ones. Keys on a smartcard are
+// included once their public key is in the keyring.
+func listGPGSecretKeys(program string) ([]gpgSecretKey, error) {
+	program = gpgProgram(program)
+	if program == "" {
+		return nil, fmt.Errorf("gpg was not found on your PATH, but it is required for GPG signing.\n%s", gpgInstallHint)
+	}
+	refreshGPGCard(program)
+	cmd := execCommand(program, "--list-secret-keys", "--with-colons")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GPG secret keys: %w\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseGPGSecretKeys(string(output)), nil
+}
+
+// parseGPGSecretKeys reads the output of gpg --list-secret-keys --with-colons
+// (see doc/DETAILS in GnuPG for the format)
+func parseGPGSecretKeys(output string) []gpgSecretKey {
+	keys := []gpgSecretKey{}
+	var current, primary *gpgSecretKey
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "sec":
+			current, primary = nil, nil
+			// Revoked and expired keys, and keys without a usable signing
+			// capability (S) or disabled (D), cannot sign
+			if strings.ContainsAny(fields[1], "re") || len(fields) < 12 || !strings.Contains(fields[11], "S") || strings.Contains(fields[11], "D") {
+				continue
+			}
+			keys = append(keys, gpgSecretKey{ID: fields[4], Card: gpgCardSerial(fields)})
+			current = &keys[len(keys)-1]
+			primary = current
+		case "fpr":
+			if current != nil && current.Fingerprint == "" {
+				current.Fingerprint = fields[9]
+			}
+		case "uid":
+			if current != nil && current.UserID == "" {
+				current.UserID = fields[9]
+			}
+		case "ssb":
+			current = nil // Fingerprints and user ids below belong to the subkey
+			// gpg signs with the signing subkey, so when that lives on a card the key does too
+			if primary != nil && primary.Card == "" && len(fields) > 11 && strings.Contains(fields[11], "s") {
+				primary.Card = gpgCardSerial(fields)
+			}
+		}
+	}
+	return keys
+}
+
+// gpgCardSerial returns the smartcard serial number in field 15 of a sec or
+// ssb line, or "" when the secret key is in the keyring ("+") or missing ("#")
+func gpgCardSerial(fields []string) string {
+	if len(fields) < 15 || fields[14] == "+" || fields[14] == "#" {
+		return ""
+	}
+	return fields[14]
+}
+
+// cardSerialLabel shortens the serial of an OpenPGP card, a full application
+// id such as D2760001240103040006123456780000, to the number printed on the
+// card (12345678 here), as gpg --card-status shows it
+func cardSerialLabel(serial string) string {
+	if len(serial) == 32 && strings.HasPrefix(serial, "D276000124") {
+		return strings.TrimLeft(serial[20:28], "0")
+	}
+	return serial
+}
+
+// findGPGKey returns the secret key matching id, a key id or fingerprint
+func findGPGKey(keys []gpgSecretKey, id string) (gpgSecretKey, bool) {
+	id = strings.ToUpper(strings.TrimPrefix(strings.ReplaceAll(id, " ", ""), "0x"))
+	for _, key := range keys {
+		if key.Fingerprint == id || key.ID == id || (len(id) >= 8 && strings.HasSuffix(key.Fingerprint, id)) {
+			return key, true
+		}
+	}
+	return gpgSecretKey{}, false
+}
+
+// validateGPGKey checks that program (see gpgProgram) has a usable secret key for id
+func validateGPGKey(program, id string) error {
+	keys, err := listGPGSecretKeys(program)
+	if err != nil {
+		return err
+	}
+	if _, ok := findGPGKey(keys, id); !ok {
+		return fmt.Errorf("no usable secret key '%s' in your gpg keyring (see gpg --list-secret-keys)", id)
+	}
+	return nil
+}
+
+// defaultGPGKey picks the key to sign with when none was given: the only
+// secret key, or the one whose user id has email
+func defaultGPGKey(program, email string) (string, error) {
+	keys, err := listGPGSecretKeys(program)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("gpg has no secret keys to sign with; create one with gpg --full-generate-key or use --sign-method ssh " +
+			"(for a key on a smartcard, import its public key first: gpg --card-edit, then fetch)")
+	}
+	if len(keys) == 1 {
+		return keys[0].ID, nil
+	}
+	matches := []string{}
+	for _, key := range keys {
+		if email != "" && strings.Contains(strings.ToLower(key.UserID), "<"+strings.ToLower(email)+">") {
+			matches = append(matches, key.ID)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("gpg has %d secret keys; choose one with --%s", len(keys), flagGPGKey)
+}
+
+// gpgKeyOptionLabel describes a secret key in the form
+func gpgKeyOptionLabel(key gpgSecretKey) string {
+	label := key.ID
+	if key.UserID != "" {
+		label += "  " + key.UserID
+	}
+	if key.Card != "" {
+		label += "  (on smartcard " + cardSerialLabel(key.Card) + ")"
+	}
+	return label
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+)
+
+// homeOverride is the directory set with --home, used instead of the user's
+// home directory (empty to use the real one)
+var homeOverride string
+
+// lookupHomeDir finds the user's own home directory; tests replace it
+var lookupHomeDir = findHomeDir
+
+// findHomeDir returns the user's own home directory from the environment,
+// falling back to the account database (/etc/passwd and the like) for
+// locked-down systems that leave $HOME unset
+func findHomeDir() (string, error) {
+	if dir, err := os.UserHomeDir(); err == nil {
+		return dir, nil
+	}
+	if account, err := user.Current(); err == nil && account.HomeDir != "" {
+		return account.HomeDir, nil
+	}
+	variable := "$HOME"
+	if runtime.GOOS == "windows" {
+		variable = "%USERPROFILE%"
+	}
+	return "", fmt.Errorf("could not find your home directory: %s is not set and the user database has none for your account; set %s or pass --home <dir>", variable, variable)
+}
+
+// userHomeDir returns the home directory the tool works in: --home if given,
+// else the user's own
+func userHomeDir() (string, error) {
+	if homeOverride != "" {
+		return homeOverride, nil
+	}
+	return lookupHomeDir()
+}
+
+// setHomeOverride makes dir the home directory for the rest of the run. git and
+// ssh run by the tool follow it too, so the global config they read and
+// ~/.ssh/known_hosts also come from the sandbox.
+func setHomeOverride(dir string) error {
+	absPath, err := resolveTargetDir(dir)
+	if err != nil {
+		return err
+	}
+	if !isDir(absPath) {
+		return fmt.Errorf("'%s' is not an existing directory", absPath)
+	}
+	homeOverride = absPath
+	// These would point git (and this tool) at files outside the sandbox
+	os.Unsetenv("GIT_CONFIG_GLOBAL")
+	os.Unsetenv("XDG_CONFIG_HOME")
+	return os.Setenv("HOME", absPath)
+}
+
+// addHomeFlag registers --home on fs; it takes effect as soon as it is parsed
+func addHomeFlag(fs *flag.FlagSet) {
+	fs.Func("home", "use this directory as the home directory: the global config, ~/.ssh and the remembered answers all live there (for trying things out in a sandbox)", setHomeOverride)
+}
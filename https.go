@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Ways a context can authenticate to the provider, accepted by --auth
+const (
+	authSSH   = "ssh"   // Generate or reuse an SSH key and set core.sshCommand (the default)
+	authHTTPS = "https" // Set credential.helper and let git ask for a token on the first push
+)
+
+// authMethods lists the values accepted by --auth
+var authMethods = []string{authSSH, authHTTPS}
+
+// httpsConflicts are the flags that only apply to SSH authentication, which
+// --auth https does not set up
+var httpsConflicts = []string{
+	flagKeyType, flagCurve, flagRSABits, flagExisting, flagSSHDir, flagKeyName, flagComment, flagKDFRounds,
+	flagSKResident, flagSKVerify, flagKeyOnly, "native", flagSeparate, flagSigningKey,
+	flagHostAlias, flagHostName, flagKnownHosts, flagHostKeyCheck, flagTest, flagTestHost,
+	flagImportPubkey, flagKeygenTimeout, "add-to-agent", "github-upload", "github-token", flagPrintSSHCfg,
+	flagPubkeyOut,
+}
+
+// validateAuthMethod checks the value of --auth
+func validateAuthMethod(s string) error {
+	if !slices.Contains(authMethods, s) {
+		return fmt.Errorf("unsupported authentication '%s' (supported: %s)", s, strings.Join(authMethods, ", "))
+	}
+	return nil
+}
+
+// validateCredentialHelper checks the value of --credential-helper
+func validateCredentialHelper(s string) error {
+	if strings.TrimSpace(s) == "" {
+		return fmt.Errorf("credential helper cannot be empty")
+	}
+	if strings.ContainsAny(s, "\r\n") {
+		return fmt.Errorf("credential helper must be a single line")
+	}
+	return nil
+}
+
+// usesHTTPS reports whether the context authenticates over HTTPS instead of
+// with an SSH key
+func usesHTTPS(data FormData) bool {
+	return data.Auth == authHTTPS
+}
+
+// defaultCredentialHelper returns the helper git ships for goos: the system
+// keychain on macOS and Windows, and an in-memory cache elsewhere, which
+// unlike store never writes the token to disk
+func defaultCredentialHelper(goos string) string {
+	switch goos {
+	case "darwin":
+		return "osxkeychain"
+	case "windows":
+		return "manager"
+	}
+	return "cache --timeout=3600"
+}
+
+// credentialHelper returns the helper for data: the one given, else the
+// default for this OS
+func credentialHelper(data FormData) string {
+	if data.CredentialHelper != "" {
+		return data.CredentialHelper
+	}
+	return defaultCredentialHelper(hostOS)
+}
+
+// validateHTTPSData rejects the SSH-only settings of an HTTPS context, for
+// values that did not come from flags (e.g. batch files)
+func validateHTTPSData(data FormData) error {
+	if !usesHTTPS(data) {
+		if data.CredentialHelper != "" {
+			return fmt.Errorf("credential_helper only applies to auth %s", authHTTPS)
+		}
+		return nil
+	}
+	switch {
+	case data.ExistingKey != "":
+		return fmt.Errorf("existing_key only applies to auth %s", authSSH)
+	case data.SeparateSigningKey || data.SigningKey != "":
+		return fmt.Errorf("separate_signing_key and signing_key only apply to auth %s", authSSH)
+	case signsWithSSH(data):
+		return fmt.Errorf("auth %s has no SSH key to sign with; sign with sign_method %s", authHTTPS, signMethodGPG)
+	case data.SSHHostAlias != "" || data.KnownHostsFile != "" || data.HostKeyChecking != "":
+		return fmt.Errorf("ssh_host_alias, known_hosts_file and host_key_checking only apply to auth %s", authSSH)
+	case data.TestConnection:
+		return fmt.Errorf("test only applies to auth %s", authSSH)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// importStdin is the --import-pubkey value that reads the key from stdin
+const importStdin = "-"
+
+// importedKey is a public key passed with --import-pubkey
+type importedKey struct {
+	Path        string // Empty when read from stdin
+	Content     string // The key in authorized_keys format
+	Fingerprint string
+	key         ssh.PublicKey
+}
+
+// readImportedKey reads and parses the public key at source, a file or "-" for stdin
+func readImportedKey(source string) (importedKey, error) {
+	var content []byte
+	var err error
+	imported := importedKey{}
+	if source == importStdin {
+		content, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return imported, fmt.Errorf("failed to read the public key from stdin: %w", err)
+		}
+	} else {
+		imported.Path = source
+		content, err = os.ReadFile(source)
+		if err != nil {
+			return imported, fmt.Errorf("failed to read public key '%s': %w", stylePath.Render(source), err)
+		}
+	}
+
+	key, comment, _, _, err := ssh.ParseAuthorizedKey(content)
+	if err != nil {
+		return imported, fmt.Errorf("not a public key in authorized_keys format (e.g. ssh-ed25519 AAAA... comment): %w", err)
+	}
+	imported.key = key
+	imported.Content = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if comment != "" {
+		imported.Content += " " + comment
+	}
+	imported.Fingerprint = ssh.FingerprintSHA256(key)
+	return imported, nil
+}
+
+// checkMatches makes sure privateKeyPath's .pub is the imported key, so the
+// config is not wired up to a different key than the one shown and uploaded
+func (k importedKey) checkMatches(privateKeyPath string) error {
+	publicKeyPath := privateKeyPath + ".pub"
+	content, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read public key '%s': %w", stylePath.Render(publicKeyPath), err)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse public key '%s': %w", stylePath.Render(publicKeyPath), err)
+	}
+	if !bytes.Equal(key.Marshal(), k.key.Marshal()) {
+		return fmt.Errorf("the imported public key (%s) does not belong to '%s' (%s)", k.Fingerprint, stylePath.Render(privateKeyPath), ssh.FingerprintSHA256(key))
+	}
+	return nil
+}
+
+// runImport shows, copies and optionally uploads an imported public key
+// without touching any config, for keys that have no private key at hand
+func runImport(imported importedKey, data FormData, opts cliOptions) error {
+	result := &setupResult{
+		Imported:      true,
+		PublicKeyPath: imported.Path,
+		PublicKey:     imported.Content,
+		Fingerprint:   imported.Fingerprint,
+		data:          data,
+	}
+
+	if warning := publicKeyWarning(data, imported.key); warning != "" {
+		logWarn("%s", warning)
+	}
+	// These need the private key
+	if opts.AddToAgent {
+		logWarn("--add-to-agent needs the private key; pass it with --%s to use it", flagExisting)
+	}
+	if data.TestConnection {
+		logWarn("--test needs the private key; pass it with --%s to use it", flagExisting)
+	}
+	if opts.DryRun {
+		return printSetupResult(importPlan(imported, data, opts), opts.Output)
+	}
+
+	if !opts.NoClipboard {
+		copyPublicKey(result, result.PublicKey, opts)
+	}
+
+	// As in setup, a failed --pubkey-out write does not skip the upload
+	var pubkeyOutErr, uploadErr error
+	if opts.PubkeyOut != "" {
+		pubkeyOutErr = writePubkeyOut(result, result.PublicKey, opts.PubkeyOut)
+	}
+	if opts.GitHubUpload && githubUploadApplies(data) {
+		uploadErr = uploadToGitHub(result, githubToken(opts))
+	}
+	if err := printSetupResult(result, opts.Output); err != nil {
+		return err
+	}
+	return errors.Join(pubkeyOutErr, uploadErr)
+}
+
+// importPlan is the --dry-run result of runImport: what it would do with the
+// imported key, without copying, writing or uploading it
+func importPlan(imported importedKey, data FormData, opts cliOptions) *setupResult {
+	source := imported.Path
+	if source == "" {
+		source = "stdin"
+	}
+	plan := []string{
+		styleWarn.Render("Dry run: no changes will be made"), "",
+		styleKey.Render("Would import public key from:") + " " + stylePath.Render(source),
+		styleKey.Render("Fingerprint:") + " " + styleKeyText.Render(imported.Fingerprint),
+		styleInfo.Render("No git config would be written (--import-pubkey without --" + flagExisting + ")"),
+	}
+	if opts.PubkeyOut != "" {
+		plan = append(plan, "", styleInfo.Render("Would write the public key to:")+" "+stylePath.Render(opts.PubkeyOut))
+	}
+	if opts.GitHubUpload && githubUploadApplies(data) {
+		kinds := "an authentication key"
+		if signsWithSSH(data) {
+			kinds = "an authentication and a signing key"
+		}
+		plan = append(plan, "", styleInfo.Render("Would add the public key to GitHub ("+githubAPIURL()+") as "+kinds))
+	}
+	return &setupResult{DryRun: true, Plan: plan, data: data}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// keyOnlyFormFlags are the values the form still asks for with --key-only
+var keyOnlyFormFlags = []string{flagKeyType, flagKeyName, flagComment, flagKDFRounds, flagCurve, flagRSABits, flagSKResident, flagSKVerify, flagProvider, flagProviderHost}
+
+// keyOnlyConflicts are the flags that only affect the git config, which
+// --key-only does not write
+var keyOnlyConflicts = []string{
+	flagDir, flagAttach, flagExisting, flagSign, flagSignMethod, flagGPGKey, flagGPGProgram, flagSeparate, flagSigningKey,
+	flagRemoteURL, flagBranch, flagGitdirPat, flagMatch, flagHostAlias, flagHostName, flagKnownHosts, flagHostKeyCheck,
+	flagGitInit, flagInitialBranch, flagRemote, flagRepoLocal, flagLocalConfig, flagRelInclude, flagTemplateCfg,
+	flagOnConflict, flagOnInclude, flagTemplate, flagTemplateText, flagEditor,
+	flagAutoCRLF, flagFileMode, flagPullRebase, flagFetchPrune, flagDefaultBranch, flagHTTPProxy, flagHTTPProxyURL, flagGitProxy, flagAuth, flagCredHelper, flagGitignore, flagDumpConfig, flagIncludeStyle,
+	flagScope,
+}
+
+// generateKeyOnly implements --key-only: it generates the key (creating the
+// key directory if needed), copies the public key and loads it into the agent
+// if asked, without creating a directory or touching any git config
+func generateKeyOnly(data FormData, opts cliOptions) (*setupResult, error) {
+	if data.KeyName == "" {
+		data.KeyName = defaultKeyName(data.Provider)
+	}
+	if opts.DryRun {
+		_, privateKeyPath, _, err := sshKeyPaths(data.SSHDir, data.KeyName)
+		if err != nil {
+			return nil, err
+		}
+		plan := []string{
+			styleWarn.Render("Dry run: no changes will be made"), "",
+			styleKey.Render("Would generate SSH key:") + " " + stylePath.Render(privateKeyPath),
+			styleInfo.Render("No git config would be written (--key-only)"),
+		}
+		result := &setupResult{DryRun: true, Plan: plan, data: data}
+		if opts.PrintSSHConfig {
+			result.SSHConfigSnippet = sshConfigSnippet(data, privateKeyPath)
+		}
+		return result, nil
+	}
+
+	if warning := keyTypeWarning(data, data.KeyType, data.RSABits); warning != "" {
+		logWarn("%s", warning)
+	}
+	result := &setupResult{KeyOnly: true, KeyGenerated: true, data: data}
+	var err error
+	result.PrivateKeyPath, result.PublicKeyPath, err = generateSSHKey(data, data.KeyName, opts.KeygenTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+	content, err := os.ReadFile(result.PublicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key '%s': %w", stylePath.Render(result.PublicKeyPath), err)
+	}
+	result.PublicKey = strings.TrimSpace(string(content))
+	if fingerprint, err := publicKeyFingerprint(result.PublicKeyPath); err == nil {
+		result.Fingerprint = fingerprint
+	}
+
+	if !opts.NoClipboard {
+		logStep("Copying the public key to the clipboard")
+		copyPublicKey(result, string(content), opts)
+	}
+	if opts.AddToAgent {
+		logStep("Adding the key to ssh-agent")
+		result.Agent, result.AgentError = addToAgent(result.PrivateKeyPath, data.Passphrase != "")
+	}
+	if opts.PrintSSHConfig {
+		result.SSHConfigSnippet = sshConfigSnippet(data, result.PrivateKeyPath)
+	}
+	return result, nil
+}
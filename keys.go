@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultSSHDir returns the user's ~/.ssh directory
+func defaultSSHDir() (string, error) {
+	homeDir, err := userHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".ssh"), nil
+}
+
+// findSSHKeys returns the private keys in sshDir that have a matching .pub file
+func findSSHKeys(sshDir string) ([]string, error) {
+	entries, err := os.ReadDir(sshDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .ssh directory '%s': %w", stylePath.Render(sshDir), err)
+	}
+
+	keys := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) == ".pub" {
+			continue
+		}
+		privateKeyPath := filepath.Join(sshDir, entry.Name())
+		if info, err := os.Stat(privateKeyPath + ".pub"); err == nil && !info.IsDir() {
+			keys = append(keys, privateKeyPath)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// validateExistingKey checks that privateKeyPath exists and has a matching, parseable .pub file
+func validateExistingKey(privateKeyPath string) error {
+	if info, err := os.Stat(privateKeyPath); err != nil {
+		return fmt.Errorf("private key not found: %w", err)
+	} else if info.IsDir() {
+		return fmt.Errorf("'%s' is a directory, not a private key", privateKeyPath)
+	}
+	if _, err := publicKeyFingerprint(privateKeyPath + ".pub"); err != nil {
+		return fmt.Errorf("no usable public key next to '%s': %w", privateKeyPath, err)
+	}
+	return nil
+}
+
+// publicKeyFingerprint returns the SHA256 fingerprint of the public key file,
+// in the same format as `ssh-keygen -l`
+func publicKeyFingerprint(publicKeyPath string) (string, error) {
+	content, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return "", err
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse public key '%s': %w", publicKeyPath, err)
+	}
+	return ssh.FingerprintSHA256(publicKey), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Values accepted by --strict-host-key-checking, as understood by ssh
+const (
+	hostKeyCheckYes       = "yes"        // Refuse hosts that are not in known_hosts yet
+	hostKeyCheckAcceptNew = "accept-new" // Trust a host on first use, refuse changed keys
+	hostKeyCheckAsk       = "ask"        // ssh's default: ask before trusting a new host
+	hostKeyCheckNo        = "no"         // Trust any key, even a changed one
+)
+
+// hostKeyCheckModes lists the values accepted by --strict-host-key-checking
+var hostKeyCheckModes = []string{hostKeyCheckYes, hostKeyCheckAcceptNew, hostKeyCheckAsk, hostKeyCheckNo}
+
+// knownHostsFileMode matches what ssh uses for the known_hosts files it creates
+const knownHostsFileMode os.FileMode = 0644
+
+// validateHostKeyCheck checks the value of --strict-host-key-checking
+func validateHostKeyCheck(s string) error {
+	if !slices.Contains(hostKeyCheckModes, s) {
+		return fmt.Errorf("unsupported value '%s' (supported: %s)", s, strings.Join(hostKeyCheckModes, ", "))
+	}
+	return nil
+}
+
+// ensureKnownHostsFile creates an empty known_hosts file at path (and its
+// directory) unless it exists. It reports whether the file was created.
+func ensureKnownHostsFile(path string) (bool, error) {
+	if _, err := os.Stat(path); err == nil {
+		logDetail("%s already exists", path)
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), sshDirMode); err != nil {
+		return false, fmt.Errorf("failed to create directory for '%s': %w", stylePath.Render(path), err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, knownHostsFileMode)
+	if err != nil {
+		return false, fmt.Errorf("failed to create known hosts file '%s': %w", stylePath.Render(path), err)
+	}
+	return true, file.Close()
+}
+
+// hostKeyOptions returns the ssh -o options for the known_hosts settings of data
+func hostKeyOptions(data FormData, knownHostsPath string) []string {
+	options := []string{}
+	if knownHostsPath != "" {
+		options = append(options, "UserKnownHostsFile="+sshConfigQuote(knownHostsPath))
+	}
+	if data.HostKeyChecking != "" {
+		options = append(options, "StrictHostKeyChecking="+data.HostKeyChecking)
+	}
+	return options
+}
+
+// hostKeyNotes explains what the known_hosts settings of data give up, if anything
+func hostKeyNotes(data FormData) []string {
+	notes := []string{}
+	if data.KnownHostsFile != "" {
+		notes = append(notes, "Host keys for this directory are kept in "+data.KnownHostsFile+", apart from ~/.ssh/known_hosts: hosts you already trust are verified again, and a host key you remove there is still trusted here.")
+	}
+	switch data.HostKeyChecking {
+	case hostKeyCheckNo:
+		notes = append(notes, "StrictHostKeyChecking=no accepts any host key, even a changed one, so a man-in-the-middle would go unnoticed. Only use it for throwaway or fully trusted networks.")
+	case hostKeyCheckAcceptNew:
+		notes = append(notes, "StrictHostKeyChecking=accept-new trusts a host on the first connection without asking; compare the fingerprint with the one your provider publishes.")
+	case hostKeyCheckYes:
+		notes = append(notes, "StrictHostKeyChecking=yes refuses hosts that are not known yet; add your provider's host keys (e.g. with ssh-keyscan, after checking them) before the first fetch.")
+	}
+	return notes
+}
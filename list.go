@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/go-ini/ini"
+)
+
+// includeIfPattern matches includeIf section names and captures the condition
+var includeIfPattern = regexp.MustCompile(`^includeIf\s+"(.*)"$`)
+
+// configContext is a per-directory context found as an includeIf section in the global .gitconfig
+type configContext struct {
+	Section    string // Full section name, e.g. includeIf "gitdir:/home/me/work/"
+	Condition  string // Condition inside the quotes, e.g. gitdir:/home/me/work/
+	ConfigPath string // Resolved path of the included config file
+	UserName   string
+	UserEmail  string
+	Missing    bool // The included config file does not exist
+}
+
+// loadContexts reads every includeIf section from the global .gitconfig along
+// with the identity configured in each included file
+func loadContexts() (string, []configContext, error) {
+	globalGitConfigPath, err := resolveGlobalGitConfigPath()
+	if err != nil {
+		return "", nil, err
+	}
+	cfg, err := loadGitConfig(globalGitConfigPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+	}
+
+	contexts := []configContext{}
+	for _, section := range cfg.Sections() {
+		match := includeIfPattern.FindStringSubmatch(section.Name())
+		if match == nil || !section.HasKey("path") {
+			continue
+		}
+		ctx := configContext{
+			Section:    section.Name(),
+			Condition:  match[1],
+			ConfigPath: resolveIncludePath(globalGitConfigPath, section.Key("path").String()),
+		}
+
+		if _, err := os.Stat(ctx.ConfigPath); err != nil {
+			ctx.Missing = true
+		} else if local, err := loadGitConfig(ctx.ConfigPath); err == nil {
+			ctx.UserName = local.Section("user").Key("name").String()
+			ctx.UserEmail = local.Section("user").Key("email").String()
+		}
+		contexts = append(contexts, ctx)
+	}
+	return globalGitConfigPath, contexts, nil
+}
+
+// contextConfigPath returns the local config of the context set up for absPath:
+// the file its includeIf "gitdir:" section in the global config cfg loads, or
+// the directory's .gitconfig when there is no such section. Sections spelling
+// the directory differently (case on Windows, trailing slash) count too.
+func contextConfigPath(cfg *ini.File, globalGitConfigPath, absPath string) string {
+	sectionName, includeIfPathValue := includeIfEntry(absPath, filepath.Join(absPath, defaultLocalConfigName))
+	wanted := normalizeIncludeCondition(includeIfPattern.FindStringSubmatch(sectionName)[1])
+	for _, section := range cfg.Sections() {
+		match := includeIfPattern.FindStringSubmatch(section.Name())
+		if match != nil && section.HasKey("path") && normalizeIncludeCondition(match[1]) == wanted {
+			return resolveIncludePath(globalGitConfigPath, section.Key("path").String())
+		}
+	}
+	return filepath.FromSlash(includeIfPathValue)
+}
+
+// resolveIncludePath resolves an include path the way git does: '~/' is
+// expanded to the home directory and relative paths are taken relative to the
+// directory of the including config file
+func resolveIncludePath(includingFile, path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if homeDir, err := userHomeDir(); err == nil {
+			return filepath.Join(homeDir, rest)
+		}
+	}
+	if !filepath.IsAbs(path) && !strings.HasPrefix(path, "/") {
+		return filepath.Join(filepath.Dir(includingFile), path)
+	}
+	return filepath.FromSlash(path)
+}
+
+// newListFlagSet defines the flags of the list subcommand
+func newListFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" list", flag.ContinueOnError)
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	addHomeFlag(fs)
+	return fs
+}
+
+// runList implements the list subcommand
+func runList(args []string) error {
+	fs := newListFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	globalGitConfigPath, contexts, err := loadContexts()
+	if err != nil {
+		return err
+	}
+	if len(contexts) == 0 {
+		fmt.Printf("%s %s\n", styleInfo.Render("No includeIf contexts found in"), stylePath.Render(globalGitConfigPath))
+		return nil
+	}
+
+	t := table.New().
+		Border(boxBorder).
+		BorderStyle(styleBorder).
+		StyleFunc(func(row, col int) lipgloss.Style { return lipgloss.NewStyle().Padding(0, 1) }).
+		Headers("CONDITION", "CONFIG", "USER.NAME", "USER.EMAIL")
+	for _, ctx := range contexts {
+		configPath := ctx.ConfigPath
+		if ctx.Missing {
+			configPath = styleError.Render(configPath + " (missing)")
+		}
+		t.Row(ctx.Condition, configPath, ctx.UserName, ctx.UserEmail)
+	}
+
+	fmt.Printf("%s %s\n", styleInfo.Render("Contexts in"), stylePath.Render(globalGitConfigPath))
+	fmt.Println(t.Render())
+	return nil
+}
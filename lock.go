@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockRetryInterval is how often a held lock is tried again
+const lockRetryInterval = 100 * time.Millisecond
+
+// lockTimeout is how long to wait for another run to release the global
+// config; a variable so tests can shorten it
+var lockTimeout = 10 * time.Second
+
+// lockConfigFile takes an advisory lock on the config at path, so two runs
+// (e.g. from a parallel provisioning script) do not both read it and the
+// last writer drop the other's includeIf. The lock is path + ".lock", created
+// exclusively, the same file git config takes, so git is kept out as well.
+// The returned func releases it.
+func lockConfigFile(path string) (func(), error) {
+	// Lock the real file behind a symlink, which is what writeFileAtomic writes
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	lockPath := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), dirMode); err != nil {
+		return nil, fmt.Errorf("failed to create directory for '%s': %w", stylePath.Render(lockPath), err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			// The pid tells whoever finds a stale lock which run left it
+			fmt.Fprintln(file, os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock '%s': %w", stylePath.Render(path), err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("another %s run (or git config) is in progress: '%s' is still locked after %s; if no other run is active, delete the stale '%s'",
+				appName, stylePath.Render(path), lockTimeout, stylePath.Render(lockPath))
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// Verbosity levels, set by --quiet and --verbose
+const (
+	levelQuiet   = iota // Errors and the public key only
+	levelNormal         // Warnings and notices as well
+	levelVerbose        // Every step, the ssh-keygen arguments and each config key written
+)
+
+// verbosity is the current level; messages above it are dropped
+var verbosity = levelNormal
+
+// logAt prints a message on stderr if the verbosity is at least level
+func logAt(level int, format string, args ...any) {
+	if verbosity < level {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// logError prints an error, whatever the verbosity
+func logError(format string, args ...any) {
+	logAt(levelQuiet, styleError.Render("Error:")+" "+format, args...)
+}
+
+// logWarn prints a warning unless --quiet is set
+func logWarn(format string, args ...any) {
+	logAt(levelNormal, styleWarn.Render("Warning:")+" "+format, args...)
+}
+
+// logInfo prints a notice unless --quiet is set
+func logInfo(format string, args ...any) {
+	logAt(levelNormal, format, args...)
+}
+
+// logStep announces a setup step with --verbose
+func logStep(format string, args ...any) {
+	audit(auditEvent{Event: auditStep, Message: fmt.Sprintf(format, args...)})
+	logAt(levelVerbose, styleInfo.Render("==>")+" "+format, args...)
+}
+
+// logDetail prints a detail of the current step with --verbose
+func logDetail(format string, args ...any) {
+	logAt(levelVerbose, "    "+format, args...)
+}
+
+// logConfigKeys lists every key of cfg with --verbose
+func logConfigKeys(cfg *ini.File) {
+	if verbosity < levelVerbose {
+		return
+	}
+	for _, section := range cfg.Sections() {
+		for _, key := range section.Keys() {
+			logDetail("%s = %s", gitConfigKeyName(section.Name(), key.Name()), key.Value())
+		}
+	}
+}
+
+// gitConfigKeyName writes a key the way git config names it, e.g.
+// gpg.ssh.allowedSignersFile for the key allowedSignersFile in [gpg "ssh"]
+func gitConfigKeyName(section, key string) string {
+	if name, subsection, ok := strings.Cut(section, " "); ok {
+		return name + "." + strings.Trim(subsection, `"`) + "." + key
+	}
+	return section + "." + key
+}
@@ -1,18 +1,27 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/atotto/clipboard"
-	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/go-ini/ini"
 	"github.com/google/uuid"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
 )
 
 // Version information
@@ -23,252 +32,1167 @@ const (
 
 // FormData holds user input from the form
 type FormData struct {
-	DirectoryName string
-	KeyType       string
-	GitUsername   string
-	GitEmail      string
-	SignCommits   bool
+	DirectoryName      string   `json:"directory" yaml:"directory"`
+	Attach             bool     `json:"attach,omitempty" yaml:"attach,omitempty"` // Only attach to an existing directory, never create it
+	KeyType            string   `json:"key_type,omitempty" yaml:"key_type,omitempty"`
+	ECDSACurve         int      `json:"ecdsa_curve,omitempty" yaml:"ecdsa_curve,omitempty"`
+	RSABits            int      `json:"rsa_bits,omitempty" yaml:"rsa_bits,omitempty"` // Size of rsa keys
+	GitUsername        string   `json:"username" yaml:"username"`
+	GitEmail           string   `json:"email" yaml:"email"`
+	AlternateEmails    []string `json:"alternate_emails,omitempty" yaml:"alternate_emails,omitempty"` // Further emails of the identity (--emails), noted in the local config and trusted as signers
+	SignCommits        bool     `json:"sign,omitempty" yaml:"sign,omitempty"`
+	SignScopes         []string `json:"sign_scopes,omitempty" yaml:"sign_scopes,omitempty"`                   // What to sign when SignCommits is set (defaults to commits and tags)
+	SignMethod         string   `json:"sign_method,omitempty" yaml:"sign_method,omitempty"`                   // Sign with an SSH key (default) or a GPG key
+	GPGKey             string   `json:"gpg_key,omitempty" yaml:"gpg_key,omitempty"`                           // Id of the GPG key to sign with (picked from the keyring when empty)
+	GPGProgram         string   `json:"gpg_program,omitempty" yaml:"gpg_program,omitempty"`                   // gpg.program for GPG signing (see defaultGPGProgram when empty)
+	SeparateSigningKey bool     `json:"separate_signing_key,omitempty" yaml:"separate_signing_key,omitempty"` // Sign with a different key than the one used for authentication
+	SigningKey         string   `json:"signing_key,omitempty" yaml:"signing_key,omitempty"`                   // Existing private key to sign with (empty to generate one when SeparateSigningKey is set)
+	IncludeMatch       string   `json:"match,omitempty" yaml:"match,omitempty"`                               // When the identity applies: gitdir, remote or both (see effectiveIncludeMatch)
+	RemoteURL          string   `json:"remote_url,omitempty" yaml:"remote_url,omitempty"`                     // Remote URL glob for hasconfig:remote.*.url matching
+	Branch             string   `json:"branch,omitempty" yaml:"branch,omitempty"`                             // Branch glob for onbranch matching, instead of the directory or remote
+	GitdirPattern      string   `json:"gitdir_pattern,omitempty" yaml:"gitdir_pattern,omitempty"`             // Glob written as the gitdir: condition instead of the directory's own
+	LocalConfig        string   `json:"local_config,omitempty" yaml:"local_config,omitempty"`                 // Where the included config is written, relative to the directory (defaults to .gitconfig)
+	RepoLocal          bool     `json:"repo_local,omitempty" yaml:"repo_local,omitempty"`                     // Include the local .gitconfig from the repository's own config instead of the global one
+	Scope              string   `json:"scope,omitempty" yaml:"scope,omitempty"`                               // Where the identity is written: user, repo or global-only (empty for user)
+	RelativeInclude    bool     `json:"relative_include,omitempty" yaml:"relative_include,omitempty"`         // Write the include path relative to the global config when both are under the home directory
+	TemplateConfig     string   `json:"template_config,omitempty" yaml:"template_config,omitempty"`           // Git config with shared defaults the local config starts from
+	OnConflict         string   `json:"on_conflict,omitempty" yaml:"on_conflict,omitempty"`                   // What to do with an existing local config: overwrite, merge or abort (asked for when empty)
+	OnIncludeConflict  string   `json:"on_include_conflict,omitempty" yaml:"on_include_conflict,omitempty"`   // What to do with an include that loads another file: replace, keep or abort
+	CommitTemplate     string   `json:"commit_template,omitempty" yaml:"commit_template,omitempty"`           // commit.template file, relative to the directory unless absolute or ~/
+	CommitTemplateText string   `json:"commit_template_text,omitempty" yaml:"commit_template_text,omitempty"` // Text to create a missing CommitTemplate from (defaults the file to .gitmessage)
+	Editor             string   `json:"editor,omitempty" yaml:"editor,omitempty"`                             // core.editor for the context (empty to keep git's)
+	AutoCRLF           string   `json:"autocrlf,omitempty" yaml:"autocrlf,omitempty"`                         // core.autocrlf for the context: true, input or false (empty to keep git's)
+	FileMode           string   `json:"filemode,omitempty" yaml:"filemode,omitempty"`                         // core.fileMode for the context: true or false (empty to keep git's)
+	PullRebase         string   `json:"pull_rebase,omitempty" yaml:"pull_rebase,omitempty"`                   // pull.rebase for the context: a boolean, merges or interactive (empty to keep git's)
+	FetchPrune         string   `json:"fetch_prune,omitempty" yaml:"fetch_prune,omitempty"`                   // fetch.prune for the context: a boolean (empty to keep git's)
+	DefaultBranch      string   `json:"default_branch,omitempty" yaml:"default_branch,omitempty"`             // init.defaultBranch for the context (empty to keep git's)
+	HTTPProxy          string   `json:"http_proxy,omitempty" yaml:"http_proxy,omitempty"`                     // http.proxy for the context (empty for none)
+	HTTPProxyURL       string   `json:"http_proxy_url,omitempty" yaml:"http_proxy_url,omitempty"`             // Remote URL to limit HTTPProxy to, as http.<url>.proxy
+	GitProxy           string   `json:"git_proxy,omitempty" yaml:"git_proxy,omitempty"`                       // core.gitProxy command for git:// remotes (empty for none)
+	Passphrase         string   `json:"-" yaml:"-"`                                                           // Never read from or written to files
+	KeyOnly            bool     `json:"-" yaml:"-"`                                                           // Only generate the key (--key-only), no directory or config
+	Auth               string   `json:"auth,omitempty" yaml:"auth,omitempty"`                                 // How to authenticate: ssh or https (empty for ssh)
+	CredentialHelper   string   `json:"credential_helper,omitempty" yaml:"credential_helper,omitempty"`       // credential.helper for https (defaults to the OS keychain or a cache)
+	ExistingKey        string   `json:"existing_key,omitempty" yaml:"existing_key,omitempty"`                 // Private key to reuse instead of generating a new one
+	KeyName            string   `json:"key_name,omitempty" yaml:"key_name,omitempty"`                         // File name of the generated key in ~/.ssh
+	SSHDir             string   `json:"ssh_dir,omitempty" yaml:"ssh_dir,omitempty"`                           // Directory for new keys (defaults to ~/.ssh)
+	KeyComment         string   `json:"key_comment,omitempty" yaml:"key_comment,omitempty"`                   // Comment of the generated key (see keyComment for the default)
+	KDFRounds          int      `json:"kdf_rounds,omitempty" yaml:"kdf_rounds,omitempty"`                     // ssh-keygen -a rounds protecting the passphrase (0 for ssh-keygen's default)
+	NativeKeygen       bool     `json:"native,omitempty" yaml:"native,omitempty"`                             // Generate the key in Go instead of running ssh-keygen
+	SKOptions          []string `json:"sk_options,omitempty" yaml:"sk_options,omitempty"`                     // ssh-keygen -O options for -sk keys (see skOptions)
+	Provider           string   `json:"provider,omitempty" yaml:"provider,omitempty"`                         // Git provider the key is for (defaults to github)
+	ProviderHost       string   `json:"provider_host,omitempty" yaml:"provider_host,omitempty"`               // Host of a custom or self-hosted provider
+	SSHHostAlias       string   `json:"ssh_host_alias,omitempty" yaml:"ssh_host_alias,omitempty"`             // Host alias to add to ~/.ssh/config (empty to skip)
+	SSHHostName        string   `json:"ssh_hostname,omitempty" yaml:"ssh_hostname,omitempty"`                 // Real hostname behind SSHHostAlias (defaults to the provider's host)
+	KnownHostsFile     string   `json:"known_hosts_file,omitempty" yaml:"known_hosts_file,omitempty"`         // Dedicated known_hosts file for core.sshCommand (empty for ssh's default)
+	HostKeyChecking    string   `json:"host_key_checking,omitempty" yaml:"host_key_checking,omitempty"`       // StrictHostKeyChecking for core.sshCommand (empty for ssh's default)
+	TestConnection     bool     `json:"test,omitempty" yaml:"test,omitempty"`                                 // Run ssh -T against the provider after setup
+	TestHost           string   `json:"test_host,omitempty" yaml:"test_host,omitempty"`                       // Host for the connection test (defaults to SSHHostName)
+	GitInit            bool     `json:"git_init,omitempty" yaml:"git_init,omitempty"`                         // Run git init in the directory unless it is already a repository
+	InitialBranch      string   `json:"initial_branch,omitempty" yaml:"initial_branch,omitempty"`             // Branch name for git init -b (empty for git's default)
+	Remote             string   `json:"remote,omitempty" yaml:"remote,omitempty"`                             // URL to add as the origin remote after git init
+	AppendToGitignore  bool     `json:"append_to_gitignore,omitempty" yaml:"append_to_gitignore,omitempty"`   // List the key files and local config inside the repository in its .gitignore
 }
 
-// ANSI color codes (using lipgloss preferred colors where possible)
+// The output styles of the current theme (--theme), assigned by setColor so
+// they can be turned off at runtime; the colors named are the default theme's
 var (
-	styleGood    = lipgloss.NewStyle().Foreground(lipgloss.Color("#04B575")) // Green
-	styleWarn    = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500")) // Orange/Yellow
-	styleInfo    = lipgloss.NewStyle().Foreground(lipgloss.Color("#00BFFF")) // DeepSkyBlue
-	styleKey     = lipgloss.NewStyle().Foreground(lipgloss.Color("#00FFFF")) // Cyan
-	styleError   = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")) // Red
-	stylePath    = lipgloss.NewStyle().Italic(true)                          // Italic for paths
-	styleKeyText = lipgloss.NewStyle().Foreground(lipgloss.Color("#E5E5E5")) // Light gray for key text
+	styleGood    lipgloss.Style // Green
+	styleWarn    lipgloss.Style // Orange/Yellow
+	styleInfo    lipgloss.Style // DeepSkyBlue
+	styleKey     lipgloss.Style // Cyan
+	styleError   lipgloss.Style // Red
+	stylePath    lipgloss.Style // Italic for paths
+	styleKeyText lipgloss.Style // Light gray for key text
+	styleBorder  lipgloss.Style // Green box and table borders
+	boxBorder    lipgloss.Border
+	colorEnabled bool // False once NO_COLOR or --no-color turned color off
 )
 
+// Color is on unless NO_COLOR is set (https://no-color.org); --no-color turns it off too
+func init() {
+	setColor(os.Getenv("NO_COLOR") == "")
+}
+
+// setColor defines the output styles from the current theme. Without color
+// every style is plain and borders are drawn with ASCII characters so logs
+// stay readable.
+func setColor(enabled bool) {
+	colorEnabled = enabled
+	if !enabled {
+		lipgloss.SetColorProfile(termenv.Ascii) // Also covers the huh forms
+		lipgloss.SetHasDarkBackground(true)     // Skip querying the terminal's background color
+		plain := lipgloss.NewStyle()
+		styleGood, styleWarn, styleInfo, styleKey, styleError, stylePath, styleKeyText, styleBorder = plain, plain, plain, plain, plain, plain, plain, plain
+		boxBorder = lipgloss.ASCIIBorder()
+		return
+	}
+	t := newTheme(themeName)
+	styleGood, styleWarn, styleInfo, styleKey, styleError, stylePath, styleKeyText, styleBorder = t.Good, t.Warn, t.Info, t.Key, t.Error, t.Path, t.KeyText, t.Border
+	boxBorder = lipgloss.RoundedBorder()
+}
+
+// keyTypes lists the SSH key types the tool can generate
+var keyTypes = []string{"ed25519", "rsa", "ecdsa", "ed25519-sk", "ecdsa-sk"}
+
+// Security key options, each passed to ssh-keygen as -O <option> for -sk keys
+const (
+	skResident       = "resident"        // Store the key on the token, so ssh-keygen -K can restore it elsewhere
+	skVerifyRequired = "verify-required" // Ask for the token's PIN on every use, not just a touch
+)
+
+// skOptions lists the security key options the tool knows
+var skOptions = []string{skResident, skVerifyRequired}
+
+// ecdsaCurves lists the curve sizes ssh-keygen accepts for ecdsa keys via -b
+var ecdsaCurves = []int{256, 384, 521}
+
+// Signing scopes, each turning on one of commit.gpgsign, tag.gpgsign and push.gpgsign
+const (
+	signScopeCommits = "commits"
+	signScopeTags    = "tags"
+	signScopePushes  = "pushes"
+)
+
+// signScopes lists the signing scopes; defaultSignScopes are used when none are chosen
+var (
+	signScopes        = []string{signScopeCommits, signScopeTags, signScopePushes}
+	defaultSignScopes = []string{signScopeCommits, signScopeTags}
+)
+
+// Include matching modes: by directory (includeIf "gitdir:"), by remote URL
+// (includeIf "hasconfig:remote.*.url:") or both
+const (
+	matchGitdir = "gitdir"
+	matchRemote = "remote"
+	matchBoth   = "both"
+)
+
+// includeMatches lists the include matching modes
+var includeMatches = []string{matchGitdir, matchRemote, matchBoth}
+
+// RSA key sizes: the default and the range ssh-keygen accepts
+const (
+	defaultRSABits = 4096
+	minRSABits     = 2048
+	maxRSABits     = 16384
+)
+
+// rsaKeySizes lists the RSA key sizes offered by the form
+var rsaKeySizes = []int{2048, 3072, 4096, 8192}
+
+// keySize is how the size of a key type is chosen, passed to ssh-keygen as -b
+type keySize struct {
+	flag        string               // Flag (and form question) choosing the size
+	field       string               // Batch file field choosing the size
+	defaultSize int                  // Size used unless another is chosen
+	size        func(*FormData) *int // The field of FormData holding the size
+	validate    func(int) error
+}
+
+// keySizes lists the key types whose size can be chosen. The other types have
+// a fixed size (ed25519 and the -sk types) and get no -b.
+var keySizes = map[string]keySize{
+	"rsa":   {flagRSABits, "rsa_bits", defaultRSABits, func(d *FormData) *int { return &d.RSABits }, validateRSABits},
+	"ecdsa": {flagCurve, "ecdsa_curve", ecdsaCurves[0], func(d *FormData) *int { return &d.ECDSACurve }, validateECDSACurve},
+}
+
+// validateKeySize checks the size of data's key against its type
+func validateKeySize(data FormData) error {
+	if size, ok := keySizes[data.KeyType]; ok {
+		return size.validate(*size.size(&data))
+	}
+	return nil
+}
+
+// defaultLocalConfigName is the file the context's settings are written to
+// inside the directory unless --local-config says otherwise
+const defaultLocalConfigName = ".gitconfig"
+
+// Seams for the outside world, wired to the real implementations and replaced
+// by tests: execCommand builds every external command (execCommandContext
+// those that may time out) and records it in the --log-file, runKeygen runs
+// ssh-keygen and hostOS decides which platform's path rules apply
+var (
+	execCommand        = auditedCommand
+	execCommandContext = auditedCommandContext
+	runKeygen          = runSSHKeygen
+	hostOS             = runtime.GOOS
+)
+
+// defaultKeygenTimeout is how long ssh-keygen may run for keys that need no
+// touch, unless --keygen-timeout says otherwise
+const defaultKeygenTimeout = 2 * time.Minute
+
+// keygenAttempts is how often ssh-keygen is run for a key before giving up on
+// a transient failure
+const keygenAttempts = 3
+
+// keygenRetryDelay is the pause before the first retry, doubled for each one;
+// a variable so tests need not wait
+var keygenRetryDelay = 500 * time.Millisecond
+
 // File modes
 const (
-	dirMode    os.FileMode = 0755
-	sshDirMode os.FileMode = 0700
+	dirMode        os.FileMode = 0755
+	sshDirMode     os.FileMode = 0700
+	configFileMode os.FileMode = 0644
 )
 
 func main() {
-	// Check if this is a version command
-	if len(os.Args) > 1 && os.Args[1] == "version" {
-		fmt.Printf("%s version %s\n", appName, appVersion)
+	// Check for subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "version":
+			exitOnError(runVersion(os.Args[2:]))
+			return
+		case "list":
+			exitOnError(runList(os.Args[2:]))
+			return
+		case "remove":
+			exitOnError(runRemove(os.Args[2:]))
+			return
+		case "show":
+			exitOnError(runShow(os.Args[2:]))
+			return
+		case "status":
+			exitOnError(runStatus(os.Args[2:]))
+			return
+		case "doctor":
+			exitOnError(runDoctor(os.Args[2:]))
+			return
+		case "clean":
+			exitOnError(runClean(os.Args[2:]))
+			return
+		case "edit":
+			exitOnError(runEdit(os.Args[2:]))
+			return
+		case "export":
+			exitOnError(runExport(os.Args[2:]))
+			return
+		case "rotate":
+			exitOnError(runRotate(os.Args[2:]))
+			return
+		case "completion":
+			exitOnError(runCompletion(os.Args[2:]))
+			return
+		}
+	}
+
+	data, opts, set, err := parseFlags(os.Args[1:])
+	exitOnError(usageError(err))
+	if errors.Is(err, flag.ErrHelp) {
 		return
 	}
 
-	var data FormData
-	keyTypes := []string{"ed25519", "rsa"} // Consider adding ecdsa if desired
-
-	// --- Form Definition (unchanged) ---
-	form := huh.NewForm(
-		huh.NewGroup(
-			huh.NewInput().
-				Title("Directory Name").
-				Description("Enter the name of the directory to create or use (e.g., github-personal, work-project)"). // Updated description
-				Placeholder("projects").
-				Value(&data.DirectoryName).
-				Validate(func(s string) error {
-					if s == "" {
-						return fmt.Errorf("directory name cannot be empty")
-					}
-					// Basic check for invalid path characters (OS dependent, but covers common cases)
-					if strings.ContainsAny(s, `/\:*?"<>|`) {
-						return fmt.Errorf("directory name contains invalid characters")
-					}
-					return nil
-				}),
-
-			huh.NewSelect[string]().
-				Title("SSH Key Type").
-				Description("Select the SSH key type (ed25519 recommended)").
-				Options(
-					huh.NewOptions(keyTypes...)...,
-				).
-				Value(&data.KeyType),
-
-			huh.NewInput().
-				Title("Git Username").
-				Description("Enter the Git username for this context").
-				Placeholder("username").
-				Value(&data.GitUsername).
-				Validate(func(s string) error {
-					if s == "" {
-						return fmt.Errorf("git username cannot be empty")
-					}
-					return nil
-				}),
-
-			huh.NewInput().
-				Title("Git Email").
-				Description("Enter the Git email for this context").
-				Placeholder("user@example.com").
-				Value(&data.GitEmail).
-				Validate(func(s string) error {
-					// Basic email format check
-					if s == "" || !strings.Contains(s, "@") || !strings.Contains(s, ".") {
-						return fmt.Errorf("please enter a valid email address")
-					}
-					return nil
-				}),
-
-			huh.NewConfirm().
-				Title("Sign Commits?").
-				Description("Sign Git commits using this SSH key? (Requires Git 2.34+)").
-				Value(&data.SignCommits),
-		),
-	)
-
-	err := form.Run()
-	if err != nil {
-		// Check for specific error types if needed (e.g., huh.ErrUserAborted)
-		fmt.Fprintf(os.Stderr, "%s Form cancelled or failed: %v\n", styleError.Render("Error:"), err)
-		os.Exit(1)
+	if opts.LogFile != "" {
+		exitOnError(openAuditLog(opts.LogFile))
+	}
+
+	if opts.ResetDefaults {
+		exitOnError(resetLastValues())
+		logInfo(styleInfo.Render("Forgot the remembered form values"))
+		if len(set) == 1 {
+			return
+		}
+	}
+
+	// Batch mode takes every context from a file and never prompts
+	if opts.FromFile != "" {
+		exitOnError(runBatch(opts.FromFile, opts))
+		return
+	}
+
+	// An imported key is only shown, copied and uploaded, unless its private key
+	// is given too, in which case setup continues with that key
+	if opts.ImportPubkey != "" {
+		imported, err := readImportedKey(opts.ImportPubkey)
+		exitOnError(err)
+		if data.ExistingKey == "" {
+			exitOnError(runImport(imported, data, opts))
+			return
+		}
+		exitOnError(imported.checkMatches(data.ExistingKey))
+	}
+
+	if opts.EmailFromGit {
+		applyGlobalIdentity(&data)
+	}
+
+	// Only fall back to the interactive form when required values are missing
+	missing := missingRequiredFlags(data)
+	if len(missing) > 0 && opts.NonInteractive {
+		exitOnError(usageError(fmt.Errorf("missing required flags: %s", strings.Join(missing, ", "))))
+	}
+	// --key-only needs no flags, so its form is shown whenever prompting is allowed
+	formShown := len(missing) > 0 || (data.KeyOnly && !opts.NonInteractive)
+
+	// Fail early if a required tool is missing, before the user fills in the form
+	exitOnError(checkDependencies(data, set[flagKeyType] || !formShown, set[flagSign] || !formShown))
+
+	if formShown {
+		// Start from the answers of the last run, e.g. for sibling directories of one account
+		if !opts.NoRemember {
+			if last, ok := loadLastValues(); ok {
+				// Values from GITCONFIG_* variables outrank the remembered ones
+				keep := maps.Clone(set)
+				for _, name := range opts.EnvDefaults {
+					keep[name] = true
+				}
+				applyLastValues(&data, last, keep)
+			}
+		}
+		// Failing that, offer the identity of the global config
+		if !data.KeyOnly {
+			applyGlobalIdentity(&data)
+		}
+		exitOnError(fillForm(&data, set))
+	}
+
+	// Show what is about to happen and let the user go back and change answers
+	// before anything is touched
+	if formShown && !opts.DryRun && !opts.AssumeYes && !data.KeyOnly {
+		for {
+			generatedKeyName := data.KeyName == ""
+			if generatedKeyName {
+				data.KeyName = contextKeyName(data)
+			}
+			choice, err := confirmSummary(data)
+			exitOnError(err)
+			if choice == reviewApply {
+				break
+			}
+			if choice == reviewCancel {
+				fmt.Println(styleInfo.Render("Aborted, nothing was changed."))
+				os.Exit(exitAborted)
+			}
+			// The generated name follows the directory, which may change
+			if generatedKeyName {
+				data.KeyName = ""
+			}
+			exitOnError(fillForm(&data, set))
+		}
 	}
 
 	// Process the form data
-	messages, err := processFormData(data)
-	if err != nil {
-		// Log error clearly before exiting
-		fmt.Fprintf(os.Stderr, "%s %v\n", styleError.Render("Error:"), err)
-		os.Exit(1)
+	result, err := processFormData(data, opts)
+	exitOnError(err)
+	if !opts.DryRun && !opts.NoRemember {
+		if err := saveLastValues(data); err != nil {
+			logWarn("could not remember the answers: %v", err)
+		}
+	}
+
+	// Uploading saves the user from pasting the key into the provider's settings.
+	// It does not depend on --pubkey-out, so a failed write does not skip it.
+	var pubkeyOutErr, uploadErr error
+	if opts.PubkeyOut != "" && !opts.DryRun {
+		pubkeyOutErr = writePubkeyOut(result, result.PublicKey, opts.PubkeyOut)
+	}
+	if opts.GitHubUpload && !opts.DryRun && githubUploadApplies(data) {
+		uploadErr = uploadToGitHub(result, githubToken(opts))
+	}
+
+	// The connection test only makes sense once the key is on the provider, so
+	// interactive runs show the key first, wait for the user (unless it was
+	// uploaded) and let them retry until the key is accepted
+	if data.TestConnection && !opts.DryRun {
+		wait := opts.Output == outputText && !opts.AssumeYes && !opts.NonInteractive && len(result.GitHubKeys) == 0 && term.IsTerminal(int(os.Stdin.Fd()))
+		if wait {
+			exitOnError(printSetupResult(result, opts.Output))
+			exitOnError(runConnectionTest(result, true))
+			exitOnError(errors.Join(pubkeyOutErr, uploadErr))
+			return
+		}
+		exitOnError(runConnectionTest(result, false))
+	}
+
+	exitOnError(printSetupResult(result, opts.Output))
+	exitOnError(errors.Join(pubkeyOutErr, uploadErr))
+}
+
+// fillForm runs the form for the values not passed as flags and re-checks the
+// dependencies that depend on the answers
+func fillForm(data *FormData, set map[string]bool) error {
+	if err := runForm(data, set); err != nil {
+		return fmt.Errorf("Form cancelled or failed: %w", err)
 	}
+	return checkDependencies(*data, !set[flagKeyType], !set[flagSign])
+}
+
+// Box width limits; the width includes the padding but not the border
+const (
+	defaultBoxWidth = 80  // Used when stdout is not a terminal
+	maxBoxWidth     = 120 // Wider boxes are hard to read
+	minBoxWidth     = 20
+)
+
+// minBorderColumns is the narrowest terminal the box is drawn in; below it
+// the border and padding take too much room and messages are printed plainly
+const minBorderColumns = 50
+
+// widthOverride is the box width set with --width (0 to follow the terminal)
+var widthOverride int
+
+// noBorder is set by --no-border to print messages without the box
+var noBorder bool
+
+// terminalColumns returns the width of the terminal on stdout, or 0 when
+// stdout is not a terminal
+func terminalColumns() int {
+	columns, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || columns <= 0 {
+		return 0
+	}
+	return columns
+}
+
+// boxWidth returns the width for printBorderedMessages: --width if given,
+// otherwise the terminal width minus the border, capped at maxBoxWidth
+func boxWidth() int {
+	if widthOverride > 0 {
+		return widthOverride
+	}
+	columns := terminalColumns()
+	if columns == 0 {
+		return defaultBoxWidth
+	}
+	return max(min(columns-2, maxBoxWidth), minBoxWidth)
+}
+
+// longestWord returns the display width of the longest run of non-space
+// characters in content, such as a public key
+func longestWord(content string) int {
+	longest := 0
+	for _, word := range strings.Fields(ansi.Strip(content)) {
+		longest = max(longest, ansi.StringWidth(word))
+	}
+	return longest
+}
 
-	printBorderedMessages(messages)
+// wrapOnSpaces wraps the lines of content that are wider than width, breaking
+// only between words. A line with a word longer than width, like a public key,
+// is left unwrapped so it can still be copied in one piece.
+func wrapOnSpaces(content string, width int) string {
+	wrapped := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		if ansi.StringWidth(line) <= width || longestWord(line) > width {
+			wrapped = append(wrapped, line)
+			continue
+		}
+		current, currentWidth := "", 0
+		for _, word := range strings.Fields(line) {
+			wordWidth := ansi.StringWidth(word)
+			if currentWidth > 0 && currentWidth+1+wordWidth > width {
+				wrapped = append(wrapped, current)
+				current, currentWidth = "", 0
+			}
+			if currentWidth > 0 {
+				current += " "
+				currentWidth++
+			}
+			current += word
+			currentWidth += wordWidth
+		}
+		wrapped = append(wrapped, current)
+	}
+	return strings.Join(wrapped, "\n")
 }
 
-// printBorderedMessages prints all messages with a styled border
+// printBorderedMessages prints all messages with a styled border. Without a
+// border (--no-border, a terminal narrower than minBorderColumns, or a word
+// too long for the box) they are indented and wrapped on spaces instead.
 func printBorderedMessages(messages []string) {
-	width := 80 // Keep fixed width for simplicity, adjust if needed
+	width := boxWidth()
+
+	// Join messages with newlines for rendering within the box
+	content := strings.Join(messages, "\n")
+
+	columns := terminalColumns()
+	narrow := widthOverride == 0 && columns > 0 && columns < minBorderColumns
+	if noBorder || narrow || longestWord(content) > width-4 {
+		if columns > 0 && widthOverride == 0 {
+			width = columns
+		}
+		fmt.Println()
+		for _, line := range strings.Split(wrapOnSpaces(content, width-2), "\n") {
+			fmt.Println(strings.TrimRight("  "+line, " "))
+		}
+		fmt.Println()
+		return
+	}
 
 	boxStyle := lipgloss.NewStyle().
-		BorderStyle(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("#04B575")). // Green border
+		BorderStyle(boxBorder).
+		BorderForeground(styleBorder.GetForeground()).
 		Padding(1, 2).
 		Width(width).
 		Align(lipgloss.Left)
 
-	// Join messages with newlines for rendering within the box
-	content := strings.Join(messages, "\n")
-
 	fmt.Println() // Add spacing before the box
 	fmt.Println(boxStyle.Render(content))
 	fmt.Println() // Add spacing after the box
 }
 
 // processFormData handles the core logic: dir creation/check, keygen, config updates
-func processFormData(data FormData) ([]string, error) {
-	messages := []string{}
+func processFormData(data FormData, opts cliOptions) (result *setupResult, err error) {
+	audit(auditEvent{Event: auditStart, Directory: data.DirectoryName})
+	defer func() {
+		switch {
+		case err != nil:
+			audit(auditEvent{Event: auditError, Directory: data.DirectoryName, Error: err.Error()})
+		case opts.DryRun:
+			audit(auditEvent{Event: auditDone, Directory: data.DirectoryName, Message: "dry run, nothing changed"})
+		default:
+			audit(auditEvent{Event: auditDone, Directory: data.DirectoryName})
+		}
+	}()
+
+	if data.KeyOnly {
+		return generateKeyOnly(data, opts)
+	}
 
 	// 1. Check/Create the target directory
-	cwd, err := os.Getwd()
+	absPath, err := contextDir(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get current directory: %w", err)
+		return nil, err
 	}
-	dirPath := filepath.Join(cwd, data.DirectoryName)
-	absPath, err := filepath.Abs(dirPath)
+	if err := checkScopeDir(absPath, data); err != nil {
+		return nil, err
+	}
+	if data.GitdirPattern != "" {
+		if warning := gitdirPatternWarning(data.GitdirPattern); warning != "" {
+			logWarn("%s", warning)
+		}
+	}
+	if warning := proxyWarning(data); warning != "" {
+		logWarn("%s", warning)
+	}
+	if data.Attach {
+		if err := checkAttachDir(absPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if data.KeyName == "" {
+		data.KeyName = contextKeyName(data)
+	}
+	if signsWithGPG(data) && data.GPGKey == "" {
+		if data.GPGKey, err = defaultGPGKey(data.GPGProgram, data.GitEmail); err != nil {
+			return nil, err
+		}
+	}
+	if signsWithGPG(data) && data.GPGProgram == "" {
+		data.GPGProgram = defaultGPGProgram()
+	}
+	if opts.DryRun {
+		plan, dump, err := planFormData(data, absPath, opts)
+		if err != nil {
+			return nil, err
+		}
+		result := &setupResult{DryRun: true, Plan: plan, ConfigDump: dump, data: data}
+		if opts.PrintSSHConfig && !usesHTTPS(data) {
+			privateKeyPath := data.ExistingKey
+			if privateKeyPath == "" {
+				if _, privateKeyPath, _, err = sshKeyPaths(data.SSHDir, data.KeyName); err != nil {
+					return nil, err
+				}
+			}
+			result.SSHConfigSnippet = sshConfigSnippet(data, privateKeyPath)
+		}
+		return result, nil
+	}
+
+	result = &setupResult{Directory: absPath, data: data}
+
+	// Settle what happens to an existing local config before changing anything;
+	// the other scopes write into a config that is there already
+	scope := effectiveScope(data)
+	var localConfigPath, conflictAction string
+	if scope == scopeUser {
+		if localConfigPath, err = localConfigFile(absPath, data); err != nil {
+			return nil, err
+		}
+		if conflictAction, err = resolveLocalConfigConflict(localConfigPath, data, opts); err != nil {
+			return nil, err
+		}
+	}
+	commitTemplatePath, err := commitTemplateFile(absPath, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get absolute path for '%s': %w", dirPath, err)
+		return nil, err
 	}
+	if commitTemplatePath != "" {
+		if err := checkCommitTemplate(commitTemplatePath, data.CommitTemplateText); err != nil {
+			return nil, err
+		}
+	}
+
+	// Don't quietly change the identity of a repository that already has one,
+	// unless the identity is meant to go into that repository or the global config
+	if conflict := identityConflict(absPath, data.GitEmail); conflict != "" && scope == scopeUser {
+		if err := confirmIdentityConflict(conflict, opts); err != nil {
+			return nil, err
+		}
+		result.IdentityWarning = conflict
+	}
+
+	// Record every change so a later failure can undo the earlier steps
+	var undo rollback
+	defer func() {
+		if err != nil {
+			err = undo.finish(err, opts.KeepOnError, opts.AssumeYes || opts.NonInteractive)
+		}
+	}()
 
 	// Check if directory already exists
+	logStep("Checking directory %s", stylePath.Render(absPath))
 	if _, err := os.Stat(absPath); err == nil {
-		messages = append(messages, styleInfo.Render("Directory already exists:")+" "+stylePath.Render(absPath))
 		// Directory exists, continue without creating
 	} else if os.IsNotExist(err) {
 		// Directory does not exist, create it
+		createdDir := firstMissingDir(absPath)
 		err = os.MkdirAll(absPath, dirMode)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create directory '%s': %w", stylePath.Render(absPath), err)
 		}
-		messages = append(messages, styleInfo.Render("Created directory:")+" "+stylePath.Render(absPath))
+		result.DirectoryCreated = true
+		logDetail("created %s", stylePath.Render(absPath))
+		undo.add("created directory "+createdDir, func() error { return os.RemoveAll(createdDir) })
 	} else {
 		// Some other error occurred while checking directory status
 		return nil, fmt.Errorf("failed to check directory status '%s': %w", stylePath.Render(absPath), err)
 	}
 
-	// 2. Generate SSH Key
-	// This function checks for existing key files and will error out if they exist.
-	// This prevents accidental overwriting of existing keys.
-	keyName := fmt.Sprintf("%s-%s", data.DirectoryName, uuid.New().String())
-	privateKeyPath, publicKeyPath, err := generateSSHKey(data.KeyType, keyName)
+	// 2-5. The SSH key; HTTPS contexts authenticate with the credential helper instead
+	paths, signingPublicKey := configPaths{}, ""
+	if usesHTTPS(data) {
+		result.CredentialHelper = credentialHelper(data)
+	} else if paths, signingPublicKey, err = prepareSSHKeys(data, opts, result, &undo); err != nil {
+		return nil, err
+	}
+
+	// Keep this context's host keys apart when asked to
+	if data.KnownHostsFile != "" {
+		logStep("Preparing known hosts file %s", stylePath.Render(data.KnownHostsFile))
+		created, err := ensureKnownHostsFile(data.KnownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			knownHostsFile := data.KnownHostsFile
+			undo.add("created known hosts file "+knownHostsFile, func() error { return os.Remove(knownHostsFile) })
+		}
+		paths.KnownHosts = styledPath(data.KnownHostsFile)
+		result.KnownHostsCreated = created
+	}
+
+	// Register the signing key as a trusted signer so git can verify our own signatures
+	if signsWithSSH(data) {
+		allowedSignersFile, err := allowedSignersPath()
+		if err != nil {
+			return nil, err
+		}
+		logStep("Adding the signer to %s", stylePath.Render(allowedSignersFile))
+		restoreSigners, err := backupFile(allowedSignersFile)
+		if err != nil {
+			return nil, err
+		}
+		// Signatures made under any of the identity's emails should verify
+		for _, email := range identityEmails(data) {
+			allowedSignersFile, added, err := addAllowedSigner(email, signingPublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update allowed signers: %w", err)
+			}
+			if added && !result.SignerAdded {
+				undo.add("added signer to "+allowedSignersFile, restoreSigners)
+			}
+			paths.AllowedSigners = styledPath(allowedSignersFile)
+			result.AllowedSignersPath, result.SignerAdded = allowedSignersFile, result.SignerAdded || added
+		}
+	}
+
+	// The commit message template, created from the given text if missing
+	if commitTemplatePath != "" {
+		logStep("Preparing commit template %s", stylePath.Render(commitTemplatePath))
+		created, err := writeCommitTemplate(commitTemplatePath, data.CommitTemplateText)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			undo.add("created commit template "+commitTemplatePath, func() error { return os.Remove(commitTemplatePath) })
+		}
+		paths.CommitTemplate = styledPath(commitTemplatePath)
+		result.CommitTemplatePath, result.TemplateCreated = commitTemplatePath, created
+	}
+
+	// 6-7. The repo and global-only scopes set the keys in a config that
+	// exists, so a repository has to be created first
+	if scope != scopeUser {
+		if scope == scopeRepo && data.GitInit {
+			if err := initContextRepo(absPath, data, result, &undo); err != nil {
+				return nil, err
+			}
+		}
+		if result.ScopeConfigPath, err = scopeConfigPath(absPath, data); err != nil {
+			return nil, err
+		}
+		logStep("Writing the identity into %s", stylePath.Render(result.ScopeConfigPath))
+		restoreScoped, err := backupFile(result.ScopeConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		undo.add("updated "+result.ScopeConfigPath, restoreScoped)
+		if err := writeScopedConfig(result.ScopeConfigPath, data, paths); err != nil {
+			return nil, err
+		}
+		result.Scope = scope
+	} else {
+		// 6. Create/Update local .gitconfig, replacing or merging into an existing
+		// one as decided above, and 7. include it from the global .gitconfig
+		logStep("Writing local .gitconfig %s", stylePath.Render(localConfigPath))
+		if err := writeLocalConfig(absPath, localConfigPath, conflictAction, data, opts, paths, result, &undo); err != nil {
+			return nil, err
+		}
+	}
+
+	// 8. Add a Host block to ~/.ssh/config
+	if data.SSHHostAlias != "" {
+		logStep("Adding Host %s to the ssh config", data.SSHHostAlias)
+		sshDir, err := defaultSSHDir()
+		if err != nil {
+			return nil, err
+		}
+		restoreSSHConfig, err := backupFile(filepath.Join(sshDir, "config"))
+		if err != nil {
+			return nil, err
+		}
+		result.SSHConfigPath, result.SSHHostAdded, err = updateSSHConfig(data.SSHHostAlias, sshHostName(data), paths.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update ssh config: %w", err)
+		}
+		if result.SSHHostAdded {
+			undo.add("added Host "+data.SSHHostAlias+" to "+result.SSHConfigPath, restoreSSHConfig)
+		}
+	}
+	// Point out Host blocks whose keys the sshCommand quietly takes precedence over
+	if !usesHTTPS(data) {
+		result.SSHConfigWarning = sshConfigConflictWarning(data)
+	}
+
+	// 9. Initialize a repository so the includeIf applies right away
+	if data.GitInit && scope != scopeRepo {
+		if err := initContextRepo(absPath, data, result, &undo); err != nil {
+			return nil, err
+		}
+	}
+
+	// Include the local .gitconfig from the repository itself, now that it exists
+	if scope == scopeUser && useRepoConfig(absPath, data) {
+		repoConfig, err := repoConfigPath(absPath)
+		if err != nil {
+			return nil, err
+		}
+		logStep("Including the local .gitconfig from %s", stylePath.Render(repoConfig))
+		restoreRepo, err := backupFile(repoConfig)
+		if err != nil {
+			return nil, err
+		}
+		result.RepoConfigPath, result.RepoIncludeAdded, err = addRepoInclude(absPath, result.LocalConfigPath, data.Branch)
+		if err != nil {
+			return nil, err
+		}
+		if result.RepoIncludeAdded {
+			undo.add("added include to "+repoConfig, restoreRepo)
+		}
+	}
+
+	// Keep the key files and local config out of the repository they are in
+	if data.AppendToGitignore {
+		root, _, _, ok := enclosingRepo(absPath)
+		entries := []string{}
+		if ok {
+			entries = gitignoreEntries(root, []string{result.PrivateKeyPath, result.PublicKeyPath,
+				result.SigningPrivateKeyPath, result.SigningPublicKeyPath, result.LocalConfigPath})
+		}
+		if len(entries) == 0 {
+			logDetail("no files of the context are inside a git repository, .gitignore left alone")
+		} else {
+			gitignorePath := filepath.Join(root, ".gitignore")
+			logStep("Adding the context's files to %s", stylePath.Render(gitignorePath))
+			restoreGitignore, err := backupFile(gitignorePath)
+			if err != nil {
+				return nil, err
+			}
+			result.GitignoreAdded, err = appendToGitignore(root, entries)
+			if err != nil {
+				return nil, err
+			}
+			if len(result.GitignoreAdded) > 0 {
+				undo.add("added entries to "+gitignorePath, restoreGitignore)
+			}
+			result.GitignorePath = gitignorePath
+		}
+	}
+
+	// 10. Add the origin remote, leaving an existing one alone
+	if data.Remote != "" {
+		logStep("Adding remote origin %s", data.Remote)
+		result.OriginAdded, result.OriginExisting, err = addOrigin(absPath, data.Remote)
+		if err != nil {
+			return nil, err
+		}
+		if result.OriginAdded {
+			undo.add("added remote origin "+data.Remote, func() error {
+				return execCommand("git", "-C", absPath, "remote", "remove", "origin").Run()
+			})
+		}
+		result.RemoteWarning = remoteHostWarning(data)
+	}
+
+	// 11. Load the keys into ssh-agent, once nothing can be rolled back anymore
+	if opts.AddToAgent {
+		logStep("Adding the key to ssh-agent")
+		for _, keyPath := range []string{result.PrivateKeyPath, result.SigningPrivateKeyPath} {
+			if keyPath == "" {
+				continue
+			}
+			result.Agent, result.AgentError = addToAgent(keyPath, data.Passphrase != "")
+			if result.Agent != agentAdded {
+				break
+			}
+		}
+	}
+
+	// Show what was written, read back from the files
+	if opts.DumpConfig {
+		dump, dumpErr := dumpWrittenConfig(result, data)
+		if dumpErr != nil {
+			logWarn("could not read back the written config: %v", dumpErr)
+		}
+		result.ConfigDump = dump
+	}
+	if opts.PrintSSHConfig && result.PrivateKeyPath != "" {
+		result.SSHConfigSnippet = sshConfigSnippet(data, result.PrivateKeyPath)
+	}
+
+	return result, nil
+}
+
+// writeLocalConfig writes the local .gitconfig of the user scope (step 6 of
+// processFormData) and includes it from the global config (step 7), unless
+// the repository includes it from its own config instead
+func writeLocalConfig(absPath, localConfigPath, conflictAction string, data FormData, opts cliOptions, paths configPaths, result *setupResult, undo *rollback) error {
+	// A --local-config outside the directory may need a directory of its own
+	if configDir := filepath.Dir(localConfigPath); !isDir(configDir) {
+		createdDir := firstMissingDir(configDir)
+		if err := os.MkdirAll(configDir, dirMode); err != nil {
+			return fmt.Errorf("failed to create directory '%s': %w", stylePath.Render(configDir), err)
+		}
+		undo.add("created directory "+createdDir, func() error { return os.RemoveAll(createdDir) })
+	}
+	if err := checkWritableDir(filepath.Dir(localConfigPath)); err != nil {
+		return err
+	}
+	restoreLocal, err := backupFile(localConfigPath)
 	if err != nil {
-		// Attempt cleanup on failure? Maybe too complex for this script.
-		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+		return err
+	}
+	result.LocalConfigPath, err = createLocalGitConfig(localConfigPath, data, paths, conflictAction == conflictMerge)
+	if err != nil {
+		return fmt.Errorf("failed to create local .gitconfig: %w", err)
+	}
+	switch conflictAction {
+	case conflictMerge:
+		result.LocalConfigAction = localConfigMerged
+	case conflictOverwrite:
+		result.LocalConfigAction = localConfigOverwritten
+	default:
+		result.LocalConfigAction = localConfigCreated
+	}
+	undo.add("wrote local .gitconfig "+result.LocalConfigPath, restoreLocal)
+
+	// 7. Update global .gitconfig
+	// This function loads the existing global config and adds the includeIf directive if it doesn't exist.
+	// A repository included from its own config (step 9) leaves the global config alone.
+	if !useRepoConfig(absPath, data) {
+		globalGitConfigPath, err := resolveGlobalGitConfigPath()
+		if err != nil {
+			return err
+		}
+		logStep("Updating global .gitconfig %s", stylePath.Render(globalGitConfigPath))
+		restoreGlobal, err := backupFile(globalGitConfigPath)
+		if err != nil {
+			return err
+		}
+		result.GlobalConfigPath, result.IncludeKept, err = updateGlobalGitConfig(absPath, localConfigPath, data, opts.AssumeYes)
+		if err != nil {
+			return fmt.Errorf("failed to update global .gitconfig: %w", err)
+		}
+		undo.add("updated global .gitconfig "+result.GlobalConfigPath, restoreGlobal)
+	}
+	return nil
+}
+
+// prepareSSHKeys generates or reuses the SSH keys of a context (steps 2 to 5
+// of processFormData), recording them in result and undo. It returns the key
+// paths for the git config and the public key to sign with.
+func prepareSSHKeys(data FormData, opts cliOptions, result *setupResult, undo *rollback) (configPaths, string, error) {
+	var err error
+	if warning := providerKeyWarning(data); warning != "" {
+		logWarn("%s", warning)
+	}
+	// 2. Generate SSH Key (or reuse the one the user picked)
+	if data.ExistingKey != "" {
+		if err := validateExistingKey(data.ExistingKey); err != nil {
+			return configPaths{}, "", err
+		}
+		result.PrivateKeyPath, result.PublicKeyPath = data.ExistingKey, data.ExistingKey+".pub"
+		logStep("Using existing SSH key %s", stylePath.Render(data.ExistingKey))
+	} else {
+		// This function checks for existing key files and will error out if they exist.
+		// This prevents accidental overwriting of existing keys.
+		result.PrivateKeyPath, result.PublicKeyPath, err = generateSSHKey(data, data.KeyName, opts.KeygenTimeout)
+		if err != nil {
+			return configPaths{}, "", fmt.Errorf("failed to generate SSH key: %w", err)
+		}
+		result.KeyGenerated = true
+		privateKeyPath, publicKeyPath := result.PrivateKeyPath, result.PublicKeyPath
+		undo.add("generated SSH key "+privateKeyPath, func() error {
+			return errors.Join(os.Remove(privateKeyPath), os.Remove(publicKeyPath))
+		})
+	}
+
+	// A separate signing key is picked or generated the same way
+	if signsWithSSH(data) && data.SeparateSigningKey {
+		if data.SigningKey != "" {
+			if err := validateExistingKey(data.SigningKey); err != nil {
+				return configPaths{}, "", err
+			}
+			result.SigningPrivateKeyPath, result.SigningPublicKeyPath = data.SigningKey, data.SigningKey+".pub"
+			logStep("Signing with existing key %s", stylePath.Render(data.SigningKey))
+		} else {
+			result.SigningPrivateKeyPath, result.SigningPublicKeyPath, err = generateSSHKey(data, signingKeyName(data.KeyName), opts.KeygenTimeout)
+			if err != nil {
+				return configPaths{}, "", fmt.Errorf("failed to generate signing key: %w", err)
+			}
+			result.SigningKeyGenerated = true
+			privateKeyPath, publicKeyPath := result.SigningPrivateKeyPath, result.SigningPublicKeyPath
+			undo.add("generated signing key "+privateKeyPath, func() error {
+				return errors.Join(os.Remove(privateKeyPath), os.Remove(publicKeyPath))
+			})
+		}
+		signingKeyContent, err := os.ReadFile(result.SigningPublicKeyPath)
+		if err != nil {
+			return configPaths{}, "", fmt.Errorf("failed to read public key '%s': %w", stylePath.Render(result.SigningPublicKeyPath), err)
+		}
+		result.SigningPublicKey = strings.TrimSpace(string(signingKeyContent))
+		if fingerprint, err := publicKeyFingerprint(result.SigningPublicKeyPath); err == nil {
+			result.SigningFingerprint = fingerprint
+		}
 	}
-	messages = append(messages, styleKey.Render("Generated SSH key:")+" "+stylePath.Render(privateKeyPath))
 
 	// 3. Read public key content
-	publicKeyContentBytes, err := os.ReadFile(publicKeyPath)
+	publicKeyContentBytes, err := os.ReadFile(result.PublicKeyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read public key '%s': %w", stylePath.Render(publicKeyPath), err)
+		return configPaths{}, "", fmt.Errorf("failed to read public key '%s': %w", stylePath.Render(result.PublicKeyPath), err)
 	}
 	publicKeyContent := string(publicKeyContentBytes)
+	result.PublicKey = strings.TrimSpace(publicKeyContent)
+	if fingerprint, err := publicKeyFingerprint(result.PublicKeyPath); err == nil {
+		result.Fingerprint = fingerprint
+	}
 
 	// 4. Try to copy public key to clipboard
-	clipboardErr := clipboard.WriteAll(publicKeyContent)
+	if !opts.NoClipboard {
+		logStep("Copying the public key to the clipboard")
+		copyPublicKey(result, publicKeyContent, opts)
+	}
 
 	// 5. Prepare paths for Git config (Git often needs POSIX-style paths)
-	linuxPrivateKeyPath := convertToLinuxPath(privateKeyPath)
-	linuxPublicKeyPath := convertToLinuxPath(publicKeyPath)
-
-	// 6. Create/Update local .gitconfig
-	// This function uses ini.Empty() and then saves, effectively overwriting or creating the file.
-	// If you wanted to *merge* with an existing local config, you'd need to load it first.
-	// For this script's purpose (setting specific user/key for a directory), overwriting is intended.
-	localGitConfigPath, err := createLocalGitConfig(absPath, data, linuxPrivateKeyPath, linuxPublicKeyPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create local .gitconfig: %w", err)
+	paths := configPaths{
+		PrivateKey: styledPath(result.PrivateKeyPath),
+		PublicKey:  styledPath(result.PublicKeyPath),
+	}
+	signingPublicKey := publicKeyContent
+	if result.SigningPublicKeyPath != "" {
+		paths.SigningKey = styledPath(result.SigningPublicKeyPath)
+		signingPublicKey = result.SigningPublicKey
 	}
-	messages = append(messages, styleWarn.Render("Created/Updated local .gitconfig:")+" "+stylePath.Render(localGitConfigPath)) // Updated message
+	return paths, signingPublicKey, nil
+}
 
-	// 7. Update global .gitconfig
-	// This function loads the existing global config and adds the includeIf directive if it doesn't exist.
-	globalGitConfigPath, err := updateGlobalGitConfig(absPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update global .gitconfig: %w", err)
+// sshKeyPaths returns the key directory and the private/public key paths for
+// keyName, in keyDir or ~/.ssh when keyDir is empty
+func sshKeyPaths(keyDir, keyName string) (string, string, string, error) {
+	sshDir := keyDir
+	if sshDir == "" {
+		var err error
+		if sshDir, err = defaultSSHDir(); err != nil {
+			return "", "", "", err
+		}
+	}
+
+	// Ensure keyName is filesystem-safe (though directory name validation helps)
+	safeKeyName := strings.ReplaceAll(keyName, string(filepath.Separator), "_")
+	privateKeyPath := filepath.Join(sshDir, safeKeyName)
+	return sshDir, privateKeyPath, privateKeyPath + ".pub", nil
+}
+
+// sshKeygenArgs builds the ssh-keygen arguments for generating a key at privateKeyPath
+func sshKeygenArgs(data FormData, privateKeyPath string) []string {
+	keygenArgs := []string{
+		"-t", data.KeyType,
+		"-f", privateKeyPath, // Use the platform-native path for the -f argument
+		"-N", data.Passphrase, // Empty means no passphrase
+		"-C", keyComment(data, privateKeyPath),
+	}
+	if size, ok := keySizes[data.KeyType]; ok {
+		keygenArgs = append(keygenArgs, "-b", strconv.Itoa(*size.size(&data)))
 	}
-	messages = append(messages, styleWarn.Render("Updated global .gitconfig:")+" "+stylePath.Render(globalGitConfigPath))
+	if data.KDFRounds > 0 {
+		keygenArgs = append(keygenArgs, "-a", strconv.Itoa(data.KDFRounds))
+	}
+	if isSecurityKeyType(data.KeyType) {
+		for _, option := range data.SKOptions {
+			keygenArgs = append(keygenArgs, "-O", option)
+		}
+	}
+	return keygenArgs
+}
 
-	// --- Format Final Output Messages ---
-	messages = append(messages, "") // Separator
-	messages = append(messages, styleGood.Render("Setup completed successfully!"))
-	messages = append(messages, "")
-	messages = append(messages, styleKey.Render("Your SSH Public Key:"))
-	messages = append(messages, styleKeyText.Render(strings.TrimSpace(publicKeyContent))) // Trim whitespace
+// defaultKeyName returns a unique key file name for the directory
+func defaultKeyName(directoryName string) string {
+	return fmt.Sprintf("%s-%s", filepath.Base(directoryName), uuid.New().String())
+}
 
-	// Clipboard status message
-	if clipboardErr == nil {
-		messages = append(messages, "") // Seperator
-		messages = append(messages, styleGood.Render("Public key copied to clipboard"))
-	} else {
-		messages = append(messages, styleWarn.Render(fmt.Sprintf("Could not copy public key to clipboard: %v", clipboardErr)))
+// isDefaultKeyName reports whether name was made by defaultKeyName for directoryName
+func isDefaultKeyName(directoryName, name string) bool {
+	suffix, ok := strings.CutPrefix(name, filepath.Base(directoryName)+"-")
+	if !ok {
+		return false
 	}
+	_, err := uuid.Parse(suffix)
+	return err == nil
+}
 
-	// Instructions
-	var keyUsage string
-	if data.SignCommits {
-		keyUsage = "as both an Authentication key AND a Signing key"
-	} else {
-		keyUsage = "as an Authentication key"
+// effectiveSignScopes returns what to sign for data: the chosen scopes, or the defaults
+func effectiveSignScopes(data FormData) []string {
+	if len(data.SignScopes) > 0 {
+		return data.SignScopes
+	}
+	return defaultSignScopes
+}
+
+// signingKeyName returns the file name of the separate signing key generated next to keyName
+func signingKeyName(keyName string) string {
+	return keyName + "-signing"
+}
+
+// keyComment returns the comment for a new key: the one given, else
+// <git username>@<hostname> (<date>), which tells a provider's list of keys
+// apart by machine and age, else the git email, else the key file name
+func keyComment(data FormData, privateKeyPath string) string {
+	if data.KeyComment != "" {
+		return data.KeyComment
+	}
+	if host, err := os.Hostname(); err == nil && host != "" && data.GitUsername != "" {
+		host, _, _ = strings.Cut(host, ".") // laptop, not laptop.example.com
+		return fmt.Sprintf("%s@%s (%s)", data.GitUsername, host, time.Now().Format(time.DateOnly))
+	}
+	if data.GitEmail != "" {
+		return data.GitEmail
 	}
+	return filepath.Base(privateKeyPath)
+}
 
-	instructionPrefix := "Please add this key"
-	if clipboardErr == nil {
-		instructionPrefix = "Please add the copied key"
+// isDefaultKeyComment reports whether comment is one keyComment picks for
+// data without --key-comment, on this machine or another, so that exports and
+// rotations let the new key get its own
+func isDefaultKeyComment(comment string, data FormData) bool {
+	if comment == data.GitEmail {
+		return true
+	}
+	rest, ok := strings.CutPrefix(comment, data.GitUsername+"@")
+	if !ok || data.GitUsername == "" {
+		return false
 	}
+	host, date, ok := strings.Cut(rest, " (")
+	if !ok || host == "" || strings.Contains(host, " ") || !strings.HasSuffix(date, ")") {
+		return false
+	}
+	_, err := time.Parse(time.DateOnly, strings.TrimSuffix(date, ")"))
+	return err == nil
+}
 
-	messages = append(messages, "")
-	messages = append(messages, styleWarn.Render(fmt.Sprintf("%s to your Git provider (GitHub, GitLab, etc.) %s.", instructionPrefix, keyUsage)))
-	messages = append(messages, styleWarn.Render("Find this under SSH and GPG keys (or similar) in your account settings."))
+// isDir reports whether path exists and is a directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
 
-	return messages, nil
+// checkAttachDir fails unless absPath is an existing directory, for --attach,
+// which wires up existing clones and must not create a mistyped path
+func checkAttachDir(absPath string) error {
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return withExitCode(exitFilesystem, fmt.Errorf("directory '%s' does not exist; --%s only uses existing directories", stylePath.Render(absPath), flagAttach))
+	}
+	if !info.IsDir() {
+		return withExitCode(exitFilesystem, fmt.Errorf("'%s' is not a directory", stylePath.Render(absPath)))
+	}
+	return nil
+}
+
+// checkWritableDir fails unless a file can be created in dir
+func checkWritableDir(dir string) error {
+	file, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("directory '%s' is not writable: %w", stylePath.Render(dir), err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// resolveTargetDir returns the absolute path of the directory entered by the user.
+// Absolute paths are used as-is, '~' expands to the home directory and bare
+// relative names are taken relative to the current directory.
+func resolveTargetDir(name string) (string, error) {
+	if name == "~" || strings.HasPrefix(name, "~/") || strings.HasPrefix(name, `~\`) {
+		homeDir, err := userHomeDir()
+		if err != nil {
+			return "", err
+		}
+		name = filepath.Join(homeDir, name[1:])
+	}
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name), nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	dirPath := filepath.Join(cwd, name)
+	absPath, err := filepath.Abs(dirPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path for '%s': %w", dirPath, err)
+	}
+	return absPath, nil
 }
 
 // generateSSHKey creates the SSH key pair in the user's .ssh directory
-func generateSSHKey(keyType, keyName string) (string, string, error) {
-	homeDir, err := os.UserHomeDir()
+func generateSSHKey(data FormData, keyName string, timeout time.Duration) (string, string, error) {
+	if err := validateSKOptions(data); err != nil {
+		return "", "", err
+	}
+	// Rather than have ssh-keygen (or the built-in generator) reject the size
+	if err := validateKeySize(data); err != nil {
+		return "", "", err
+	}
+	sshDir, privateKeyPath, publicKeyPath, err := sshKeyPaths(data.SSHDir, keyName)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get home directory: %w", err)
+		return "", "", err
 	}
-	sshDir := filepath.Join(homeDir, ".ssh")
 
 	// Create .ssh directory if it doesn't exist
 	if _, err := os.Stat(sshDir); os.IsNotExist(err) {
@@ -278,163 +1202,670 @@ func generateSSHKey(keyType, keyName string) (string, string, error) {
 	} else if err != nil {
 		return "", "", fmt.Errorf("failed to check .ssh directory '%s': %w", stylePath.Render(sshDir), err)
 	}
-
-	// Define key paths
-	// Ensure keyName is filesystem-safe (though directory name validation helps)
-	safeKeyName := strings.ReplaceAll(keyName, string(filepath.Separator), "_")
-	privateKeyPath := filepath.Join(sshDir, safeKeyName)
-	publicKeyPath := privateKeyPath + ".pub"
+	// ssh-keygen's own error for an unwritable directory is easy to misread
+	if err := checkWritableDir(sshDir); err != nil {
+		return "", "", err
+	}
 
 	// Check if key files already exist (unlikely with UUID, but good practice)
 	if _, err := os.Stat(privateKeyPath); err == nil {
-		return "", "", fmt.Errorf("SSH key file already exists: %s. Please remove or rename it to generate a new one", stylePath.Render(privateKeyPath)) // Added suggestion
+		return "", "", withExitCode(exitFilesystem, fmt.Errorf("SSH key file already exists: %s. Please remove or rename it to generate a new one", stylePath.Render(privateKeyPath))) // Added suggestion
 	}
 	if _, err := os.Stat(publicKeyPath); err == nil {
-		return "", "", fmt.Errorf("SSH public key file already exists: %s. Please remove or rename it to generate a new one", stylePath.Render(publicKeyPath)) // Added suggestion
+		return "", "", withExitCode(exitFilesystem, fmt.Errorf("SSH public key file already exists: %s. Please remove or rename it to generate a new one", stylePath.Render(publicKeyPath))) // Added suggestion
 	}
 
 	// Prepare ssh-keygen command
-	keygenArgs := []string{
-		"-t", keyType,
-		"-f", privateKeyPath, // Use the platform-native path for the -f argument
-		"-N", "", // No passphrase
-		"-C", safeKeyName, // Add keyName as comment
-	}
-	if keyType == "rsa" {
-		keygenArgs = append(keygenArgs, "-b", "4096") // Specify RSA key size
-	}
+	keygenArgs := sshKeygenArgs(data, privateKeyPath)
 
-	cmd := exec.Command("ssh-keygen", keygenArgs...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", "", fmt.Errorf("ssh-keygen failed (output: %s): %w", strings.TrimSpace(string(output)), err)
+	logStep("Generating %s key %s", data.KeyType, stylePath.Render(privateKeyPath))
+	if useNativeKeygen(data) {
+		logDetail("using the built-in generator")
+		stop := startSpinner(fmt.Sprintf("Generating %s key…", data.KeyType))
+		err := generateNativeKey(data, privateKeyPath, publicKeyPath)
+		stop()
+		if err != nil {
+			return "", "", err
+		}
+	} else {
+		logDetail("%s", formatCommand("ssh-keygen", redactKeygenArgs(keygenArgs)))
+		// ssh-keygen talks to the user itself for security keys (touch, PIN)
+		stop := func() {}
+		if !isSecurityKeyType(data.KeyType) {
+			stop = startSpinner(fmt.Sprintf("Generating %s key…", data.KeyType))
+		}
+		err := runKeygen(keygenArgs, isSecurityKeyType(data.KeyType), keygenTimeout(data.KeyType, timeout))
+		// A security key would need another touch, so only plain keys are retried
+		for attempt := 1; err != nil && attempt < keygenAttempts && !isSecurityKeyType(data.KeyType) && keygenTransient(err); attempt++ {
+			stop()
+			logWarn("%v; retrying (%d of %d)", err, attempt+1, keygenAttempts)
+			// Files left by the failed run would make ssh-keygen ask to overwrite them
+			os.Remove(privateKeyPath)
+			os.Remove(publicKeyPath)
+			time.Sleep(keygenRetryDelay << (attempt - 1))
+			stop = startSpinner(fmt.Sprintf("Generating %s key…", data.KeyType))
+			err = runKeygen(keygenArgs, false, keygenTimeout(data.KeyType, timeout))
+		}
+		stop()
+		if keygenExists(err) {
+			return "", "", withExitCode(exitFilesystem, fmt.Errorf("SSH key file already exists: %s. Please remove or rename it to generate a new one", stylePath.Render(privateKeyPath)))
+		}
+		if err != nil {
+			err = fmt.Errorf("%w\ncommand: %s\nkey: %s", err, formatCommand("ssh-keygen", redactKeygenArgs(keygenArgs)), privateKeyPath)
+			if isSecurityKeyType(data.KeyType) {
+				// `ssh -Q key` lists the -sk types even when FIDO support is missing
+				err = fmt.Errorf("%w\nIf ssh-keygen reported missing security key support, OpenSSH was built without libfido2; install it or use --%s %s",
+					err, flagKeyType, strings.TrimSuffix(data.KeyType, "-sk"))
+			}
+			return "", "", err
+		}
 	}
 
 	// Set private key permissions (important!)
 	if runtime.GOOS != "windows" { // Chmod typically not used/needed this way on Windows keys
 		if err := os.Chmod(privateKeyPath, 0600); err != nil {
 			// Log a warning, maybe not fatal? Or return error? Let's warn for now.
-			fmt.Fprintf(os.Stderr, "%s Could not set private key permissions (chmod 600) on %s: %v\n", styleWarn.Render("Warning:"), stylePath.Render(privateKeyPath), err)
+			logWarn("Could not set private key permissions (chmod 600) on %s: %v", stylePath.Render(privateKeyPath), err)
 		}
 	}
 
 	return privateKeyPath, publicKeyPath, nil
 }
 
-// createLocalGitConfig generates the .gitconfig file within the target directory
-// This function will overwrite an existing .gitconfig in the target directory.
-func createLocalGitConfig(dirPath string, data FormData, linuxPrivateKeyPath, linuxPublicKeyPath string) (string, error) {
+// keygenTimeout returns how long ssh-keygen may run for a key of keyType:
+// timeout if set, else defaultKeygenTimeout, or no limit (0) for security keys
+// that wait for a touch
+func keygenTimeout(keyType string, timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	if isSecurityKeyType(keyType) {
+		return 0
+	}
+	return defaultKeygenTimeout
+}
+
+// runSSHKeygen runs ssh-keygen with args, killing it once timeout (if not 0)
+// has passed. Security keys require a touch (and possibly a PIN), so with
+// attached ssh-keygen is connected to the terminal instead of having its
+// output captured.
+func runSSHKeygen(args []string, attached bool, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := execCommandContext(ctx, "ssh-keygen", args...)
+	var output []byte
+	var err error
+	if attached {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+	} else {
+		output, err = cmd.CombinedOutput()
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("ssh-keygen did not finish within %s and was stopped; if it is waiting for a security key or a prompt, retry with a longer --%s", timeout, flagKeygenTimeout)
+	}
+	if err != nil {
+		return &keygenError{output: strings.TrimSpace(string(output)), err: err}
+	}
+	return nil
+}
+
+// keygenError is a failed ssh-keygen run, with its combined output (empty
+// when it was attached to the terminal)
+type keygenError struct {
+	output string
+	err    error
+}
+
+func (e *keygenError) Error() string {
+	if e.output == "" {
+		return fmt.Sprintf("ssh-keygen failed: %v", e.err)
+	}
+	return fmt.Sprintf("ssh-keygen failed (output: %s): %v", e.output, e.err)
+}
+
+func (e *keygenError) Unwrap() error { return e.err }
+
+// transientKeygenOutput lists what ssh-keygen prints on failures that may not
+// happen again: a short read from the random source or a busy file system
+var transientKeygenOutput = []string{
+	"resource temporarily unavailable",
+	"interrupted system call",
+	"prng is not seeded",
+	"entropy",
+	"device or resource busy",
+	"text file busy",
+	"input/output error",
+}
+
+// keygenExists reports whether ssh-keygen failed because the key file exists
+func keygenExists(err error) bool {
+	var keygenErr *keygenError
+	return errors.As(err, &keygenErr) && strings.Contains(strings.ToLower(keygenErr.output), "already exists")
+}
+
+// keygenTransient reports whether an ssh-keygen failure is worth retrying.
+// Timeouts, a missing ssh-keygen, rejected arguments and existing files are
+// not; a run killed by a signal or reporting a transient error is.
+func keygenTransient(err error) bool {
+	var keygenErr *keygenError
+	if !errors.As(err, &keygenErr) || keygenExists(err) {
+		return false
+	}
+	var exitErr *exec.ExitError
+	if errors.As(keygenErr.err, &exitErr) && exitErr.ExitCode() == -1 {
+		return true // Killed by a signal
+	}
+	output := strings.ToLower(keygenErr.output)
+	return slices.ContainsFunc(transientKeygenOutput, func(s string) bool { return strings.Contains(output, s) })
+}
+
+// isSecurityKeyType reports whether the key type is backed by a FIDO security key
+func isSecurityKeyType(keyType string) bool {
+	return strings.HasSuffix(keyType, "-sk")
+}
+
+// validateSKOptions checks the security key options of data: known ones, and
+// only for -sk key types
+func validateSKOptions(data FormData) error {
+	for _, option := range data.SKOptions {
+		if !slices.Contains(skOptions, option) {
+			return fmt.Errorf("unsupported security key option '%s' (supported: %s)", option, strings.Join(skOptions, ", "))
+		}
+	}
+	if len(data.SKOptions) > 0 && !isSecurityKeyType(data.KeyType) {
+		return fmt.Errorf("security key options (%s) need an -sk key type such as ed25519-sk, not %s", strings.Join(data.SKOptions, ", "), data.KeyType)
+	}
+	return nil
+}
+
+// securityKeyNotice tells the user what using the security key of data involves
+func securityKeyNotice(data FormData) string {
+	action := "touch your security key"
+	if slices.Contains(data.SKOptions, skVerifyRequired) {
+		action = "touch your security key and enter its PIN"
+	}
+	notice := "You will need to " + action + " on every git fetch, pull and push"
+	if signsWithSSH(data) {
+		notice += ", and for every signed commit and tag"
+	}
+	notice += "."
+	if slices.Contains(data.SKOptions, skResident) {
+		notice += " The key is stored on the token; restore its files on another machine with ssh-keygen -K."
+	}
+	return notice
+}
+
+// configPaths holds the files referenced from the local .gitconfig, already
+// converted to the path style git and ssh expect
+type configPaths struct {
+	PrivateKey     string
+	PublicKey      string
+	SigningKey     string // Public key to sign with when it differs from PublicKey
+	AllowedSigners string // Empty when signing is disabled
+	KnownHosts     string // Empty unless a dedicated known_hosts file is used
+	CommitTemplate string // Empty unless a commit message template is set
+}
+
+// localConfigFile returns the file the settings of the context in absPath are
+// written to: --local-config, taken relative to the directory unless it is
+// absolute or a ~/ path, or .gitconfig inside the directory
+func localConfigFile(absPath string, data FormData) (string, error) {
+	if data.LocalConfig == "" {
+		return filepath.Join(absPath, defaultLocalConfigName), nil
+	}
+	if filepath.IsAbs(data.LocalConfig) || strings.HasPrefix(data.LocalConfig, "~") {
+		return resolveTargetDir(data.LocalConfig)
+	}
+	return filepath.Join(absPath, data.LocalConfig), nil
+}
+
+// createLocalGitConfig generates the config file at gitConfigPath, usually the
+// .gitconfig within the target directory (see localConfigFile). An existing
+// file is replaced, or with merge keeps the keys this tool does not write.
+func createLocalGitConfig(gitConfigPath string, data FormData, paths configPaths, merge bool) (string, error) {
+	cfg, err := applyTemplateConfig(buildLocalGitConfig(data, paths), data)
+	if err != nil {
+		return "", err
+	}
+	logConfigKeys(cfg)
+	if merge {
+		existing, err := loadGitConfig(gitConfigPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to load local .gitconfig '%s' to merge into: %w", stylePath.Render(gitConfigPath), err)
+		}
+		mergeGitConfig(existing, cfg)
+		cfg = existing
+	}
+
+	// Save the config file
+	err = saveConfigAtomic(cfg, gitConfigPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to save local .gitconfig to '%s': %w", stylePath.Render(gitConfigPath), err)
+	}
+	return gitConfigPath, nil
+}
+
+// buildLocalGitConfig renders the per-directory identity, ssh and signing settings
+func buildLocalGitConfig(data FormData, paths configPaths) *ini.File {
 	cfg := ini.Empty() // Start with an empty config, effectively overwriting
 
 	// [user] section
 	userSection := cfg.Section("user")
 	userSection.NewKey("name", data.GitUsername)
-	userSection.NewKey("email", data.GitEmail)
-	if data.SignCommits {
+	email, _ := userSection.NewKey("email", data.GitEmail)
+	if len(data.AlternateEmails) > 0 {
+		email.Comment = fmt.Sprintf("# Also commits as %s; for a single commit: git -c user.email=%s commit",
+			strings.Join(data.AlternateEmails, ", "), data.AlternateEmails[0])
+	}
+	if signsWithGPG(data) {
+		userSection.NewKey("signingkey", data.GPGKey)
+	} else if data.SignCommits {
 		// Use the Linux-style path here as Git often expects it for config values
-		userSection.NewKey("signingkey", linuxPublicKeyPath)
+		signingKey := paths.PublicKey
+		if paths.SigningKey != "" {
+			signingKey = paths.SigningKey
+		}
+		userSection.NewKey("signingkey", signingKey)
 	}
 
-	// [core] section
-	coreSection := cfg.Section("core")
-	// Use Linux-style path for ssh command argument, even on Windows
-	sshCommand := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes", linuxPrivateKeyPath)
-	coreSection.NewKey("sshCommand", sshCommand)
+	// [core] section, or [credential] for HTTPS contexts
+	if usesHTTPS(data) {
+		cfg.Section("credential").NewKey("helper", credentialHelper(data))
+	} else {
+		// Use Linux-style path for ssh command argument, even on Windows
+		// git runs it through sh, so a path with spaces is quoted
+		sshCommand := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes", shellQuote(paths.PrivateKey))
+		if data.Passphrase != "" {
+			// Let ssh hand the unlocked key to the agent so the passphrase is only asked once
+			sshCommand += " -o AddKeysToAgent=yes"
+		}
+		for _, option := range hostKeyOptions(data, paths.KnownHosts) {
+			sshCommand += " -o " + shellQuote(option)
+		}
+		cfg.Section("core").NewKey("sshCommand", sshCommand)
+	}
+	if data.Editor != "" {
+		cfg.Section("core").NewKey("editor", data.Editor)
+	}
+	if data.AutoCRLF != "" {
+		cfg.Section("core").NewKey("autocrlf", data.AutoCRLF)
+	}
+	if data.FileMode != "" {
+		cfg.Section("core").NewKey("fileMode", data.FileMode)
+	}
+	if data.PullRebase != "" {
+		cfg.Section("pull").NewKey("rebase", canonicalGitBool(data.PullRebase))
+	}
+	if data.FetchPrune != "" {
+		cfg.Section("fetch").NewKey("prune", canonicalGitBool(data.FetchPrune))
+	}
+	if data.DefaultBranch != "" {
+		cfg.Section("init").NewKey("defaultBranch", data.DefaultBranch)
+	}
+	if data.HTTPProxy != "" {
+		cfg.Section(proxySection(data)).NewKey("proxy", data.HTTPProxy)
+	}
+	if data.GitProxy != "" {
+		cfg.Section("core").NewKey("gitProxy", data.GitProxy)
+	}
+	if paths.CommitTemplate != "" {
+		cfg.Section("commit").NewKey("template", paths.CommitTemplate)
+	}
 
 	// Commit signing sections (only if requested)
 	if data.SignCommits {
-		// [gpg] section
+		// [gpg] section; openpgp is git's default, but a global gpg.format = ssh would win otherwise
 		gpgSection := cfg.Section("gpg")
-		gpgSection.NewKey("format", "ssh")
-
-		// [commit] section
-		commitSection := cfg.Section("commit")
-		commitSection.NewKey("gpgsign", "true")
-
-		// [tag] section (optional, but good practice to sign tags too)
-		tagSection := cfg.Section("tag")
-		tagSection.NewKey("gpgsign", "true")
+		if signsWithGPG(data) {
+			gpgSection.NewKey("format", "openpgp")
+			if data.GPGProgram != "" {
+				gpgSection.NewKey("program", data.GPGProgram)
+			}
+		} else {
+			gpgSection.NewKey("format", "ssh")
+		}
+		if paths.AllowedSigners != "" {
+			// [gpg "ssh"] section, lets `git log --show-signature` verify our own signatures
+			cfg.Section(`gpg "ssh"`).NewKey("allowedSignersFile", paths.AllowedSigners)
+		}
 
+		for _, scope := range effectiveSignScopes(data) {
+			switch scope {
+			case signScopeCommits:
+				cfg.Section("commit").NewKey("gpgsign", "true")
+			case signScopeTags:
+				cfg.Section("tag").NewKey("gpgsign", "true")
+			case signScopePushes:
+				// Many hosts (GitHub included) reject signed pushes, so only sign when the server asks
+				cfg.Section("push").NewKey("gpgsign", "if-asked")
+			}
+		}
 	}
 
-	// Save the config file
-	gitConfigPath := filepath.Join(dirPath, ".gitconfig")
-	err := cfg.SaveTo(gitConfigPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to save local .gitconfig to '%s': %w", stylePath.Render(gitConfigPath), err)
-	}
-	return gitConfigPath, nil
+	return cfg
 }
 
 // updateGlobalGitConfig adds an includeIf directive to the global ~/.gitconfig
+// that loads localConfigPath for repositories in targetDirPath.
 // This function loads the existing global config and adds the directive if not present.
-func updateGlobalGitConfig(targetDirPath string) (string, error) {
-	homeDir, err := os.UserHomeDir()
+// An include for the same condition that loads another file is replaced or
+// kept as resolveIncludeConflict decides; the files of kept includes, which
+// stay active instead of localConfigPath, are returned.
+func updateGlobalGitConfig(targetDirPath, localConfigPath string, data FormData, assumeYes bool) (string, []string, error) {
+	globalGitConfigPath, err := resolveGlobalGitConfigPath()
 	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+		return "", nil, err
 	}
-	globalGitConfigPath := filepath.Join(homeDir, ".gitconfig")
+	unlock, err := lockConfigFile(globalGitConfigPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer unlock()
 
 	// Ensure the global config file exists, creating if necessary
 	if _, err := os.Stat(globalGitConfigPath); os.IsNotExist(err) {
-		fmt.Printf("%s Global .gitconfig not found at %s, creating it.\n", styleWarn.Render("Info:"), stylePath.Render(globalGitConfigPath))
+		logInfo("%s Global .gitconfig not found at %s, creating it.", styleWarn.Render("Info:"), stylePath.Render(globalGitConfigPath))
+		if mkErr := os.MkdirAll(filepath.Dir(globalGitConfigPath), dirMode); mkErr != nil {
+			return "", nil, fmt.Errorf("failed to create directory for global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), mkErr)
+		}
 		file, createErr := os.Create(globalGitConfigPath)
 		if createErr != nil {
-			return "", fmt.Errorf("failed to create global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), createErr)
+			return "", nil, fmt.Errorf("failed to create global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), createErr)
 		}
 		file.Close() // Close immediately after creation
 	} else if err != nil {
-		return "", fmt.Errorf("failed to check global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+		return "", nil, fmt.Errorf("failed to check global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
 	}
 
 	// Load global .gitconfig (using loose load options for flexibility)
-	cfg, err := ini.LoadSources(ini.LoadOptions{AllowBooleanKeys: true, Loose: true}, globalGitConfigPath)
+	cfg, err := loadGitConfig(globalGitConfigPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+		return "", nil, fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
 	}
 
-	// --- Prepare paths for the includeIf directive ---
-	// The 'gitdir:' path for includeIf often requires forward slashes, even on Windows.
-	// It should also usually end with a '/'
-	includeIfDir := strings.ReplaceAll(targetDirPath, "\\", "/") + "/"
+	// Add the includeIf sections, unless an equivalent one is already there
+	sectionNames, includeIfPathValue := includeIfSections(targetDirPath, localConfigPath, data)
+	if data.RelativeInclude {
+		if rel, ok := relativeIncludePath(globalGitConfigPath, localConfigPath); ok {
+			includeIfPathValue = rel
+		} else {
+			logDetail("%s is not below the home directory, including it by absolute path", stylePath.Render(localConfigPath))
+		}
+	}
+	kept := []string{}
+	remove := []string{}
+	add := []includeEntry{}
+	for _, sectionName := range sectionNames {
+		covered, conflicts := matchingIncludes(cfg, globalGitConfigPath, sectionName, localConfigPath)
+
+		// Another include for the same directory or remote loads a different file
+		if len(conflicts) > 0 {
+			existingPaths := []string{}
+			for _, section := range conflicts {
+				existingPath := resolveIncludePath(globalGitConfigPath, section.Key("path").String())
+				logWarn("[%s] already includes %s", section.Name(), stylePath.Render(existingPath))
+				existingPaths = append(existingPaths, existingPath)
+			}
+			action, err := resolveIncludeConflict(sectionName, globalGitConfigPath, localConfigPath, existingPaths, data, assumeYes)
+			if err != nil {
+				return "", nil, err
+			}
+			if action == includeKeep {
+				kept = append(kept, existingPaths...)
+				continue
+			}
+			for _, section := range conflicts {
+				remove = append(remove, section.Name())
+			}
+		}
+
+		if !covered {
+			add = append(add, includeEntry{Section: sectionName, Path: includeIfPathValue})
+			logDetail("%s = %s", gitConfigKeyName(sectionName, "path"), includeIfPathValue)
+		} else {
+			logDetail("%s already includes %s", sectionName, includeIfPathValue)
+		}
+	}
+
+	// Only touch the changed sections, keeping the user's comments and layout
+	if len(remove) == 0 && len(add) == 0 {
+		return globalGitConfigPath, kept, nil
+	}
+	if err := editGitConfigFile(globalGitConfigPath, remove, add); err != nil {
+		return "", nil, fmt.Errorf("failed to save updated global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+	}
+	return globalGitConfigPath, kept, nil
+}
+
+// matchingIncludes finds the includeIf sections of the global config cfg
+// with the same condition as sectionName, reporting whether one of them
+// already loads localConfigPath and returning those that load another file
+func matchingIncludes(cfg *ini.File, globalGitConfigPath, sectionName, localConfigPath string) (bool, []*ini.Section) {
+	wanted := normalizeIncludeCondition(includeIfPattern.FindStringSubmatch(sectionName)[1])
+	covered := false
+	conflicts := []*ini.Section{}
+	for _, section := range cfg.Sections() {
+		match := includeIfPattern.FindStringSubmatch(section.Name())
+		if match == nil || !section.HasKey("path") || normalizeIncludeCondition(match[1]) != wanted {
+			continue
+		}
+		if samePath(resolveIncludePath(globalGitConfigPath, section.Key("path").String()), localConfigPath) {
+			covered = true
+		} else {
+			conflicts = append(conflicts, section)
+		}
+	}
+	return covered, conflicts
+}
+
+// loadGitConfig parses a git config file with loose options, so a missing file
+// yields an empty config and boolean keys without values are accepted
+func loadGitConfig(path string) (*ini.File, error) {
+	return ini.LoadSources(ini.LoadOptions{AllowBooleanKeys: true, Loose: true}, path)
+}
+
+// saveConfigAtomic writes cfg to path with writeFileAtomic
+func saveConfigAtomic(cfg *ini.File, path string) error {
+	var buf bytes.Buffer
+	if _, err := cfg.WriteTo(&buf); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// writeFileAtomic writes content to a temp file next to path and renames it
+// over path, so an interrupted run never leaves a truncated config behind
+func writeFileAtomic(path string, content []byte) (err error) {
+	// Write through symlinks (e.g. dotfile managers) instead of replacing them
+	if resolved, evalErr := filepath.EvalSymlinks(path); evalErr == nil {
+		path = resolved
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	// Remove the temp file on any failure; after a successful rename it no longer exists
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp uses 0600, but git config files are normally world-readable;
+	// a file being replaced keeps its own permissions, which may be tighter
+	mode := configFileMode
+	if info, statErr := os.Stat(path); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err = os.Chmod(tmpPath, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// resolveGlobalGitConfigPath returns the global config file git itself uses:
+// $GIT_CONFIG_GLOBAL if set, otherwise ~/.gitconfig if it exists, otherwise
+// $XDG_CONFIG_HOME/git/config if it exists. When neither file exists it returns
+// ~/.gitconfig, which is where `git config --global` would create it.
+func resolveGlobalGitConfigPath() (string, error) {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return path, nil
+	}
+
+	homeDir, err := userHomeDir()
+	if err != nil {
+		return "", err
+	}
+	homeConfig := filepath.Join(homeDir, ".gitconfig")
+	if _, err := os.Stat(homeConfig); err == nil {
+		return homeConfig, nil
+	}
+
+	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfigHome == "" {
+		xdgConfigHome = filepath.Join(homeDir, ".config")
+	}
+	xdgConfig := filepath.Join(xdgConfigHome, "git", "config")
+	if _, err := os.Stat(xdgConfig); err == nil {
+		return xdgConfig, nil
+	}
+
+	return homeConfig, nil
+}
+
+// effectiveIncludeMatch returns how the context is matched: the chosen mode,
+// or gitdir plus the remote when only a remote URL was given
+func effectiveIncludeMatch(data FormData) string {
+	if data.IncludeMatch != "" {
+		return data.IncludeMatch
+	}
+	if data.RemoteURL != "" {
+		return matchBoth
+	}
+	return matchGitdir
+}
+
+// includeIfSections returns the includeIf section names for the context and
+// the path value they all share
+func includeIfSections(targetDirPath, localConfigPath string, data FormData) ([]string, string) {
+	gitdirSection, includeIfPathValue := includeIfEntry(targetDirPath, localConfigPath)
+	if data.GitdirPattern != "" {
+		gitdirSection = fmt.Sprintf(`includeIf "gitdir:%s"`, data.GitdirPattern)
+	}
+	if data.Branch != "" {
+		return []string{fmt.Sprintf(`includeIf "%s%s"`, onbranchPrefix, data.Branch)}, includeIfPathValue
+	}
+	remoteSection := fmt.Sprintf(`includeIf "hasconfig:remote.*.url:%s"`, data.RemoteURL)
+	switch effectiveIncludeMatch(data) {
+	case matchRemote:
+		return []string{remoteSection}, includeIfPathValue
+	case matchBoth:
+		return []string{gitdirSection, remoteSection}, includeIfPathValue
+	default:
+		return []string{gitdirSection}, includeIfPathValue
+	}
+}
+
+// includeIfEntry returns the includeIf section name and path value that make
+// git load localConfigPath for repositories below targetDirPath
+func includeIfEntry(targetDirPath, localConfigPath string) (string, string) {
 	// The 'path' value should point to the local .gitconfig file.
 	// This path can often be relative to the global config or absolute.
 	// Using an absolute path converted to forward slashes is generally safest.
-	localConfigPath := filepath.Join(targetDirPath, ".gitconfig")
-	includeIfPathValue := strings.ReplaceAll(localConfigPath, "\\", "/")
+	includeIfPathValue := includePath(localConfigPath)
 
-	// Add the includeIf section
 	// Section name uses the specific gitdir path
-	sectionName := fmt.Sprintf(`includeIf "gitdir:%s"`, includeIfDir)
-	includeSection := cfg.Section(sectionName)
+	return fmt.Sprintf(`includeIf "%s"`, gitdirCondition(targetDirPath)), includeIfPathValue
+}
 
-	// Check if this exact include already exists to prevent duplicates
-	if key, _ := includeSection.GetKey("path"); key == nil || key.Value() != includeIfPathValue {
-		includeSection.NewKey("path", includeIfPathValue)
-	} else {
-		// Optional: Add a message if the include already exists?
-		// messages = append(messages, styleInfo.Render("Include directive already exists in global .gitconfig"))
-		// For now, just don't add it again.
+// relativeIncludePath returns localConfigPath relative to the directory of
+// globalGitConfigPath, which git resolves relative include paths against. ok
+// is false unless both files are below the home directory.
+func relativeIncludePath(globalGitConfigPath, localConfigPath string) (string, bool) {
+	homeDir, err := userHomeDir()
+	if err != nil {
+		return "", false
 	}
-
-	// Save the updated global config
-	err = cfg.SaveTo(globalGitConfigPath)
+	for _, path := range []string{globalGitConfigPath, localConfigPath} {
+		rel, err := filepath.Rel(homeDir, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+	}
+	rel, err := filepath.Rel(filepath.Dir(globalGitConfigPath), localConfigPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to save updated global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// normalizeIncludeCondition returns a canonical form of an includeIf condition,
+// so conditions that match the same directory compare equal: gitdir paths get
+// forward slashes, '~/' expanded and a single trailing slash, and are folded
+// to lower case for "gitdir/i:" and on Windows
+func normalizeIncludeCondition(condition string) string {
+	pattern, ok := strings.CutPrefix(condition, "gitdir:")
+	foldCase := hostOS == "windows"
+	if !ok {
+		if pattern, ok = strings.CutPrefix(condition, "gitdir/i:"); !ok {
+			return strings.TrimSpace(condition)
+		}
+		foldCase = true
+	}
+
+	pattern = strings.ReplaceAll(strings.TrimSpace(pattern), "\\", "/")
+	if rest, ok := strings.CutPrefix(pattern, "~/"); ok {
+		if homeDir, err := userHomeDir(); err == nil {
+			pattern = filepath.ToSlash(filepath.Join(homeDir, rest))
+		}
+	}
+	pattern = convertToLinuxPath(pattern)
+	pattern = strings.TrimRight(pattern, "/") + "/"
+	if foldCase {
+		pattern = strings.ToLower(pattern)
+	}
+	return "gitdir:" + pattern
+}
+
+// samePath reports whether two file paths name the same file, ignoring case on Windows
+func samePath(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if hostOS == "windows" {
+		return strings.EqualFold(a, b)
 	}
-	return globalGitConfigPath, nil
+	return a == b
 }
 
 // convertToLinuxPath converts a Windows path (e.g., C:\Users\X) to a
 // POSIX-like path (e.g., /c/Users/X) often required by Git/SSH tools within config files.
 // Non-Windows paths are returned unchanged.
 func convertToLinuxPath(path string) string {
-	if runtime.GOOS != "windows" {
+	if hostOS != "windows" {
 		return path // No conversion needed for non-Windows
 	}
 
-	// Use filepath.ToSlash for basic conversion
-	p := filepath.ToSlash(path)
+	// Same as filepath.ToSlash on Windows, but independent of the OS running the code
+	p := strings.ReplaceAll(path, `\`, "/")
 
 	// Handle drive letters (e.g., C:/Users/...) -> /c/Users/...
 	if len(p) > 1 && p[1] == ':' {
@@ -442,3 +1873,101 @@ func convertToLinuxPath(path string) string {
 	}
 	return p
 }
+
+// convertFromLinuxPath reverses convertToLinuxPath, turning /c/Users/X (or
+// the WSL form /mnt/c/Users/X) back into C:/Users/X on Windows. Other paths
+// are returned unchanged.
+func convertFromLinuxPath(path string) string {
+	if hostOS != "windows" {
+		return path
+	}
+	if rest, ok := strings.CutPrefix(path, "/mnt"); ok && len(rest) > 2 && rest[2] == '/' {
+		path = rest
+	}
+	if len(path) > 2 && path[0] == '/' && path[2] == '/' {
+		return strings.ToUpper(string(path[1])) + ":" + path[2:]
+	}
+	return path
+}
+
+// sshCommandKeyPath extracts the identity file passed with -i from a core.sshCommand value
+func sshCommandKeyPath(sshCommand string) string {
+	words := splitShellWords(sshCommand)
+	for i := 0; i < len(words)-1; i++ {
+		if words[i].value == "-i" {
+			return convertFromLinuxPath(words[i+1].value)
+		}
+	}
+	return ""
+}
+
+// shellQuote quotes s for a command line that git runs through sh, such as
+// core.sshCommand, when sh would split or expand it; other values stay as they are
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`;&|<>()*?[]#!{}") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellWord is a word of a command line, unquoted, and the span of the line it came from
+type shellWord struct {
+	value      string
+	start, end int
+}
+
+// splitShellWords splits a command line into words as sh does, honoring
+// single and double quotes and backslashes without expanding anything
+func splitShellWords(s string) []shellWord {
+	words := []shellWord{}
+	var word strings.Builder
+	start, inWord := 0, false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+			continue
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else if c == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`", s[i+1]) >= 0 {
+				i++
+				word.WriteByte(s[i])
+			} else {
+				word.WriteByte(c)
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, shellWord{word.String(), start, i})
+				word.Reset()
+				inWord = false
+			}
+			continue
+		}
+		if !inWord {
+			start, inWord = i, true
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				word.WriteByte(s[i])
+			}
+		default:
+			word.WriteByte(c)
+		}
+	}
+	if inWord {
+		words = append(words, shellWord{word.String(), start, len(s)})
+	}
+	return words
+}
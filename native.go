@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// nativeKeyTypes lists the key types the built-in generator supports
+var nativeKeyTypes = []string{"ed25519", "rsa", "ecdsa"}
+
+// sshKeygenAvailable reports whether ssh-keygen can be found on PATH
+func sshKeygenAvailable() bool {
+	_, err := exec.LookPath("ssh-keygen")
+	return err == nil
+}
+
+// useNativeKeygen reports whether the key should be generated in-process
+// rather than by ssh-keygen: either on request or because ssh-keygen is missing
+func useNativeKeygen(data FormData) bool {
+	return data.NativeKeygen || !sshKeygenAvailable()
+}
+
+// generateNativeKey writes an OpenSSH-format key pair without shelling out to
+// ssh-keygen, producing the same files (privateKeyPath and privateKeyPath.pub)
+func generateNativeKey(data FormData, privateKeyPath, publicKeyPath string) error {
+	var privateKey crypto.Signer
+	var err error
+	switch data.KeyType {
+	case "ed25519":
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	case "rsa":
+		privateKey, err = rsa.GenerateKey(rand.Reader, data.RSABits)
+	case "ecdsa":
+		curves := map[int]elliptic.Curve{256: elliptic.P256(), 384: elliptic.P384(), 521: elliptic.P521()}
+		curve, ok := curves[data.ECDSACurve]
+		if !ok {
+			return validateECDSACurve(data.ECDSACurve)
+		}
+		privateKey, err = ecdsa.GenerateKey(curve, rand.Reader)
+	default:
+		return fmt.Errorf("key type '%s' requires ssh-keygen (the built-in generator supports %s)", data.KeyType, strings.Join(nativeKeyTypes, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate %s key: %w", data.KeyType, err)
+	}
+
+	comment := keyComment(data, privateKeyPath)
+	var block *pem.Block
+	if data.Passphrase != "" {
+		if data.KDFRounds > 0 {
+			logWarn("the built-in generator always uses the default KDF rounds; --%s needs ssh-keygen", flagKDFRounds)
+		}
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, comment, []byte(data.Passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(privateKey, comment)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
+	if err != nil {
+		return fmt.Errorf("failed to encode public key: %w", err)
+	}
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))) + " " + comment + "\n"
+
+	// O_EXCL guards against overwriting a key that appeared since the existence check
+	if err := writeNewFile(privateKeyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		return err
+	}
+	if err := writeNewFile(publicKeyPath, []byte(authorizedKey), 0644); err != nil {
+		os.Remove(privateKeyPath)
+		return err
+	}
+	return nil
+}
+
+// writeNewFile creates path with the given permissions, failing if it already exists
+func writeNewFile(path string, content []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create '%s': %w", stylePath.Render(path), err)
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write '%s': %w", stylePath.Render(path), err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Output formats accepted by --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputFormats lists the values accepted by --output
+var outputFormats = []string{outputText, outputJSON}
+
+// setupResult describes what processFormData did for one context. Both the
+// bordered text output and --output json are rendered from it.
+type setupResult struct {
+	Directory        string `json:"directory"`
+	DirectoryCreated bool   `json:"directoryCreated"`
+	KeyGenerated     bool   `json:"keyGenerated"`
+	PrivateKeyPath   string `json:"privateKeyPath"`
+	PublicKeyPath    string `json:"publicKeyPath"`
+	PublicKey        string `json:"publicKey"`
+	Fingerprint      string `json:"fingerprint,omitempty"`
+	CredentialHelper string `json:"credentialHelper,omitempty"` // Set instead of the key fields for --auth https
+
+	// Only set when a separate signing key is used
+	SigningKeyGenerated   bool   `json:"signingKeyGenerated,omitempty"`
+	SigningPrivateKeyPath string `json:"signingPrivateKeyPath,omitempty"`
+	SigningPublicKeyPath  string `json:"signingPublicKeyPath,omitempty"`
+	SigningPublicKey      string `json:"signingPublicKey,omitempty"`
+	SigningFingerprint    string `json:"signingFingerprint,omitempty"`
+
+	LocalConfigPath    string          `json:"localConfigPath"`
+	Scope              string          `json:"scope,omitempty"`             // repo or global-only, which write no local config
+	ScopeConfigPath    string          `json:"scopeConfigPath,omitempty"`   // Config the identity was written into for Scope
+	LocalConfigAction  string          `json:"localConfigAction,omitempty"` // created, overwritten or merged
+	GlobalConfigPath   string          `json:"globalConfigPath,omitempty"`  // Empty when the repository's own config includes the local one
+	IncludeKept        []string        `json:"includeKept,omitempty"`       // Files existing includes still load instead of the local config
+	RepoConfigPath     string          `json:"repoConfigPath,omitempty"`
+	RepoIncludeAdded   bool            `json:"repoIncludeAdded,omitempty"`
+	GitignorePath      string          `json:"gitignorePath,omitempty"`
+	GitignoreAdded     []string        `json:"gitignoreAdded,omitempty"` // Lines --append-to-gitignore added
+	AllowedSignersPath string          `json:"allowedSignersPath,omitempty"`
+	SignerAdded        bool            `json:"signerAdded,omitempty"`
+	SSHConfigPath      string          `json:"sshConfigPath,omitempty"`
+	SSHHostAdded       bool            `json:"sshHostAdded,omitempty"`
+	KnownHostsCreated  bool            `json:"knownHostsCreated,omitempty"`
+	CommitTemplatePath string          `json:"commitTemplatePath,omitempty"`
+	TemplateCreated    bool            `json:"commitTemplateCreated,omitempty"`
+	GitInitialized     bool            `json:"gitInitialized,omitempty"`
+	OriginAdded        bool            `json:"originAdded,omitempty"`
+	OriginExisting     string          `json:"originExisting,omitempty"` // URL of an origin that was already there
+	RemoteWarning      string          `json:"remoteWarning,omitempty"`
+	SSHConfigWarning   string          `json:"sshConfigWarning,omitempty"` // Host blocks in ~/.ssh/config that core.sshCommand overrides
+	Imported           bool            `json:"imported,omitempty"`         // Only the key given with --import-pubkey was used, no config was written
+	KeyOnly            bool            `json:"keyOnly,omitempty"`          // Only a key was generated (--key-only), no config was written
+	IdentityWarning    string          `json:"identityWarning,omitempty"`  // Set when --force overrode an existing repository's identity
+	ClipboardCopied    bool            `json:"clipboardCopied"`
+	ClipboardMethod    string          `json:"clipboardMethod,omitempty"`
+	ClipboardError     string          `json:"clipboardError,omitempty"`
+	KeyFile            string          `json:"keyFile,omitempty"`       // File the public key was saved to when the clipboard failed
+	PubkeyOutPath      string          `json:"pubkeyOutPath,omitempty"` // File --pubkey-out wrote the public key to
+	Agent              string          `json:"agent,omitempty"`         // Outcome of --add-to-agent
+	AgentError         string          `json:"agentError,omitempty"`
+	GitHubKeys         []githubKey     `json:"githubKeys,omitempty"`
+	GitHubError        string          `json:"githubError,omitempty"`
+	ConnectionTest     *connectionTest `json:"connectionTest,omitempty"`
+	ConfigDump         []configDump    `json:"configDump,omitempty"`       // Set with --dump-config, also for --dry-run
+	SSHConfigSnippet   string          `json:"sshConfigSnippet,omitempty"` // Set with --print-ssh-config, also for --dry-run
+
+	// Set instead of the fields above for --dry-run
+	DryRun bool     `json:"-"`
+	Plan   []string `json:"-"`
+
+	data FormData // The answers the result was produced from, for the text instructions
+}
+
+// configDump is a config file, or the part of it setup wrote, as
+// --dump-config prints it
+type configDump struct {
+	Label   string `json:"label"` // What the content is, e.g. "local .gitconfig"
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// dumpWrittenConfig reads back what setup wrote for result: the whole local
+// .gitconfig and the include sections loading it, so the dump shows the files
+// exactly as saved
+func dumpWrittenConfig(result *setupResult, data FormData) ([]configDump, error) {
+	if result.ScopeConfigPath != "" {
+		content, err := os.ReadFile(result.ScopeConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", stylePath.Render(result.ScopeConfigPath), err)
+		}
+		paths := configPaths{PrivateKey: result.PrivateKeyPath, PublicKey: result.PublicKeyPath, SigningKey: result.SigningPublicKeyPath,
+			AllowedSigners: result.AllowedSignersPath, KnownHosts: data.KnownHostsFile, CommitTemplate: result.CommitTemplatePath}
+		sections := buildLocalGitConfig(data, paths).SectionStrings()
+		return []configDump{{Label: scopeConfigLabel(data), Path: result.ScopeConfigPath, Content: configSectionsText(string(content), sections)}}, nil
+	}
+	content, err := os.ReadFile(result.LocalConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", stylePath.Render(result.LocalConfigPath), err)
+	}
+	dump := []configDump{{Label: "local .gitconfig", Path: result.LocalConfigPath, Content: string(content)}}
+
+	label, path, sections := "includeIf in global .gitconfig", result.GlobalConfigPath, []string{}
+	if result.RepoConfigPath != "" {
+		label, path, sections = "include in the repository config", result.RepoConfigPath, []string{repoIncludeSection(data.Branch)}
+	} else {
+		sections, _ = includeIfSections(result.Directory, result.LocalConfigPath, data)
+	}
+	content, err = os.ReadFile(path)
+	if err != nil {
+		return dump, fmt.Errorf("failed to read '%s': %w", stylePath.Render(path), err)
+	}
+	return append(dump, configDump{Label: label, Path: path, Content: configSectionsText(string(content), sections)}), nil
+}
+
+// printConfigDump prints the dumped config files to stdout, each after a
+// comment line naming it, so the output still reads as git config
+func printConfigDump(dump []configDump) {
+	for _, file := range dump {
+		fmt.Printf("# ----- %s: %s -----\n", file.Label, file.Path)
+		fmt.Print(file.Content)
+		if !strings.HasSuffix(file.Content, "\n") {
+			fmt.Println()
+		}
+	}
+}
+
+// validateOutputFormat checks the value of --output
+func validateOutputFormat(s string) error {
+	if !slices.Contains(outputFormats, s) {
+		return fmt.Errorf("unsupported output format '%s' (supported: %s)", s, strings.Join(outputFormats, ", "))
+	}
+	return nil
+}
+
+// renderSetupResult turns a result into the styled lines shown in the bordered box
+func renderSetupResult(result *setupResult) []string {
+	if result.DryRun {
+		return result.Plan
+	}
+	data := result.data
+	messages := []string{}
+
+	if result.Imported {
+		source := result.PublicKeyPath
+		if source == "" {
+			source = "stdin"
+		}
+		messages = append(messages, styleKey.Render("Imported public key from:")+" "+stylePath.Render(source))
+	} else if result.KeyOnly {
+		messages = append(messages, styleKey.Render("Generated SSH key:")+" "+stylePath.Render(result.PrivateKeyPath))
+	} else {
+		messages = append(messages, renderSetupChanges(result)...)
+	}
+
+	// --- Format Final Output Messages ---
+	messages = append(messages, "") // Separator
+	if result.Imported || result.KeyOnly {
+		messages = append(messages, styleGood.Render("Public key ready, nothing was configured."))
+	} else {
+		messages = append(messages, styleGood.Render("Setup completed successfully!"))
+	}
+	if result.CredentialHelper != "" {
+		return append(messages, renderHTTPSNotes(result)...)
+	}
+	messages = append(messages, "")
+	messages = append(messages, styleKey.Render("Your SSH Public Key:"))
+	messages = append(messages, styleKeyText.Render(result.PublicKey))
+	if result.Fingerprint != "" {
+		messages = append(messages, styleKey.Render("Fingerprint:")+" "+styleKeyText.Render(result.Fingerprint))
+	}
+	if result.SigningPublicKey != "" {
+		messages = append(messages, "")
+		messages = append(messages, styleKey.Render("Your SSH Signing Key:"))
+		messages = append(messages, styleKeyText.Render(result.SigningPublicKey))
+		if result.SigningFingerprint != "" {
+			messages = append(messages, styleKey.Render("Fingerprint:")+" "+styleKeyText.Render(result.SigningFingerprint))
+		}
+	}
+
+	// Clipboard status message
+	if result.ClipboardMethod == clipboardOSC52 {
+		messages = append(messages, "") // Seperator
+		messages = append(messages, styleGood.Render("Public key sent to your terminal's clipboard (OSC52)"))
+	} else if result.ClipboardCopied {
+		messages = append(messages, "") // Seperator
+		messages = append(messages, styleGood.Render("Public key copied to clipboard"))
+	} else if result.KeyFile != "" {
+		messages = append(messages, "")
+		messages = append(messages, styleGood.Render("Public key saved to:")+" "+stylePath.Render(result.KeyFile))
+	} else if result.ClipboardError != "" {
+		messages = append(messages, styleWarn.Render("Could not copy public key to clipboard: "+result.ClipboardError))
+	}
+	if result.PubkeyOutPath != "" {
+		messages = append(messages, styleGood.Render("Public key written to:")+" "+stylePath.Render(result.PubkeyOutPath))
+	}
+
+	switch result.Agent {
+	case "":
+	case agentAdded:
+		messages = append(messages, styleGood.Render("Key added to ssh-agent"))
+	case agentNotRunning, agentNoSSHAdd:
+		messages = append(messages, styleWarn.Render("Skipped adding the key to ssh-agent: "+result.AgentError))
+	default:
+		messages = append(messages, styleWarn.Render("Could not add the key to ssh-agent: "+result.AgentError))
+	}
+
+	// Instructions
+	var keyUsage string
+	if result.SigningPublicKey != "" {
+		keyUsage = "as an Authentication key, and the signing key as a Signing key"
+	} else if signsWithSSH(data) {
+		keyUsage = "as both an Authentication key AND a Signing key"
+	} else {
+		keyUsage = "as an Authentication key"
+	}
+
+	instructionPrefix := "Please add this key"
+	if result.ClipboardCopied {
+		instructionPrefix = "Please add the copied key"
+	}
+
+	messages = append(messages, "")
+	if len(result.GitHubKeys) > 0 {
+		for _, key := range result.GitHubKeys {
+			messages = append(messages, styleGood.Render(fmt.Sprintf("Added to GitHub as %s key #%d (%s)", key.Kind, key.ID, key.Title)))
+		}
+	}
+	if result.GitHubError != "" {
+		messages = append(messages, styleError.Render("GitHub upload failed: "+result.GitHubError))
+	}
+	if result.GitHubError != "" || len(result.GitHubKeys) == 0 {
+		messages = append(messages, styleWarn.Render(fmt.Sprintf("%s to your %s account %s.", instructionPrefix, providerName(data), keyUsage)))
+		messages = append(messages, styleWarn.Render(providerKeysHint(data)))
+	}
+
+	messages = append(messages, renderGPGNotice(data)...)
+
+	if !result.Imported && data.ExistingKey == "" && isSecurityKeyType(data.KeyType) {
+		messages = append(messages, "")
+		messages = append(messages, styleWarn.Render(securityKeyNotice(data)))
+	}
+
+	if data.SSHHostAlias != "" {
+		messages = append(messages, "")
+		messages = append(messages, styleInfo.Render(fmt.Sprintf("Use the host alias in remote URLs, e.g. git@%s:owner/repo.git", data.SSHHostAlias)))
+	}
+
+	if notes := hostKeyNotes(data); len(notes) > 0 {
+		messages = append(messages, "")
+		for _, note := range notes {
+			messages = append(messages, styleWarn.Render(note))
+		}
+	}
+
+	if result.ConnectionTest != nil {
+		messages = append(messages, "")
+		messages = append(messages, renderConnectionTest(result.ConnectionTest)...)
+	}
+
+	if data.Passphrase != "" && result.Agent != agentAdded {
+		messages = append(messages, "")
+		messages = append(messages, styleInfo.Render("Your key is protected by a passphrase. Load it into your ssh-agent with:"))
+		messages = append(messages, styleKeyText.Render("ssh-add "+result.PrivateKeyPath))
+		messages = append(messages, styleInfo.Render("Otherwise git will add it to a running agent the first time you enter the passphrase."))
+	}
+
+	return messages
+}
+
+// renderHTTPSNotes tells the user of an HTTPS context how git will ask for
+// their credentials
+func renderHTTPSNotes(result *setupResult) []string {
+	data := result.data
+	messages := []string{
+		"",
+		styleKey.Render("Credential helper:") + " " + styleKeyText.Render(result.CredentialHelper),
+		styleWarn.Render(fmt.Sprintf("On the first push or fetch over HTTPS git asks for your %s username and a personal access token (not your password); the helper remembers them.", providerName(data))),
+		styleInfo.Render("Use HTTPS remote URLs, e.g. https://" + providerHost(data) + "/owner/repo.git"),
+	}
+	return append(messages, renderGPGNotice(data)...)
+}
+
+// renderGPGNotice asks the user to add the GPG key to the provider when the
+// context signs with one
+func renderGPGNotice(data FormData) []string {
+	if !signsWithGPG(data) {
+		return nil
+	}
+	return []string{
+		"",
+		styleWarn.Render(fmt.Sprintf("Commits are signed with GPG key %s; add its public key to your %s account as a GPG key so they show as verified:", data.GPGKey, providerName(data))),
+		styleKeyText.Render("gpg --armor --export " + data.GPGKey),
+	}
+}
+
+// renderSetupChanges lists what setup changed on disk for a result
+func renderSetupChanges(result *setupResult) []string {
+	data := result.data
+	messages := []string{}
+
+	if result.DirectoryCreated {
+		messages = append(messages, styleInfo.Render("Created directory:")+" "+stylePath.Render(result.Directory))
+	} else if result.Scope != scopeGlobalOnly {
+		messages = append(messages, styleInfo.Render("Directory already exists:")+" "+stylePath.Render(result.Directory))
+	}
+	if result.KeyGenerated {
+		messages = append(messages, styleKey.Render("Generated SSH key:")+" "+stylePath.Render(result.PrivateKeyPath))
+	} else if result.PrivateKeyPath != "" {
+		messages = append(messages, styleKey.Render("Using existing SSH key:")+" "+stylePath.Render(result.PrivateKeyPath))
+	}
+	if result.SigningKeyGenerated {
+		messages = append(messages, styleKey.Render("Generated signing key:")+" "+stylePath.Render(result.SigningPrivateKeyPath))
+	} else if result.SigningPrivateKeyPath != "" {
+		messages = append(messages, styleKey.Render("Using existing signing key:")+" "+stylePath.Render(result.SigningPrivateKeyPath))
+	}
+	if result.SignerAdded {
+		messages = append(messages, styleWarn.Render("Added signer to:")+" "+stylePath.Render(result.AllowedSignersPath))
+	}
+	switch {
+	case result.ScopeConfigPath != "":
+		messages = append(messages, styleWarn.Render("Wrote the identity into the "+scopeConfigLabel(data)+":")+" "+stylePath.Render(result.ScopeConfigPath))
+	case result.LocalConfigAction == localConfigMerged:
+		messages = append(messages, styleWarn.Render("Merged into existing local .gitconfig:")+" "+stylePath.Render(result.LocalConfigPath))
+	case result.LocalConfigAction == localConfigOverwritten:
+		messages = append(messages, styleWarn.Render("Overwrote existing local .gitconfig:")+" "+stylePath.Render(result.LocalConfigPath))
+	default:
+		messages = append(messages, styleWarn.Render("Created local .gitconfig:")+" "+stylePath.Render(result.LocalConfigPath))
+	}
+	if result.RepoIncludeAdded {
+		messages = append(messages, styleWarn.Render("Included it from the repository config:")+" "+stylePath.Render(result.RepoConfigPath))
+	} else if result.RepoConfigPath != "" {
+		messages = append(messages, styleInfo.Render("Already included from the repository config:")+" "+stylePath.Render(result.RepoConfigPath))
+	} else if result.ScopeConfigPath == "" {
+		messages = append(messages, styleWarn.Render("Updated global .gitconfig:")+" "+stylePath.Render(result.GlobalConfigPath))
+	}
+	for _, path := range result.IncludeKept {
+		messages = append(messages, styleError.Render("Kept the existing include, so the local .gitconfig is not applied; active:")+" "+stylePath.Render(path))
+	}
+	if result.SSHConfigPath != "" {
+		if result.SSHHostAdded {
+			messages = append(messages, styleWarn.Render("Added Host "+data.SSHHostAlias+" to ssh config:")+" "+stylePath.Render(result.SSHConfigPath))
+		} else {
+			messages = append(messages, styleInfo.Render("Host "+data.SSHHostAlias+" already exists in ssh config:")+" "+stylePath.Render(result.SSHConfigPath))
+		}
+	}
+
+	if result.KnownHostsCreated {
+		messages = append(messages, styleWarn.Render("Created known hosts file:")+" "+stylePath.Render(data.KnownHostsFile))
+	}
+	if result.TemplateCreated {
+		messages = append(messages, styleWarn.Render("Created commit template:")+" "+stylePath.Render(result.CommitTemplatePath))
+	}
+
+	if data.GitInit {
+		if result.GitInitialized {
+			messages = append(messages, styleGood.Render("Initialized git repository in:")+" "+stylePath.Render(result.Directory))
+		} else {
+			messages = append(messages, styleInfo.Render("Already a git repository:")+" "+stylePath.Render(result.Directory))
+		}
+	}
+	if len(result.GitignoreAdded) > 0 {
+		messages = append(messages, styleWarn.Render("Added "+strings.Join(result.GitignoreAdded, ", ")+" to:")+" "+stylePath.Render(result.GitignorePath))
+	} else if result.GitignorePath != "" {
+		messages = append(messages, styleInfo.Render("Already ignored in:")+" "+stylePath.Render(result.GitignorePath))
+	}
+	if result.OriginAdded {
+		messages = append(messages, styleGood.Render("Added remote origin:")+" "+styleKeyText.Render(data.Remote))
+	} else if result.OriginExisting == data.Remote && data.Remote != "" {
+		messages = append(messages, styleInfo.Render("Remote origin already set to:")+" "+styleKeyText.Render(result.OriginExisting))
+	} else if result.OriginExisting != "" {
+		messages = append(messages, styleWarn.Render("Kept the existing remote origin:")+" "+styleKeyText.Render(result.OriginExisting))
+	}
+	if result.RemoteWarning != "" {
+		messages = append(messages, styleWarn.Render("Warning: "+result.RemoteWarning))
+	}
+	if result.SSHConfigWarning != "" {
+		messages = append(messages, styleWarn.Render("Warning: "+result.SSHConfigWarning))
+	}
+	if result.IdentityWarning != "" {
+		messages = append(messages, styleWarn.Render("Warning: "+result.IdentityWarning))
+	}
+	return messages
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// jsonValue returns what --output json prints for a result. A dry run only
+// has a plan, with the terminal styling stripped from its lines.
+func (r *setupResult) jsonValue() any {
+	if !r.DryRun {
+		return r
+	}
+	plan := make([]string, len(r.Plan))
+	for i, line := range r.Plan {
+		plan[i] = ansi.Strip(line)
+	}
+	return struct {
+		DryRun           bool         `json:"dryRun"`
+		Plan             []string     `json:"plan"`
+		ConfigDump       []configDump `json:"configDump,omitempty"`
+		SSHConfigSnippet string       `json:"sshConfigSnippet,omitempty"`
+	}{true, plan, r.ConfigDump, r.SSHConfigSnippet}
+}
+
+// printSetupResult prints a result in the requested output format
+func printSetupResult(result *setupResult, format string) error {
+	if format == outputJSON {
+		return printJSON(result.jsonValue())
+	}
+	if verbosity == levelQuiet && !result.DryRun {
+		printPublicKeys(result)
+	} else {
+		printBorderedMessages(renderSetupResult(result))
+	}
+	printConfigDump(result.ConfigDump)
+	fmt.Print(result.SSHConfigSnippet)
+	return nil
+}
+
+// printPublicKeys prints just the public keys of a result, for --quiet
+func printPublicKeys(result *setupResult) {
+	if result.PublicKey == "" {
+		return // HTTPS contexts have no key
+	}
+	fmt.Println(result.PublicKey)
+	if result.SigningPublicKey != "" {
+		fmt.Println(result.SigningPublicKey)
+	}
+}
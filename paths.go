@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Path styles for the key paths written to config files (--path-style): the
+// key in core.sshCommand, user.signingkey and IdentityFile, which ssh reads.
+// They only differ for Windows drive paths such as C:\Users\me.
+const (
+	pathStyleMSYS   = "msys"   // /c/Users/me, for Git for Windows and its bundled OpenSSH
+	pathStyleWSL    = "wsl"    // /mnt/c/Users/me, for git and ssh running inside WSL
+	pathStyleNative = "native" // C:/Users/me, for the OpenSSH that ships with Windows
+)
+
+// pathStyles lists the values accepted by --path-style
+var pathStyles = []string{pathStyleMSYS, pathStyleWSL, pathStyleNative}
+
+// pathStyle is the style used for the current run, set by --path-style
+var pathStyle = detectPathStyle()
+
+// includePathStyles lists the values accepted by --include-path-style. Git
+// matches gitdir: conditions against the real path of the repository, so
+// Git for Windows needs C:/Users/me and git inside WSL /mnt/c/Users/me; the
+// /c/Users/me form ssh takes matches neither.
+var includePathStyles = []string{pathStyleNative, pathStyleWSL}
+
+// includePathStyle is the style of the includeIf conditions and include paths
+// for the current run, set by --include-path-style independently of pathStyle
+var includePathStyle = detectIncludePathStyle()
+
+// detectPathStyle guesses the style the tools reading the config expect
+func detectPathStyle() string {
+	if runtime.GOOS != "windows" {
+		return pathStyleNative // Paths are already POSIX paths
+	}
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return pathStyleWSL
+	}
+	if os.Getenv("MSYSTEM") != "" {
+		return pathStyleMSYS
+	}
+	// Git only uses Windows' own OpenSSH when told to
+	for _, env := range []string{"GIT_SSH", "GIT_SSH_COMMAND"} {
+		if strings.Contains(strings.ToLower(os.Getenv(env)), `system32\openssh`) {
+			return pathStyleNative
+		}
+	}
+	return pathStyleMSYS
+}
+
+// detectIncludePathStyle guesses which git reads the global config
+func detectIncludePathStyle() string {
+	if runtime.GOOS == "windows" && os.Getenv("WSL_DISTRO_NAME") != "" {
+		return pathStyleWSL
+	}
+	return pathStyleNative
+}
+
+// validateIncludePathStyle checks the value of --include-path-style
+func validateIncludePathStyle(s string) error {
+	if !slices.Contains(includePathStyles, s) {
+		return fmt.Errorf("unsupported include path style '%s' (supported: %s)", s, strings.Join(includePathStyles, ", "))
+	}
+	return nil
+}
+
+// validatePathStyle checks the value of --path-style
+func validatePathStyle(s string) error {
+	if !slices.Contains(pathStyles, s) {
+		return fmt.Errorf("unsupported path style '%s' (supported: %s)", s, strings.Join(pathStyles, ", "))
+	}
+	return nil
+}
+
+// hasDriveLetter reports whether path starts with a Windows drive, e.g. C:\ or C:/
+func hasDriveLetter(path string) bool {
+	if len(path) < 3 || path[1] != ':' || (path[2] != '\\' && path[2] != '/') {
+		return false
+	}
+	drive := path[0]
+	return (drive >= 'a' && drive <= 'z') || (drive >= 'A' && drive <= 'Z')
+}
+
+// convertPath converts a Windows drive path to style. Backslashes become
+// forward slashes in every style: git config treats a backslash as an escape
+// character, and Windows' OpenSSH accepts C:/ paths as well. Other paths are
+// returned unchanged.
+func convertPath(path, style string) string {
+	if !hasDriveLetter(path) {
+		return path
+	}
+	p := strings.ReplaceAll(path, `\`, "/")
+	drive, rest := strings.ToLower(p[:1]), p[2:]
+	switch style {
+	case pathStyleWSL:
+		return "/mnt/" + drive + rest
+	case pathStyleNative:
+		return strings.ToUpper(drive) + ":" + rest
+	default:
+		return "/" + drive + rest
+	}
+}
+
+// styledPath converts path to the style of the current run
+func styledPath(path string) string {
+	return convertPath(path, pathStyle)
+}
+
+// includePath converts path to the form git expects in includeIf conditions
+// and include paths, in the style of --include-path-style: forward slashes
+// with the drive letter kept (C:/Users/me), which Git for Windows matches
+// against, or /mnt/c/Users/me for git in WSL. It does not follow --path-style.
+func includePath(path string) string {
+	if hasDriveLetter(path) {
+		return convertPath(path, includePathStyle)
+	}
+	return strings.ReplaceAll(path, `\`, "/")
+}
+
+// gitdirCondition returns the includeIf condition matching every repository
+// below dir. The pattern always ends in exactly one slash, which git expands
+// to match the whole tree (without it only dir itself would match). Drive
+// paths are on Windows file systems, which ignore case, so they get
+// "gitdir/i:" and match however the drive and folders are capitalized.
+func gitdirCondition(dir string) string {
+	prefix := "gitdir:"
+	if hasDriveLetter(dir) {
+		prefix = "gitdir/i:"
+	}
+	return prefix + strings.TrimRight(includePath(dir), "/") + "/"
+}
+
+// gitdirPatternWarning returns why the --gitdir-pattern glob may match more
+// or less than meant, or "" when it looks specific. Git only anchors patterns
+// that start with /, ~/, ./ or a drive, and matches any other anywhere.
+func gitdirPatternWarning(pattern string) string {
+	slashed := strings.ReplaceAll(pattern, `\`, "/")
+	if !strings.HasPrefix(slashed, "/") && !strings.HasPrefix(slashed, "~/") && !strings.HasPrefix(slashed, "./") && !hasDriveLetter(slashed) {
+		return fmt.Sprintf("gitdir pattern '%s' is not anchored, so git matches it in any directory (as **/%s)", pattern, pattern)
+	}
+	if !strings.HasSuffix(slashed, "/") && !strings.HasSuffix(slashed, "**") {
+		return fmt.Sprintf("gitdir pattern '%s' only matches a .git directory itself; end it with / to match every repository below it", pattern)
+	}
+
+	// The fixed part of the pattern, up to the last slash before a wildcard
+	root := slashed
+	if i := strings.IndexAny(slashed, "*?["); i >= 0 {
+		root = slashed[:strings.LastIndex(slashed[:i], "/")+1]
+	}
+	homeDir, err := userHomeDir()
+	if err != nil || strings.HasPrefix(root, "./") {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(root, "~/"); ok {
+		root = filepath.Join(homeDir, rest)
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(root), homeDir)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Sprintf("gitdir pattern '%s' matches every repository below %s, which includes your whole home directory", pattern, stylePath.Render(filepath.FromSlash(root)))
+	}
+	return ""
+}
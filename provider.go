@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Git providers accepted by --provider
+const (
+	providerGitHub    = "github"
+	providerGitLab    = "gitlab"
+	providerBitbucket = "bitbucket"
+	providerGitea     = "gitea"
+	providerCustom    = "custom" // Any other host, given with --provider-host
+)
+
+// providers lists the values accepted by --provider
+var providers = []string{providerGitHub, providerGitLab, providerBitbucket, providerGitea, providerCustom}
+
+// providerInfo describes where a provider lives and where users add their keys
+type providerInfo struct {
+	Name     string // Display name
+	Host     string // Public host, used unless --provider-host points at a self-hosted one
+	KeysPath string // Path of the SSH keys settings page on the host
+	KeysPage string // What the settings page is called
+}
+
+// providerInfos holds the known providers; custom has no entry
+var providerInfos = map[string]providerInfo{
+	providerGitHub:    {"GitHub", "github.com", "/settings/keys", "SSH and GPG keys"},
+	providerGitLab:    {"GitLab", "gitlab.com", "/-/user_settings/ssh_keys", "SSH Keys"},
+	providerBitbucket: {"Bitbucket", "bitbucket.org", "/account/settings/ssh-keys/", "SSH keys"},
+	providerGitea:     {"Gitea", "gitea.com", "/user/settings/keys", "SSH / GPG Keys"},
+}
+
+// keyRecommendation is the SSH key a provider advises in its documentation
+type keyRecommendation struct {
+	KeyType    string   // Type new keys default to for the provider
+	MinRSABits int      // Smallest rsa key the provider accepts by default, 0 for no limit of its own
+	Deprecated []string // Key types the provider no longer accepts
+}
+
+// keyRecommendations holds the advice of the known providers; custom has no
+// entry and keeps the default key type. Update it when a provider changes its
+// advice.
+var keyRecommendations = map[string]keyRecommendation{
+	providerGitHub:    {KeyType: "ed25519", Deprecated: []string{"dsa"}},
+	providerGitLab:    {KeyType: "ed25519", Deprecated: []string{"dsa"}},
+	providerBitbucket: {KeyType: "ed25519", Deprecated: []string{"dsa"}},
+	providerGitea:     {KeyType: "ed25519", MinRSABits: 3071, Deprecated: []string{"dsa"}},
+}
+
+// recommendedKeyType returns the key type to default to for provider
+func recommendedKeyType(provider string) string {
+	if recommendation, ok := keyRecommendations[provider]; ok {
+		return recommendation.KeyType
+	}
+	return keyTypes[0]
+}
+
+// keyTypeWarning returns why the provider of data would refuse a key of
+// keyType, with bits for rsa, or "" when it accepts it
+func keyTypeWarning(data FormData, keyType string, bits int) string {
+	recommendation, ok := keyRecommendations[data.Provider]
+	if !ok {
+		return ""
+	}
+	if slices.Contains(recommendation.Deprecated, keyType) {
+		return fmt.Sprintf("%s no longer accepts %s keys; generate a new key with --%s %s instead",
+			providerName(data), keyType, flagKeyType, recommendation.KeyType)
+	}
+	if keyType == "rsa" && bits > 0 && bits < recommendation.MinRSABits {
+		return fmt.Sprintf("%s rejects rsa keys under %d bits by default; use --%s %d or more, or --%s %s",
+			providerName(data), recommendation.MinRSABits, flagRSABits, recommendation.MinRSABits+1, flagKeyType, recommendation.KeyType)
+	}
+	return ""
+}
+
+// publicKeyWarning is keyTypeWarning for an existing public key. DSA keys,
+// which this tool cannot generate, are named here so they can be warned about.
+func publicKeyWarning(data FormData, key ssh.PublicKey) string {
+	keyType, bits := publicKeyType(key)
+	if key.Type() == ssh.KeyAlgoDSA {
+		keyType = "dsa"
+	}
+	return keyTypeWarning(data, keyType, bits)
+}
+
+// providerKeyWarning is keyTypeWarning for the key of data: the existing key
+// when one is reused, else the type and size to generate
+func providerKeyWarning(data FormData) string {
+	if data.ExistingKey == "" {
+		return keyTypeWarning(data, data.KeyType, data.RSABits)
+	}
+	key, err := readImportedKey(data.ExistingKey + ".pub")
+	if err != nil {
+		return "" // validateExistingKey reports keys that cannot be read
+	}
+	return publicKeyWarning(data, key.key)
+}
+
+// validateProvider checks the value of --provider
+func validateProvider(s string) error {
+	if !slices.Contains(providers, s) {
+		return fmt.Errorf("unsupported provider '%s' (supported: %s)", s, strings.Join(providers, ", "))
+	}
+	return nil
+}
+
+// providerSelfHostable reports whether the form asks for the host of provider:
+// always for custom, and for the providers that are commonly self-hosted
+func providerSelfHostable(provider string) bool {
+	return provider == providerCustom || provider == providerGitLab || provider == providerGitea
+}
+
+// providerHost returns the host of the provider of data: --provider-host if
+// given, else the provider's public host
+func providerHost(data FormData) string {
+	if data.ProviderHost != "" {
+		return data.ProviderHost
+	}
+	if info, ok := providerInfos[data.Provider]; ok {
+		return info.Host
+	}
+	return defaultSSHHostName
+}
+
+// providerName returns the name to show for the provider of data
+func providerName(data FormData) string {
+	if info, ok := providerInfos[data.Provider]; ok {
+		return info.Name
+	}
+	return providerHost(data)
+}
+
+// providerKeysURL returns the page to add SSH keys on, or "" for a custom provider
+func providerKeysURL(data FormData) string {
+	info, ok := providerInfos[data.Provider]
+	if !ok {
+		return ""
+	}
+	return "https://" + providerHost(data) + info.KeysPath
+}
+
+// providerKeysHint tells the user where to add their key
+func providerKeysHint(data FormData) string {
+	info, ok := providerInfos[data.Provider]
+	if !ok {
+		return "Find this under SSH keys (or similar) in your account settings on " + providerHost(data) + "."
+	}
+	return "Find this under " + info.KeysPage + " in your account settings: " + providerKeysURL(data)
+}
+
+// sshHostName returns the HostName for the ssh config entry: --ssh-hostname if
+// given, else the provider's host
+func sshHostName(data FormData) string {
+	if data.SSHHostName != "" {
+		return data.SSHHostName
+	}
+	return providerHost(data)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// proxySchemes are the proxy protocols git understands in http.proxy
+var proxySchemes = []string{"http", "https", "socks", "socks4", "socks4a", "socks5", "socks5h"}
+
+// validateHTTPProxy checks the value of --http-proxy: a proxy URL such as
+// http://proxy.example.com:3128, or host:port, which git reads as http
+func validateHTTPProxy(s string) error {
+	if strings.ContainsAny(s, "\"\r\n\t ") {
+		return fmt.Errorf("proxy cannot contain quotes or whitespace")
+	}
+	raw := s
+	if !strings.Contains(s, "://") {
+		raw = "http://" + s
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return fmt.Errorf("'%s' is not a proxy URL, e.g. http://proxy.example.com:3128", s)
+	}
+	if !slices.Contains(proxySchemes, u.Scheme) {
+		return fmt.Errorf("unsupported proxy protocol '%s' (supported: %s)", u.Scheme, strings.Join(proxySchemes, ", "))
+	}
+	return nil
+}
+
+// validateProxyURL checks the value of --http-proxy-url, the remote URL the
+// proxy is limited to with http.<url>.proxy
+func validateProxyURL(s string) error {
+	if strings.ContainsAny(s, "\"\r\n\t ") {
+		return fmt.Errorf("proxy URL cannot contain quotes or whitespace")
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("'%s' is not an http(s) URL, e.g. https://github.com", s)
+	}
+	return nil
+}
+
+// validateGitProxy checks the value of --git-proxy, the command git runs to
+// connect to git:// remotes
+func validateGitProxy(s string) error {
+	if strings.TrimSpace(s) == "" {
+		return fmt.Errorf("git proxy command cannot be empty")
+	}
+	if strings.ContainsAny(s, "\r\n") {
+		return fmt.Errorf("git proxy command must be a single line")
+	}
+	return nil
+}
+
+// checkProxyFields checks the proxy settings of data, for batch entries,
+// which have no flags to check
+func checkProxyFields(data FormData) error {
+	if data.HTTPProxy != "" {
+		if err := validateHTTPProxy(data.HTTPProxy); err != nil {
+			return err
+		}
+	}
+	if data.HTTPProxyURL != "" {
+		if data.HTTPProxy == "" {
+			return fmt.Errorf("http_proxy_url only applies with http_proxy")
+		}
+		if err := validateProxyURL(data.HTTPProxyURL); err != nil {
+			return err
+		}
+	}
+	if data.GitProxy != "" {
+		return validateGitProxy(data.GitProxy)
+	}
+	return nil
+}
+
+// proxySection returns the section http.proxy goes into for data: [http],
+// or [http "<url>"] when the proxy is limited to one remote URL
+func proxySection(data FormData) string {
+	if data.HTTPProxyURL != "" {
+		return fmt.Sprintf(`http "%s"`, data.HTTPProxyURL)
+	}
+	return "http"
+}
+
+// proxyWarning explains that the proxy settings of an SSH context do not
+// reach its remotes, as ssh ignores both, or returns ""
+func proxyWarning(data FormData) string {
+	if usesHTTPS(data) || (data.HTTPProxy == "" && data.GitProxy == "") {
+		return ""
+	}
+	return "http.proxy only applies to HTTP(S) remotes and core.gitProxy to git:// remotes; ssh, which this context's key is for, ignores both. " +
+		"To reach SSH remotes through a proxy, add a ProxyCommand or ProxyJump to ~/.ssh/config"
+}
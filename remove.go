@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// removeOptions holds the flags of the remove subcommand
+type removeOptions struct {
+	AssumeYes  bool
+	KeepConfig bool
+	KeepKey    bool
+}
+
+// newRemoveFlagSet defines the flags of the remove subcommand, storing their values in opts
+func newRemoveFlagSet(opts *removeOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" remove", flag.ContinueOnError)
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	addNoBorderFlag(fs)
+	addHomeFlag(fs)
+	fs.BoolVar(&opts.AssumeYes, "yes", false, "do not ask for confirmation before deleting")
+	fs.BoolVar(&opts.KeepConfig, "keep-config", false, "keep the directory's local .gitconfig")
+	fs.BoolVar(&opts.KeepKey, "keep-key", false, "keep the SSH key pair")
+	return fs
+}
+
+// runRemove implements the remove subcommand, undoing what setup created for a directory
+func runRemove(args []string) error {
+	var opts removeOptions
+	fs := newRemoveFlagSet(&opts)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError(fmt.Errorf("usage: %s remove [--yes] [--keep-config] [--keep-key] <directory>", appName))
+	}
+
+	absPath, err := resolveTargetDir(positional[0])
+	if err != nil {
+		return err
+	}
+	globalGitConfigPath, err := resolveGlobalGitConfigPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadGitConfig(globalGitConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+	}
+
+	// Locate the include and the local config it points at
+	localConfigPath := contextConfigPath(cfg, globalGitConfigPath, absPath)
+
+	// Every includeIf pointing at the local config belongs to the context,
+	// whether it matches by directory or by remote URL
+	sectionNames := []string{}
+	for _, section := range cfg.Sections() {
+		if !includeIfPattern.MatchString(section.Name()) || !section.HasKey("path") {
+			continue
+		}
+		if filepath.Clean(resolveIncludePath(globalGitConfigPath, section.Key("path").String())) == filepath.Clean(localConfigPath) {
+			sectionNames = append(sectionNames, section.Name())
+		}
+	}
+
+	// The key file name embeds a UUID, so discover it from the local config
+	localConfigExists := false
+	keyPath, signingKeyPath, signersFile := "", "", ""
+	if _, err := os.Stat(localConfigPath); err == nil {
+		localConfigExists = true
+		if local, err := loadGitConfig(localConfigPath); err == nil {
+			keyPath = sshCommandKeyPath(local.Section("core").Key("sshCommand").String())
+			// A separate signing key, as opposed to signing with the key above
+			if local.Section("gpg").Key("format").String() == "ssh" {
+				signingPath := signingKeyFile(localConfigPath, local.Section("user").Key("signingkey").String())
+				if signingPath != "" && !samePath(signingPath, keyPath+".pub") {
+					signingKeyPath = strings.TrimSuffix(signingPath, ".pub")
+				}
+			}
+			if file := local.Section(`gpg "ssh"`).Key("allowedSignersFile").String(); file != "" {
+				signersFile = resolveIncludePath(localConfigPath, convertFromLinuxPath(file))
+			}
+		}
+	}
+
+	if len(sectionNames) == 0 && !localConfigExists {
+		return fmt.Errorf("no context found for '%s'", stylePath.Render(absPath))
+	}
+
+	messages := []string{}
+
+	// 1. Remove the includeIf sections from the global config
+	if len(sectionNames) > 0 {
+		ok, err := confirm(fmt.Sprintf("Remove [%s] from %s?", strings.Join(sectionNames, "], ["), globalGitConfigPath), opts.AssumeYes)
+		if err != nil {
+			return err
+		}
+		if ok {
+			unlock, err := lockConfigFile(globalGitConfigPath)
+			if err != nil {
+				return err
+			}
+			err = editGitConfigFile(globalGitConfigPath, sectionNames, nil)
+			unlock()
+			if err != nil {
+				return fmt.Errorf("failed to save updated global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+			}
+			messages = append(messages, styleWarn.Render("Removed includeIf from global .gitconfig:")+" "+stylePath.Render(globalGitConfigPath))
+		}
+	}
+
+	// 2. Delete the local .gitconfig
+	if localConfigExists && !opts.KeepConfig {
+		ok, err := confirm(fmt.Sprintf("Delete %s?", localConfigPath), opts.AssumeYes)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := os.Remove(localConfigPath); err != nil {
+				return fmt.Errorf("failed to delete local .gitconfig '%s': %w", stylePath.Render(localConfigPath), err)
+			}
+			messages = append(messages, styleWarn.Render("Deleted local .gitconfig:")+" "+stylePath.Render(localConfigPath))
+		}
+	}
+
+	// 3. Delete the SSH key pair, unless another context reuses it
+	if keyPath != "" && !opts.KeepKey {
+		if kept := keptSharedKey(keyPath, "SSH key", localConfigPath); kept != "" {
+			messages = append(messages, kept)
+		} else {
+			removed, err := removeKeyPair(keyPath, "SSH key", signersFile, opts.AssumeYes)
+			messages = append(messages, removed...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// 4. Delete the separate signing key pair the same way
+	if signingKeyPath != "" && !opts.KeepKey {
+		if kept := keptSharedKey(signingKeyPath, "signing key", localConfigPath); kept != "" {
+			messages = append(messages, kept)
+		} else {
+			removed, err := removeKeyPair(signingKeyPath, "signing key", signersFile, opts.AssumeYes)
+			messages = append(messages, removed...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(messages) == 0 {
+		messages = append(messages, styleInfo.Render("Nothing was removed."))
+	} else {
+		messages = append(messages, "", styleGood.Render("Context removed for:")+" "+stylePath.Render(absPath))
+	}
+	printBorderedMessages(messages)
+	return nil
+}
+
+// removeKeyPair deletes the key pair at keyPath after asking, along with the
+// allowed signers entries (in signersFile, if any) and ~/.ssh/config Host
+// blocks setup added for it. what names the key in prompts and messages.
+func removeKeyPair(keyPath, what, signersFile string, assumeYes bool) ([]string, error) {
+	if _, err := os.Stat(keyPath); err != nil {
+		return nil, nil
+	}
+	ok, err := confirm(fmt.Sprintf("Delete %s pair %s(.pub)?", what, keyPath), assumeYes)
+	if err != nil || !ok {
+		return nil, err
+	}
+	// Read before deleting: the entries to remove are found by the public key
+	publicKey, _ := os.ReadFile(keyPath + ".pub")
+	for _, path := range []string{keyPath, keyPath + ".pub"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to delete %s '%s': %w", what, stylePath.Render(path), err)
+		}
+	}
+	messages := []string{styleKey.Render("Deleted "+what+" pair:") + " " + stylePath.Render(keyPath)}
+
+	if signersFile != "" && len(publicKey) > 0 {
+		removed, err := removeAllowedSigner(signersFile, string(publicKey))
+		if err != nil {
+			return messages, err
+		}
+		if removed {
+			messages = append(messages, styleWarn.Render("Removed the key from allowed signers:")+" "+stylePath.Render(signersFile))
+		}
+	}
+	sshConfigPath, aliases, err := removeSSHConfigHosts(keyPath)
+	if err != nil {
+		return messages, err
+	}
+	if len(aliases) > 0 {
+		messages = append(messages, styleWarn.Render("Removed Host "+strings.Join(aliases, ", ")+" from the ssh config:")+" "+stylePath.Render(sshConfigPath))
+	}
+	return messages, nil
+}
+
+// keptSharedKey returns the message for keeping the key at keyPath (what
+// names it) because another context uses it, or empty if it can go. A key
+// whose use cannot be checked is kept too.
+func keptSharedKey(keyPath, what, localConfigPath string) string {
+	used, err := keyUsedByOtherContext(keyPath, localConfigPath)
+	if err != nil {
+		return styleWarn.Render("Kept "+what+", as other contexts could not be checked ("+err.Error()+"):") + " " + stylePath.Render(keyPath)
+	}
+	if used {
+		return styleInfo.Render("Kept "+what+" still used by another context:") + " " + stylePath.Render(keyPath)
+	}
+	return ""
+}
+
+// keyUsedByOtherContext reports whether any context other than the one using
+// localConfigPath references keyPath in its core.sshCommand or signs with it.
+// A context whose config cannot be read is an error, not a context without the key.
+func keyUsedByOtherContext(keyPath, localConfigPath string) (bool, error) {
+	_, contexts, err := loadContexts()
+	if err != nil {
+		return false, err
+	}
+	for _, ctx := range contexts {
+		if ctx.Missing || samePath(ctx.ConfigPath, localConfigPath) {
+			continue
+		}
+		local, err := loadGitConfig(ctx.ConfigPath)
+		if err != nil {
+			return false, fmt.Errorf("failed to load local .gitconfig '%s': %w", stylePath.Render(ctx.ConfigPath), err)
+		}
+		if usedPath := sshCommandKeyPath(local.Section("core").Key("sshCommand").String()); usedPath != "" && samePath(usedPath, keyPath) {
+			return true, nil
+		}
+		if signingPath := signingKeyFile(ctx.ConfigPath, local.Section("user").Key("signingkey").String()); signingPath != "" && samePath(signingPath, keyPath+".pub") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
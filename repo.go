@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// isGitRepo reports whether dir already has a .git directory, or a .git file
+// as in worktrees and submodules
+func isGitRepo(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// gitInitArgs builds the git arguments that initialize a repository in dir
+func gitInitArgs(dir, initialBranch string) []string {
+	args := []string{"-C", dir, "init"}
+	if initialBranch != "" {
+		args = append(args, "-b", initialBranch)
+	}
+	return args
+}
+
+// gitInit runs `git init` in dir unless it already is a repository, and
+// reports whether a repository was created
+func gitInit(dir, initialBranch string) (bool, error) {
+	if isGitRepo(dir) {
+		return false, nil
+	}
+	output, err := execCommand("git", gitInitArgs(dir, initialBranch)...).CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("git init in '%s' failed: %w\n%s", stylePath.Render(dir), err, strings.TrimSpace(string(output)))
+	}
+	return true, nil
+}
+
+// initContextRepo runs git init for --git-init in absPath, recording a new
+// repository in result and undo
+func initContextRepo(absPath string, data FormData, result *setupResult, undo *rollback) error {
+	logStep("Initializing a git repository in %s", stylePath.Render(absPath))
+	var err error
+	result.GitInitialized, err = gitInit(absPath, data.InitialBranch)
+	if err != nil {
+		return err
+	}
+	if result.GitInitialized {
+		gitDir := filepath.Join(absPath, ".git")
+		undo.add("initialized git repository "+gitDir, func() error { return os.RemoveAll(gitDir) })
+	}
+	return nil
+}
+
+// sshURLHost returns the host of an SSH remote URL, either ssh://[user@]host[:port]/path
+// or the scp-like [user@]host:path. ok is false for other URLs (https, local paths).
+func sshURLHost(url string) (host string, ok bool) {
+	if rest, found := strings.CutPrefix(url, "ssh://"); found {
+		url = rest
+	} else if rest, found := strings.CutPrefix(url, "git+ssh://"); found {
+		url = rest
+	} else if strings.Contains(url, "://") {
+		return "", false
+	} else {
+		// scp-like syntax needs a colon before the first slash
+		colon := strings.Index(url, ":")
+		if colon < 0 || (strings.Contains(url[:colon], "/")) {
+			return "", false
+		}
+		url = url[:colon]
+	}
+
+	host, _, _ = strings.Cut(url, "/")
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	if h, _, found := strings.Cut(host, ":"); found {
+		host = h
+	}
+	// A single letter is a Windows drive (C:\repo), not a host
+	if len(host) < 2 {
+		return "", false
+	}
+	return host, true
+}
+
+// addOrigin adds url as the origin remote of the repository in dir. An
+// existing origin is left alone and its URL returned instead.
+func addOrigin(dir, url string) (added bool, existing string, err error) {
+	if output, err := execCommand("git", "-C", dir, "remote", "get-url", "origin").Output(); err == nil {
+		return false, strings.TrimSpace(string(output)), nil
+	}
+	output, err := execCommand("git", "-C", dir, "remote", "add", "origin", url).CombinedOutput()
+	if err != nil {
+		return false, "", fmt.Errorf("git remote add origin in '%s' failed: %w\n%s", stylePath.Render(dir), err, strings.TrimSpace(string(output)))
+	}
+	return true, "", nil
+}
+
+// remoteHostWarning cross-checks the host of an SSH origin URL against the ssh
+// config set up for the context and explains any mismatch, or returns ""
+func remoteHostWarning(data FormData) string {
+	host, ok := sshURLHost(data.Remote)
+	if !ok {
+		return ""
+	}
+	if data.SSHHostAlias != "" {
+		if host == data.SSHHostAlias || strings.EqualFold(host, sshHostName(data)) {
+			return ""
+		}
+		return fmt.Sprintf("origin uses host %s, but the host alias %s of this key points at %s", host, data.SSHHostAlias, sshHostName(data))
+	}
+
+	// A Host entry of its own may offer a different IdentityFile next to this key
+	sshDir, err := defaultSSHDir()
+	if err != nil {
+		return ""
+	}
+	content, err := os.ReadFile(filepath.Join(sshDir, "config"))
+	if err != nil || !sshConfigHasHost(string(content), host) {
+		return ""
+	}
+	return fmt.Sprintf("origin uses the ssh config alias %s; inside this directory core.sshCommand offers the new key first, but the alias's own IdentityFile is offered too", host)
+}
+
+// nearestExistingDir returns path, or its closest ancestor that exists
+func nearestExistingDir(path string) string {
+	dir := filepath.Clean(path)
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// enclosingRepo returns the top level of the git repository dir (or its
+// nearest existing ancestor) belongs to, the user.email in effect there and the
+// scope it comes from (local, global, ...). ok is false outside a repository
+// or without git.
+func enclosingRepo(dir string) (root, email, scope string, ok bool) {
+	existing := nearestExistingDir(dir)
+	output, err := execCommand("git", "-C", existing, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", "", "", false
+	}
+	root = filepath.FromSlash(strings.TrimSpace(string(output)))
+	// A missing key exits with 1, which just means there is no identity yet
+	output, err = execCommand("git", "-C", existing, "config", "--show-scope", "--get", "user.email").Output()
+	if err != nil {
+		// --show-scope needs Git 2.26
+		output, _ = execCommand("git", "-C", existing, "config", "--get", "user.email").Output()
+		return root, strings.TrimSpace(string(output)), "", true
+	}
+	scope, email, _ = strings.Cut(strings.TrimSpace(string(output)), "\t")
+	return root, email, scope, true
+}
+
+// identityConflict explains how setting up email for dir clashes with the
+// identity of a repository it already belongs to, or returns ""
+func identityConflict(dir, email string) string {
+	root, current, scope, ok := enclosingRepo(dir)
+	if !ok || current == "" || strings.EqualFold(current, email) {
+		return ""
+	}
+	if samePath(root, dir) {
+		// The repository's own config outranks anything included from the global one
+		if scope == "local" || scope == "worktree" {
+			return fmt.Sprintf("%s is already a git repository whose own config sets user.email = %s, which overrides %s; run git config --unset user.email in it to switch", dir, current, email)
+		}
+		return fmt.Sprintf("%s is already a git repository committing as %s; it would commit as %s from now on", dir, current, email)
+	}
+	return fmt.Sprintf("%s is inside the git repository %s, which commits as %s; %s would only apply to repositories inside %s, not to %s", dir, root, current, email, dir, root)
+}
+
+// confirmIdentityConflict lets setup go ahead despite conflict: always with
+// --force, after asking on a terminal, and never otherwise
+func confirmIdentityConflict(conflict string, opts cliOptions) error {
+	if opts.Force {
+		logWarn("%s", conflict)
+		return nil
+	}
+	if opts.NonInteractive || opts.AssumeYes || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("%s; pass --force to set it up anyway", conflict)
+	}
+	logWarn("%s", conflict)
+	ok, err := confirm("Set up the new identity anyway?", false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return abortError("aborted, the existing identity was kept")
+	}
+	return nil
+}
+
+// gitignorePattern escapes the characters .gitignore treats as wildcards
+var gitignorePattern = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
+// gitignoreEntries returns the files among paths that are inside the
+// repository at root, as .gitignore lines anchored to it. Files elsewhere
+// cannot be committed and are left out.
+func gitignoreEntries(root string, paths []string) []string {
+	entries := []string{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		entry := "/" + gitignorePattern.Replace(filepath.ToSlash(rel))
+		if !slices.Contains(entries, entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// appendToGitignore adds the entries the .gitignore in root does not list yet,
+// with or without the leading slash, and returns them
+func appendToGitignore(root string, entries []string) ([]string, error) {
+	path := filepath.Join(root, ".gitignore")
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read '%s': %w", stylePath.Render(path), err)
+	}
+	existing := map[string]bool{}
+	for _, line := range strings.Split(string(content), "\n") {
+		existing[strings.TrimPrefix(strings.TrimSpace(line), "/")] = true
+	}
+	added := []string{}
+	for _, entry := range entries {
+		if !existing[strings.TrimPrefix(entry, "/")] {
+			added = append(added, entry)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	var text strings.Builder
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		text.WriteString("\n")
+	}
+	text.WriteString("# Keys and identity written by " + appName + "\n")
+	for _, entry := range added {
+		text.WriteString(entry + "\n")
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, configFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%s': %w", stylePath.Render(path), err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(text.String()); err != nil {
+		return nil, fmt.Errorf("failed to write '%s': %w", stylePath.Render(path), err)
+	}
+	return added, nil
+}
+
+// useRepoConfig reports whether the local .gitconfig of data is included from
+// the repository's own config instead of the global one: with --repo-local, when
+// dir is a repository or --git-init makes it one
+func useRepoConfig(dir string, data FormData) bool {
+	return data.RepoLocal && (data.GitInit || isGitRepo(dir))
+}
+
+// repoConfigPath returns the config file of the repository in dir, which its
+// worktrees share
+func repoConfigPath(dir string) (string, error) {
+	output, err := execCommand("git", "-C", dir, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the git directory of '%s': %w", stylePath.Render(dir), err)
+	}
+	gitDir := filepath.FromSlash(strings.TrimSpace(string(output)))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	return filepath.Join(gitDir, "config"), nil
+}
+
+// repoIncludePath returns the include.path value that loads localConfigPath
+// from repoConfig: relative, so the repository can be moved, where possible
+func repoIncludePath(repoConfig, localConfigPath string) string {
+	if rel, err := filepath.Rel(filepath.Dir(repoConfig), localConfigPath); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return includePath(localConfigPath)
+}
+
+// repoIncludeSection returns the section of the repository config that
+// includes the local .gitconfig, for branch if set
+func repoIncludeSection(branch string) string {
+	if branch == "" {
+		return "include"
+	}
+	return fmt.Sprintf(`includeIf "%s%s"`, onbranchPrefix, branch)
+}
+
+// repoIncludeKey returns the key that includes the local config from the
+// repository's own config: include.path, or an onbranch includeIf for branch
+func repoIncludeKey(branch string) string {
+	if branch == "" {
+		return "include.path"
+	}
+	return "includeIf." + onbranchPrefix + branch + ".path"
+}
+
+// addRepoInclude makes the repository in dir load localConfigPath through an
+// [include] in its own config, or an onbranch includeIf when branch is set,
+// leaving the rest of that file untouched. It returns the repository config
+// and whether the include was added.
+func addRepoInclude(dir, localConfigPath, branch string) (string, bool, error) {
+	repoConfig, err := repoConfigPath(dir)
+	if err != nil {
+		return "", false, err
+	}
+	key := repoIncludeKey(branch)
+	// A missing key exits with 1, which just means there are no includes yet
+	output, _ := execCommand("git", "config", "--file", repoConfig, "--get-all", key).Output()
+	for _, existing := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if existing != "" && samePath(resolveIncludePath(repoConfig, existing), localConfigPath) {
+			logDetail("%s already includes %s", repoConfig, existing)
+			return repoConfig, false, nil
+		}
+	}
+
+	value := repoIncludePath(repoConfig, localConfigPath)
+	logDetail("%s = %s", key, value)
+	output, err = execCommand("git", "config", "--file", repoConfig, "--add", key, value).CombinedOutput()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to add %s to '%s': %w\n%s", key, stylePath.Render(repoConfig), err, strings.TrimSpace(string(output)))
+	}
+	return repoConfig, true, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/term"
+)
+
+// rollback records how to undo each completed setup step, so a failure
+// midway does not leave a half-configured context behind
+type rollback struct {
+	steps []rollbackStep
+}
+
+// rollbackStep is one completed change and the function that reverts it
+type rollbackStep struct {
+	description string
+	undo        func() error
+}
+
+// add records a completed change
+func (r *rollback) add(description string, undo func() error) {
+	r.steps = append(r.steps, rollbackStep{description, undo})
+	audit(auditEvent{Event: auditChange, Message: description})
+}
+
+// backupFile snapshots path before it is changed and returns a function that
+// puts the old content back, or removes the file if it did not exist
+func backupFile(path string) (func() error, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to back up '%s': %w", stylePath.Render(path), err)
+	}
+	existed := err == nil
+	var mode os.FileMode = configFileMode
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	return func() error {
+		if !existed {
+			return os.Remove(path)
+		}
+		return os.WriteFile(path, content, mode) // Follows symlinks, like saveConfigAtomic
+	}, nil
+}
+
+// finish handles the error that stopped processFormData: unless keep is set,
+// it offers to undo the recorded steps (newest first) and reports the outcome
+func (r *rollback) finish(cause error, keep, assumeYes bool) error {
+	if len(r.steps) == 0 {
+		return cause
+	}
+
+	if !keep {
+		undo := true
+		if !assumeYes && term.IsTerminal(int(os.Stdin.Fd())) {
+			logAt(levelQuiet, styleWarn.Render("Setup failed after these changes:"))
+			r.print()
+			var err error
+			undo, err = confirm("Undo them?", false)
+			if err != nil {
+				undo = false
+			}
+		}
+		if undo {
+			return r.run(cause)
+		}
+	}
+
+	logAt(levelQuiet, styleWarn.Render("Kept the partial changes:"))
+	r.print()
+	return cause
+}
+
+// print lists the recorded steps on stderr, even with --quiet as they explain an error
+func (r *rollback) print() {
+	for _, step := range r.steps {
+		logAt(levelQuiet, "  %s", step.description)
+	}
+}
+
+// run undoes every recorded step, newest first, and keeps going past failures
+func (r *rollback) run(cause error) error {
+	errs := []error{cause}
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		step := r.steps[i]
+		if err := step.undo(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("could not undo (%s): %w", step.description, err))
+			continue
+		}
+		logInfo("%s %s", styleInfo.Render("Rolled back:"), step.description)
+		audit(auditEvent{Event: auditRollback, Message: step.description})
+	}
+	return errors.Join(errs...)
+}
+
+// firstMissingDir returns the topmost directory that os.MkdirAll(path) would
+// create, or "" if path already exists
+func firstMissingDir(path string) string {
+	missing := ""
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			return missing
+		}
+		missing = dir
+		if filepath.Dir(dir) == dir {
+			return missing
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"golang.org/x/term"
+)
+
+// rotateOptions holds the flags of the rotate subcommand
+type rotateOptions struct {
+	KeyType     string
+	Archive     bool
+	AssumeYes   bool
+	DryRun      bool
+	NoClipboard bool
+}
+
+// newRotateFlagSet defines the flags of the rotate subcommand, storing their values in opts
+func newRotateFlagSet(opts *rotateOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" rotate", flag.ContinueOnError)
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	addNoBorderFlag(fs)
+	addHomeFlag(fs)
+	fs.StringVar(&opts.KeyType, flagKeyType, "", "type of the new key (default: the type of the current key)")
+	fs.BoolVar(&opts.Archive, "archive", false, "rename the old key pair to <key>.rotated-<date> once the new key is in place")
+	fs.BoolVar(&opts.AssumeYes, "yes", false, "do not ask for confirmation before rotating")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "only show the changes")
+	fs.BoolVar(&opts.NoClipboard, "no-clipboard", false, "do not copy the new public key to the clipboard")
+	return fs
+}
+
+// rotatedSSHCommand returns sshCommand loading keyPath instead of the key it
+// loads now, with every other option kept as written
+func rotatedSSHCommand(sshCommand, keyPath string, hasPassphrase bool) string {
+	rotated := sshCommand
+	words := splitShellWords(sshCommand)
+	// Replace from the end so the spans of earlier words stay valid
+	for i := len(words) - 2; i >= 0; i-- {
+		if words[i].value == "-i" {
+			rotated = rotated[:words[i+1].start] + shellQuote(styledPath(keyPath)) + rotated[words[i+1].end:]
+		}
+	}
+	if hasPassphrase && !strings.Contains(rotated, "AddKeysToAgent") {
+		rotated += " -o AddKeysToAgent=yes"
+	}
+	return rotated
+}
+
+// rotatedKeyPath is where --archive moves the retired key at keyPath
+func rotatedKeyPath(keyPath string, now time.Time) string {
+	return keyPath + ".rotated-" + now.Format("2006-01-02")
+}
+
+// rotationKeyData describes the key replacing old: the same type and size
+// unless keyType asks for another type, and the same comment unless it is a
+// default one, which the new key gets afresh
+func rotationKeyData(old importedKey, keyType, username, email, sshDir string) FormData {
+	data := FormData{GitUsername: username, GitEmail: email, SSHDir: sshDir}
+	data.KeyType, data.RSABits = publicKeyType(old.key)
+	if data.KeyType == "ecdsa" {
+		data.ECDSACurve, data.RSABits = data.RSABits, 0
+	}
+	if keyType != "" && keyType != data.KeyType {
+		data.KeyType, data.RSABits, data.ECDSACurve = keyType, 0, 0
+	}
+	if fields := strings.Fields(old.Content); len(fields) > 2 && !isDefaultKeyComment(strings.Join(fields[2:], " "), data) {
+		data.KeyComment = strings.Join(fields[2:], " ")
+	}
+	applyFormDefaults(&data)
+	return data
+}
+
+// askRotationPassphrase asks for the passphrase of the new key, as the form does
+func askRotationPassphrase(data *FormData) error {
+	var confirmation string
+	return huh.NewForm(huh.NewGroup(
+		huh.NewInput().
+			Title("New Key Passphrase").
+			Description("Protect the new private key with a passphrase (leave empty for none)").
+			EchoMode(huh.EchoModePassword).
+			Value(&data.Passphrase),
+		huh.NewInput().
+			Title("Confirm Passphrase").
+			Description("Enter the passphrase again").
+			EchoMode(huh.EchoModePassword).
+			Value(&confirmation).
+			Validate(func(s string) error {
+				if s != data.Passphrase {
+					return fmt.Errorf("passphrases do not match")
+				}
+				return nil
+			}),
+	)).WithTheme(formTheme()).Run()
+}
+
+// runRotate implements the rotate subcommand, replacing the SSH key of a
+// context with a new one. The old public key stays in the allowed signers
+// file, so commits signed before the rotation still verify.
+func runRotate(args []string) (err error) {
+	var opts rotateOptions
+	fs := newRotateFlagSet(&opts)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError(fmt.Errorf("usage: %s rotate [--key-type TYPE] [--archive] [--yes] [--dry-run] <directory>", appName))
+	}
+	if opts.KeyType != "" {
+		if err := validateKeyType(opts.KeyType); err != nil {
+			return usageError(fmt.Errorf("invalid --%s: %w", flagKeyType, err))
+		}
+	}
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+
+	absPath, err := resolveTargetDir(positional[0])
+	if err != nil {
+		return err
+	}
+	globalGitConfigPath, err := resolveGlobalGitConfigPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadGitConfig(globalGitConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+	}
+	localConfigPath := contextConfigPath(cfg, globalGitConfigPath, absPath)
+	if _, err := os.Stat(localConfigPath); err != nil {
+		return fmt.Errorf("no context found for '%s' ('%s' does not exist)", stylePath.Render(absPath), stylePath.Render(localConfigPath))
+	}
+	local, err := loadGitConfig(localConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load '%s': %w", stylePath.Render(localConfigPath), err)
+	}
+	sshCommand := local.Section("core").Key("sshCommand").String()
+	oldKeyPath := sshCommandKeyPath(sshCommand)
+	if oldKeyPath == "" {
+		return fmt.Errorf("'%s' sets no key with core.sshCommand -i to rotate", stylePath.Render(localConfigPath))
+	}
+	oldKey, err := readImportedKey(oldKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	username := local.Section("user").Key("name").String()
+	email := local.Section("user").Key("email").String()
+	data := rotationKeyData(oldKey, opts.KeyType, username, email, filepath.Dir(oldKeyPath))
+	if err := checkDependencies(data, true, false); err != nil {
+		return err
+	}
+	keyName := defaultKeyName(absPath)
+	_, privateKeyPath, publicKeyPath, err := sshKeyPaths(data.SSHDir, keyName)
+	if err != nil {
+		return err
+	}
+
+	// Signing moves to the new key only when it signs with the old one; a
+	// separate signing key is left alone
+	signingKey := local.Section("user").Key("signingkey").String()
+	signsWithKey := local.Section("gpg").Key("format").String() == "ssh" && samePath(signingKeyFile(localConfigPath, signingKey), oldKeyPath+".pub")
+
+	messages := []string{
+		styleInfo.Render("Rotating the key of") + " " + stylePath.Render(localConfigPath),
+		"",
+		fmt.Sprintf("%-16s %s", "Old key", stylePath.Render(oldKeyPath)+" ("+oldKey.Fingerprint+")"),
+		fmt.Sprintf("%-16s %s", "New key", stylePath.Render(privateKeyPath)+" ("+data.KeyType+")"),
+	}
+	if signsWithKey {
+		messages = append(messages, fmt.Sprintf("%-16s %s", "Signing", "moves to the new key; the old key stays in the allowed signers file to verify past commits"))
+	} else if signingKey != "" {
+		messages = append(messages, fmt.Sprintf("%-16s %s", "Signing", "uses another key, which is not rotated"))
+	}
+	// Host blocks that setup wrote for the old key (--ssh-host-alias) move with it
+	sshDir, err := defaultSSHDir()
+	if err != nil {
+		return err
+	}
+	sshConfigPath := filepath.Join(sshDir, "config")
+	if content, err := os.ReadFile(sshConfigPath); err == nil {
+		if _, aliases := repointSSHConfigContent(string(content), sshConfigPath, oldKeyPath, privateKeyPath); len(aliases) > 0 {
+			messages = append(messages, fmt.Sprintf("%-16s %s", "SSH config", "Host "+strings.Join(aliases, ", ")+" moves to the new key"))
+		}
+	}
+	// Archiving a key that another context still uses would break that context
+	archive, notArchived := opts.Archive, ""
+	if archive {
+		used, err := keyUsedByOtherContext(oldKeyPath, localConfigPath)
+		switch {
+		case err != nil:
+			notArchived = "other contexts could not be checked (" + err.Error() + ")"
+		case used:
+			notArchived = "another context still uses it"
+		}
+		archive = notArchived == ""
+	}
+	if archive {
+		messages = append(messages, fmt.Sprintf("%-16s %s", "Archive", stylePath.Render(rotatedKeyPath(oldKeyPath, time.Now()))))
+	} else if notArchived != "" {
+		messages = append(messages, fmt.Sprintf("%-16s %s", "Archive", "skipped, "+notArchived))
+	}
+	printBorderedMessages(messages)
+	if opts.DryRun {
+		return nil
+	}
+	ok, err := confirm("Rotate the key?", opts.AssumeYes || !interactive)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return abortError("aborted, the key was not rotated")
+	}
+	if interactive && !isSecurityKeyType(data.KeyType) {
+		if err := askRotationPassphrase(&data); err != nil {
+			return fmt.Errorf("Form cancelled or failed: %w", err)
+		}
+	}
+
+	// Undo everything if a later step fails, so the context keeps working with the old key
+	var undo rollback
+	defer func() {
+		if err != nil {
+			err = undo.run(err)
+		}
+	}()
+	if _, _, err := generateSSHKey(data, keyName, 0); err != nil {
+		return fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+	undo.add("generated SSH key "+privateKeyPath, func() error {
+		return errors.Join(os.Remove(privateKeyPath), os.Remove(publicKeyPath))
+	})
+	newKey, err := readImportedKey(publicKeyPath)
+	if err != nil {
+		return err
+	}
+
+	restoreLocal, err := backupFile(localConfigPath)
+	if err != nil {
+		return err
+	}
+	changes := []configChange{{"core.sshCommand", sshCommand, rotatedSSHCommand(sshCommand, privateKeyPath, data.Passphrase != "")}}
+	if signsWithKey {
+		changes = append(changes, configChange{"user.signingkey", signingKey, styledPath(publicKeyPath)})
+	}
+	undo.add("updated "+localConfigPath, restoreLocal)
+	if err := applyContextEdit(localConfigPath, changes); err != nil {
+		return err
+	}
+	restoreSSHConfig, err := backupFile(sshConfigPath)
+	if err != nil {
+		return err
+	}
+	sshConfigPath, hostAliases, err := repointSSHConfigHosts(oldKeyPath, styledPath(privateKeyPath))
+	if err != nil {
+		return err
+	}
+	if len(hostAliases) > 0 {
+		undo.add("pointed Host "+strings.Join(hostAliases, ", ")+" in "+sshConfigPath+" at the new key", restoreSSHConfig)
+	}
+
+	done := []string{
+		styleGood.Render("Rotated the key of") + " " + stylePath.Render(localConfigPath),
+		"",
+		styleKey.Render("New SSH Public Key:") + " " + stylePath.Render(newKey.Path),
+		styleKeyText.Render(newKey.Content),
+		styleKey.Render("Fingerprint:") + " " + styleKeyText.Render(newKey.Fingerprint),
+	}
+	if len(hostAliases) > 0 {
+		done = append(done, styleWarn.Render("Pointed Host "+strings.Join(hostAliases, ", ")+" at the new key in the ssh config:")+" "+stylePath.Render(sshConfigPath))
+	}
+	if signsWithKey {
+		allowedSignersPath, err := allowedSignersPath()
+		if err != nil {
+			return err
+		}
+		restoreSigners, err := backupFile(allowedSignersPath)
+		if err != nil {
+			return err
+		}
+		allowedSignersFile, added, err := addAllowedSigner(email, newKey.Content)
+		if err != nil {
+			return err
+		}
+		if added {
+			undo.add("added signer to "+allowedSignersFile, restoreSigners)
+			done = append(done, styleWarn.Render("Added the new key to allowed signers:")+" "+stylePath.Render(allowedSignersFile))
+		}
+	}
+
+	// The key works now, so failures past this point no longer undo it
+	undo = rollback{}
+	if notArchived != "" {
+		done = append(done, styleWarn.Render("Kept the old key, as "+notArchived+":")+" "+stylePath.Render(oldKeyPath))
+	}
+	if archive {
+		archivePath := rotatedKeyPath(oldKeyPath, time.Now())
+		if err := os.Rename(oldKeyPath, archivePath); err != nil {
+			logWarn("Could not archive the old key %s: %v", stylePath.Render(oldKeyPath), err)
+		} else {
+			if err := os.Rename(oldKeyPath+".pub", archivePath+".pub"); err != nil {
+				logWarn("Could not archive the old public key %s: %v", stylePath.Render(oldKeyPath+".pub"), err)
+			}
+			done = append(done, styleWarn.Render("Archived the old key:")+" "+stylePath.Render(archivePath))
+		}
+	}
+
+	done = append(done, "", styleInfo.Render("Add the new key to your Git host, then remove the old one ("+oldKey.Fingerprint+")."))
+	if !opts.NoClipboard {
+		method, err := copyToClipboard(newKey.Content)
+		switch {
+		case err != nil:
+			done = append(done, styleWarn.Render("Could not copy public key to clipboard: "+err.Error()))
+		case method == clipboardOSC52:
+			done = append(done, styleGood.Render("Public key sent to your terminal's clipboard (OSC52)"))
+		default:
+			done = append(done, styleGood.Render("Public key copied to clipboard"))
+		}
+	}
+	printBorderedMessages(done)
+	return nil
+}
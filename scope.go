@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// Where the identity is written, accepted by --scope
+const (
+	scopeUser       = "user"        // A .gitconfig in the directory, included from the global config (the default)
+	scopeRepo       = "repo"        // The repository's own .git/config
+	scopeGlobalOnly = "global-only" // The global config itself, with no per-directory file
+)
+
+// scopes lists the values accepted by --scope
+var scopes = []string{scopeUser, scopeRepo, scopeGlobalOnly}
+
+// scopeConflicts are the flags that only apply to the includeIf of the user
+// scope, and for global-only to the directory as well
+var scopeConflicts = map[string][]string{
+	scopeRepo: {
+		flagRepoLocal, flagLocalConfig, flagRelInclude, flagMatch, flagRemoteURL, flagBranch, flagGitdirPat,
+		flagOnConflict, flagOnInclude, flagIncludeStyle,
+	},
+	scopeGlobalOnly: {
+		flagRepoLocal, flagLocalConfig, flagRelInclude, flagMatch, flagRemoteURL, flagBranch, flagGitdirPat,
+		flagOnConflict, flagOnInclude, flagIncludeStyle,
+		flagDir, flagAttach, flagGitInit, flagInitialBranch, flagRemote, flagGitignore,
+	},
+}
+
+// validateScope checks the value of --scope
+func validateScope(s string) error {
+	if !slices.Contains(scopes, s) {
+		return fmt.Errorf("unsupported scope '%s' (supported: %s)", s, strings.Join(scopes, ", "))
+	}
+	return nil
+}
+
+// effectiveScope returns the scope of data, user when none was given
+func effectiveScope(data FormData) string {
+	if data.Scope == "" {
+		return scopeUser
+	}
+	return data.Scope
+}
+
+// checkScopeFields rejects settings of data that its scope does not use,
+// for batch entries, which have no flags to check
+func checkScopeFields(data FormData) error {
+	scope := effectiveScope(data)
+	if scope == scopeUser {
+		return nil
+	}
+	if data.RepoLocal || data.LocalConfig != "" || data.RelativeInclude || data.IncludeMatch != "" || data.RemoteURL != "" || data.Branch != "" || data.GitdirPattern != "" {
+		return fmt.Errorf("scope %s writes no includeIf, so repo_local, local_config, relative_include, match, remote_url, branch and gitdir_pattern do not apply", scope)
+	}
+	if scope == scopeGlobalOnly && (data.DirectoryName != "" || data.GitInit || data.Remote != "" || data.AppendToGitignore) {
+		return fmt.Errorf("scope %s has no directory, so directory, git_init, remote and append_to_gitignore do not apply", scope)
+	}
+	return nil
+}
+
+// checkScopeDir makes sure the repo scope has a repository to write into:
+// absPath must be one, or --git-init must make it one
+func checkScopeDir(absPath string, data FormData) error {
+	if effectiveScope(data) == scopeRepo && !data.GitInit && !isGitRepo(absPath) {
+		return fmt.Errorf("'%s' is not a git repository, which --%s %s writes into; run git init there first or pass --%s",
+			stylePath.Render(absPath), flagScope, scopeRepo, flagGitInit)
+	}
+	return nil
+}
+
+// contextDir returns the directory of the context in data. The global-only
+// scope has none of its own, so paths relative to it start from the home directory.
+func contextDir(data FormData) (string, error) {
+	if effectiveScope(data) == scopeGlobalOnly {
+		return userHomeDir()
+	}
+	return resolveTargetDir(data.DirectoryName)
+}
+
+// contextKeyName returns a new key name for the context in data, after its
+// directory or, for global-only, its provider as --key-only does
+func contextKeyName(data FormData) string {
+	if effectiveScope(data) == scopeGlobalOnly {
+		return defaultKeyName(data.Provider)
+	}
+	return defaultKeyName(data.DirectoryName)
+}
+
+// scopeConfigPath returns the config file the repo and global-only scopes
+// write the identity into
+func scopeConfigPath(absPath string, data FormData) (string, error) {
+	if effectiveScope(data) == scopeRepo {
+		return repoConfigPath(absPath)
+	}
+	return resolveGlobalGitConfigPath()
+}
+
+// scopeConfigLabel names the file scopeConfigPath returns, for the output
+func scopeConfigLabel(data FormData) string {
+	if effectiveScope(data) == scopeRepo {
+		return "repository config"
+	}
+	return "global .gitconfig"
+}
+
+// configEntries lists the keys of cfg as git config names and values, e.g.
+// gpg.ssh.allowedSignersFile for allowedSignersFile in [gpg "ssh"]
+func configEntries(cfg *ini.File) []configChange {
+	entries := []configChange{}
+	for _, section := range cfg.Sections() {
+		if section.Name() == ini.DefaultSection {
+			continue
+		}
+		name, subsection, found := strings.Cut(section.Name(), " ")
+		prefix := name
+		if found {
+			prefix += "." + strings.Trim(subsection, `"`)
+		}
+		for _, key := range section.Keys() {
+			entries = append(entries, configChange{Key: prefix + "." + key.Name(), New: key.Value()})
+		}
+	}
+	return entries
+}
+
+// writeScopedConfig sets the context's keys in path, a config that holds more
+// than this tool's settings, with git config so the rest of the file keeps
+// its layout and multi-valued keys
+func writeScopedConfig(path string, data FormData, paths configPaths) error {
+	cfg, err := applyTemplateConfig(buildLocalGitConfig(data, paths), data)
+	if err != nil {
+		return err
+	}
+	logConfigKeys(cfg)
+	if effectiveScope(data) != scopeGlobalOnly {
+		return applyContextEdit(path, configEntries(cfg))
+	}
+	// Other runs edit the global config too, so hold its lock like updateGlobalGitConfig
+	unlock, err := lockConfigFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return applyLockedContextEdit(path, configEntries(cfg))
+}
+
+// applyLockedContextEdit is applyContextEdit for a config whose lock this run
+// holds. The lock is the file git config takes too, so git edits a copy,
+// which then replaces the config.
+func applyLockedContextEdit(path string, changes []configChange) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read '%s': %w", stylePath.Render(path), err)
+	}
+	copyFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".edit-*")
+	if err != nil {
+		return err
+	}
+	copyPath := copyFile.Name()
+	defer os.Remove(copyPath)
+	_, err = copyFile.Write(content)
+	if closeErr := copyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := applyContextEdit(copyPath, changes); err != nil {
+		return err
+	}
+	if content, err = os.ReadFile(copyPath); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content)
+}
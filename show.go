@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// showOptions holds the flags of the show subcommand
+type showOptions struct {
+	NoClipboard bool
+}
+
+// newShowFlagSet defines the flags of the show subcommand, storing their values in opts
+func newShowFlagSet(opts *showOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" show", flag.ContinueOnError)
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	addNoBorderFlag(fs)
+	addHomeFlag(fs)
+	fs.BoolVar(&opts.NoClipboard, "no-clipboard", false, "do not copy the public key to the clipboard")
+	return fs
+}
+
+// signingKeyFile returns the public key file a user.signingkey value read from
+// localConfigPath names, or "" when it is empty or not a file (e.g. a key id)
+func signingKeyFile(localConfigPath, signingKey string) string {
+	if signingKey == "" || strings.HasPrefix(signingKey, "key::") {
+		return ""
+	}
+	path := resolveIncludePath(localConfigPath, convertFromLinuxPath(signingKey))
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// runShow implements the show subcommand, printing (and copying) the public key
+// of a directory's context again without changing anything
+func runShow(args []string) error {
+	var opts showOptions
+	fs := newShowFlagSet(&opts)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError(fmt.Errorf("usage: %s show [--no-clipboard] <directory>", appName))
+	}
+
+	absPath, err := resolveTargetDir(positional[0])
+	if err != nil {
+		return err
+	}
+	globalGitConfigPath, err := resolveGlobalGitConfigPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadGitConfig(globalGitConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+	}
+
+	localConfigPath := contextConfigPath(cfg, globalGitConfigPath, absPath)
+	if _, err := os.Stat(localConfigPath); err != nil {
+		return fmt.Errorf("no context found for '%s' ('%s' does not exist)", stylePath.Render(absPath), stylePath.Render(localConfigPath))
+	}
+	local, err := loadGitConfig(localConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load '%s': %w", stylePath.Render(localConfigPath), err)
+	}
+	keyPath := sshCommandKeyPath(local.Section("core").Key("sshCommand").String())
+	if keyPath == "" {
+		return fmt.Errorf("'%s' sets no key with core.sshCommand -i", stylePath.Render(localConfigPath))
+	}
+	key, err := readImportedKey(keyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	messages := []string{
+		styleInfo.Render("Context:") + " " + stylePath.Render(absPath),
+		styleInfo.Render("Local config:") + " " + stylePath.Render(localConfigPath),
+		"",
+		styleKey.Render("SSH Public Key:") + " " + stylePath.Render(key.Path),
+		styleKeyText.Render(key.Content),
+		styleKey.Render("Fingerprint:") + " " + styleKeyText.Render(key.Fingerprint),
+	}
+
+	// A separate signing key is shown too; signing with the authentication key needs nothing more
+	if signingPath := signingKeyFile(localConfigPath, local.Section("user").Key("signingkey").String()); signingPath != "" && !samePath(signingPath, key.Path) {
+		signing, err := readImportedKey(signingPath)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, "")
+		messages = append(messages, styleKey.Render("SSH Signing Key:")+" "+stylePath.Render(signing.Path))
+		messages = append(messages, styleKeyText.Render(signing.Content))
+		messages = append(messages, styleKey.Render("Fingerprint:")+" "+styleKeyText.Render(signing.Fingerprint))
+	}
+
+	if !opts.NoClipboard {
+		messages = append(messages, "")
+		method, err := copyToClipboard(key.Content)
+		switch {
+		case err != nil:
+			messages = append(messages, styleWarn.Render("Could not copy public key to clipboard: "+err.Error()))
+		case method == clipboardOSC52:
+			messages = append(messages, styleGood.Render("Public key sent to your terminal's clipboard (OSC52)"))
+		default:
+			messages = append(messages, styleGood.Render("Public key copied to clipboard"))
+		}
+	}
+
+	printBorderedMessages(messages)
+	return nil
+}
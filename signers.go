@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// allowedSignersPath returns the location of the allowed signers file used to verify SSH signatures
+func allowedSignersPath() (string, error) {
+	sshDir, err := defaultSSHDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(sshDir, "allowed_signers"), nil
+}
+
+// allowedSignerLine renders an allowed signers entry for email and a public key
+// in authorized_keys format ("<type> <base64> [comment]")
+func allowedSignerLine(email, publicKey string) string {
+	return email + " " + strings.TrimSpace(publicKey)
+}
+
+// hasAllowedSigner reports whether content already contains email with the same key
+func hasAllowedSigner(content, email, publicKey string) bool {
+	keyFields := strings.Fields(publicKey)
+	if len(keyFields) < 2 {
+		return false
+	}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		principals := strings.Split(fields[0], ",")
+		if !slices.Contains(principals, email) {
+			continue
+		}
+		// Options may sit between the principals and the key, so look for the key pair anywhere
+		for i := 1; i < len(fields)-1; i++ {
+			if fields[i] == keyFields[0] && fields[i+1] == keyFields[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addAllowedSigner appends email and publicKey to the allowed signers file
+// unless the pair is already present. It returns the file path and whether it was changed.
+func addAllowedSigner(email, publicKey string) (string, bool, error) {
+	path, err := allowedSignersPath()
+	if err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), sshDirMode); err != nil {
+		return "", false, fmt.Errorf("failed to create directory for '%s': %w", stylePath.Render(path), err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", false, fmt.Errorf("failed to read allowed signers file '%s': %w", stylePath.Render(path), err)
+	}
+	if hasAllowedSigner(string(content), email, publicKey) {
+		logDetail("%s is already a signer with this key", email)
+		return path, false, nil
+	}
+
+	line := allowedSignerLine(email, publicKey) + "\n"
+	logDetail("%s", strings.TrimSpace(line))
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		line = "\n" + line
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open allowed signers file '%s': %w", stylePath.Render(path), err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(line); err != nil {
+		return "", false, fmt.Errorf("failed to write allowed signers file '%s': %w", stylePath.Render(path), err)
+	}
+	return path, true, nil
+}
+
+// removeAllowedSigner deletes every entry for publicKey, whatever its
+// principals, from the allowed signers file at path, and reports whether
+// there were any
+func removeAllowedSigner(path, publicKey string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read allowed signers file '%s': %w", stylePath.Render(path), err)
+	}
+	updated, removed := dropAllowedSigner(string(content), publicKey)
+	if !removed {
+		return false, nil
+	}
+	if err := writeFileAtomic(path, []byte(updated)); err != nil {
+		return false, fmt.Errorf("failed to write allowed signers file '%s': %w", stylePath.Render(path), err)
+	}
+	return true, nil
+}
+
+// dropAllowedSigner returns the allowed signers content without the entries
+// for publicKey, and whether there were any
+func dropAllowedSigner(content, publicKey string) (string, bool) {
+	keyFields := strings.Fields(publicKey)
+	if len(keyFields) < 2 {
+		return content, false
+	}
+	kept := []string{}
+	removed := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && !strings.HasPrefix(fields[0], "#") && slices.Contains(fields[1:], keyFields[1]) {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, ""), removed
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/x/ansi"
+	"golang.org/x/term"
+)
+
+// spinnerFrames animates the spinner shown while a key is generated
+var spinnerFrames = spinner.MiniDot
+
+// startSpinner shows title after an animated spinner on stderr until the
+// returned function is called, which clears the line again. Nothing is shown
+// with --quiet or when stderr is not a terminal, so logs stay clean.
+func startSpinner(title string) (stop func()) {
+	if verbosity == levelQuiet || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(spinnerFrames.FPS)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			fmt.Fprintf(os.Stderr, "\r%s %s", styleInfo.Render(spinnerFrames.Frames[frame%len(spinnerFrames.Frames)]), title)
+			select {
+			case <-done:
+				fmt.Fprint(os.Stderr, "\r"+ansi.EraseEntireLine)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
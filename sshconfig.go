@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// defaultSSHHostName is the host of the default provider, GitHub
+const defaultSSHHostName = "github.com"
+
+// sshConfigHostBlock renders a ~/.ssh/config Host block that pins identityFile to alias
+func sshConfigHostBlock(alias, hostName, identityFile string) string {
+	return fmt.Sprintf("Host %s\n    HostName %s\n    User git\n    IdentityFile %s\n    IdentitiesOnly yes\n", alias, hostName, sshConfigQuote(identityFile))
+}
+
+// sshConfigQuote quotes an argument of an ssh config line (or of ssh -o),
+// which ssh splits at spaces unless quoted
+func sshConfigQuote(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// sshHostAliasPattern matches the characters left out of a generated host alias
+var sshHostAliasPattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sshConfigSnippet renders the Host block --print-ssh-config prints for the
+// key at privateKeyPath. The alias is --ssh-host-alias, or else made from the
+// provider's host and the directory (or, with --key-only, the key) name.
+func sshConfigSnippet(data FormData, privateKeyPath string) string {
+	alias := data.SSHHostAlias
+	if alias == "" {
+		name := filepath.Base(data.DirectoryName)
+		if data.DirectoryName == "" {
+			name = filepath.Base(privateKeyPath)
+		}
+		alias = sshHostName(data) + "-" + strings.Trim(sshHostAliasPattern.ReplaceAllString(name, "-"), "-")
+	}
+	return fmt.Sprintf("# Paste into ~/.ssh/config, then use git@%s:owner/repo.git in remote URLs\n", alias) +
+		sshConfigHostBlock(alias, sshHostName(data), styledPath(privateKeyPath))
+}
+
+// sshConfigHasHost reports whether the ssh config content already declares a Host matching alias
+func sshConfigHasHost(content, alias string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "Host") {
+			continue
+		}
+		for _, pattern := range fields[1:] {
+			if pattern == alias {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateSSHConfig appends a Host block for alias to ~/.ssh/config unless one
+// already exists. It returns the config path and whether a block was added.
+func updateSSHConfig(alias, hostName, identityFile string) (string, bool, error) {
+	sshDir, err := defaultSSHDir()
+	if err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(sshDir, sshDirMode); err != nil {
+		return "", false, fmt.Errorf("failed to create .ssh directory '%s': %w", stylePath.Render(sshDir), err)
+	}
+	sshConfigPath := filepath.Join(sshDir, "config")
+
+	content, err := os.ReadFile(sshConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", false, fmt.Errorf("failed to read ssh config '%s': %w", stylePath.Render(sshConfigPath), err)
+	}
+	if sshConfigHasHost(string(content), alias) {
+		logDetail("Host %s already exists in %s", alias, stylePath.Render(sshConfigPath))
+		return sshConfigPath, false, nil
+	}
+
+	// Separate the new block from existing content with a blank line
+	block := sshConfigHostBlock(alias, hostName, identityFile)
+	for _, line := range strings.Split(strings.TrimSpace(block), "\n") {
+		logDetail("%s", line)
+	}
+	if len(content) > 0 {
+		if !strings.HasSuffix(string(content), "\n") {
+			block = "\n" + block
+		}
+		block = "\n" + block
+	}
+
+	file, err := os.OpenFile(sshConfigPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open ssh config '%s': %w", stylePath.Render(sshConfigPath), err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(block); err != nil {
+		return "", false, fmt.Errorf("failed to write ssh config '%s': %w", stylePath.Render(sshConfigPath), err)
+	}
+	return sshConfigPath, true, nil
+}
+
+// sshConfigHost is a Host block of an ssh config
+type sshConfigHost struct {
+	Patterns      []string
+	HostName      string
+	IdentityFiles []string
+}
+
+// matches reports whether the block applies to host, following the * and ?
+// wildcards and ! negations of ssh_config patterns
+func (h sshConfigHost) matches(host string) bool {
+	matched := false
+	for _, pattern := range h.Patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		ok, _ := path.Match(strings.ToLower(strings.TrimPrefix(pattern, "!")), strings.ToLower(host))
+		if ok && negated {
+			return false
+		}
+		matched = matched || ok
+	}
+	return matched
+}
+
+// parseSSHConfigHosts returns the Host blocks of the ssh config content.
+// Match blocks and Include directives are not followed.
+func parseSSHConfigHosts(content string) []sshConfigHost {
+	hosts := []sshConfigHost{}
+	var current *sshConfigHost
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Keywords are separated from their arguments by spaces or an =
+		keyword, args, _ := strings.Cut(strings.Replace(line, "=", " ", 1), " ")
+		args = strings.Trim(strings.TrimSpace(args), `"`)
+		switch strings.ToLower(keyword) {
+		case "host":
+			hosts = append(hosts, sshConfigHost{Patterns: strings.Fields(args)})
+			current = &hosts[len(hosts)-1]
+		case "match":
+			current = nil
+		case "hostname":
+			if current != nil {
+				current.HostName = args
+			}
+		case "identityfile":
+			if current != nil {
+				current.IdentityFiles = append(current.IdentityFiles, args)
+			}
+		}
+	}
+	return hosts
+}
+
+// sshConfigConflictWarning looks for Host blocks in ~/.ssh/config that give
+// the provider's host a key of their own, either directly or through an alias
+// whose HostName is that host. Inside the directory git runs the context's
+// core.sshCommand, whose -i key ssh offers first, so such a key is only a
+// fallback there, which surprises users who expect the alias to win.
+func sshConfigConflictWarning(data FormData) string {
+	sshDir, err := defaultSSHDir()
+	if err != nil {
+		return ""
+	}
+	content, err := os.ReadFile(filepath.Join(sshDir, "config"))
+	if err != nil {
+		return ""
+	}
+	host := sshHostName(data)
+	conflicts := []string{}
+	for _, block := range parseSSHConfigHosts(string(content)) {
+		if len(block.IdentityFiles) == 0 || slices.Contains(block.Patterns, data.SSHHostAlias) {
+			continue
+		}
+		if block.matches(host) || strings.EqualFold(block.HostName, host) {
+			conflicts = append(conflicts, fmt.Sprintf("Host %s (IdentityFile %s)", strings.Join(block.Patterns, " "), strings.Join(block.IdentityFiles, ", ")))
+		}
+	}
+	if len(conflicts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("~/.ssh/config gives %s a key of its own in %s. Inside this directory git runs core.sshCommand, "+
+		"so ssh offers the new key first and that key (with the account it belongs to) only applies if the new key is refused. "+
+		"Keep one of the two: remove the IdentityFile from the Host block, or drop core.sshCommand from this context and use the alias in remote URLs",
+		host, strings.Join(conflicts, "; "))
+}
+
+// removeSSHConfigHosts removes the Host blocks of ~/.ssh/config whose
+// IdentityFile is keyPath, as updateSSHConfig writes them. It returns the
+// config path and the aliases of the removed blocks.
+func removeSSHConfigHosts(keyPath string) (string, []string, error) {
+	return editSSHConfigHosts(func(content, sshConfigPath string) (string, []string) {
+		return dropSSHConfigHosts(content, sshConfigPath, keyPath)
+	})
+}
+
+// repointSSHConfigHosts points the Host blocks of ~/.ssh/config whose
+// IdentityFile is oldKeyPath at identityFile instead, for rotate. It returns
+// the config path and the aliases of the changed blocks.
+func repointSSHConfigHosts(oldKeyPath, identityFile string) (string, []string, error) {
+	return editSSHConfigHosts(func(content, sshConfigPath string) (string, []string) {
+		return repointSSHConfigContent(content, sshConfigPath, oldKeyPath, identityFile)
+	})
+}
+
+// editSSHConfigHosts rewrites ~/.ssh/config with edit, which returns the new
+// content and the aliases it changed; nothing is written when there are none
+func editSSHConfigHosts(edit func(content, sshConfigPath string) (string, []string)) (string, []string, error) {
+	sshDir, err := defaultSSHDir()
+	if err != nil {
+		return "", nil, err
+	}
+	sshConfigPath := filepath.Join(sshDir, "config")
+	content, err := os.ReadFile(sshConfigPath)
+	if os.IsNotExist(err) {
+		return sshConfigPath, nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read ssh config '%s': %w", stylePath.Render(sshConfigPath), err)
+	}
+	updated, aliases := edit(string(content), sshConfigPath)
+	if len(aliases) == 0 {
+		return sshConfigPath, nil, nil
+	}
+	if err := writeFileAtomic(sshConfigPath, []byte(updated)); err != nil {
+		return "", nil, fmt.Errorf("failed to write ssh config '%s': %w", stylePath.Render(sshConfigPath), err)
+	}
+	return sshConfigPath, aliases, nil
+}
+
+// dropSSHConfigHosts returns the ssh config content without the Host blocks
+// whose only IdentityFile is keyPath, and the aliases of the dropped blocks.
+// A block ends at the next Host or Match line.
+func dropSSHConfigHosts(content, sshConfigPath, keyPath string) (string, []string) {
+	kept := []string{}
+	aliases := []string{}
+	lines := strings.SplitAfter(content, "\n")
+	for i := 0; i < len(lines); {
+		end := sshConfigBlockEnd(lines, i)
+		alias, ok := keyHostBlock(lines[i:end], sshConfigPath, keyPath)
+		if !ok {
+			kept = append(kept, lines[i:end]...)
+			i = end
+			continue
+		}
+		aliases = append(aliases, alias)
+		// The blank lines after the block go with it; the one before it only
+		// when it was the last block, so no blank line is left at the end
+		if strings.TrimSpace(strings.Join(lines[end:], "")) == "" {
+			for n := len(kept); n > 0 && strings.TrimSpace(kept[n-1]) == ""; n-- {
+				kept = kept[:n-1]
+			}
+		}
+		i = end
+	}
+	return strings.Join(kept, ""), aliases
+}
+
+// repointSSHConfigContent returns the ssh config content with the
+// IdentityFile of the Host blocks dropSSHConfigHosts would drop for keyPath
+// set to identityFile, and the aliases of those blocks. The rest of each
+// block, and its indentation, is kept.
+func repointSSHConfigContent(content, sshConfigPath, keyPath, identityFile string) (string, []string) {
+	aliases := []string{}
+	lines := strings.SplitAfter(content, "\n")
+	for i := 0; i < len(lines); {
+		end := sshConfigBlockEnd(lines, i)
+		if alias, ok := keyHostBlock(lines[i:end], sshConfigPath, keyPath); ok {
+			aliases = append(aliases, alias)
+			for j := i; j < end; j++ {
+				if strings.EqualFold(sshConfigKeyword(lines[j]), "IdentityFile") {
+					indent := lines[j][:len(lines[j])-len(strings.TrimLeft(lines[j], " \t"))]
+					newline := lines[j][len(strings.TrimRight(lines[j], "\r\n")):]
+					lines[j] = indent + "IdentityFile " + sshConfigQuote(identityFile) + newline
+				}
+			}
+		}
+		i = end
+	}
+	return strings.Join(lines, ""), aliases
+}
+
+// sshConfigBlockEnd returns the index of the line after the block starting at
+// lines[start], which ends at the next Host or Match line
+func sshConfigBlockEnd(lines []string, start int) int {
+	end := start + 1
+	for end < len(lines) && !isSSHConfigBlockStart(lines[end]) {
+		end++
+	}
+	return end
+}
+
+// keyHostBlock reports whether block is a Host block whose only IdentityFile
+// is keyPath, as updateSSHConfig writes them, and returns its alias
+func keyHostBlock(block []string, sshConfigPath, keyPath string) (string, bool) {
+	if len(block) == 0 || !strings.EqualFold(sshConfigKeyword(block[0]), "Host") {
+		return "", false
+	}
+	hosts := parseSSHConfigHosts(strings.Join(block, ""))
+	if len(hosts) != 1 || len(hosts[0].IdentityFiles) != 1 ||
+		!samePath(resolveIncludePath(sshConfigPath, convertFromLinuxPath(hosts[0].IdentityFiles[0])), keyPath) {
+		return "", false
+	}
+	return strings.Join(hosts[0].Patterns, " "), true
+}
+
+// isSSHConfigBlockStart reports whether line opens a Host or Match block
+func isSSHConfigBlockStart(line string) bool {
+	keyword := sshConfigKeyword(line)
+	return strings.EqualFold(keyword, "Host") || strings.EqualFold(keyword, "Match")
+}
+
+// sshConfigKeyword returns the keyword of an ssh config line, which is
+// separated from its arguments by spaces or an =
+func sshConfigKeyword(line string) string {
+	keyword, _, _ := strings.Cut(strings.Replace(strings.TrimSpace(line), "=", " ", 1), " ")
+	return keyword
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Outcomes of the post-setup SSH connection test
+const (
+	testAuthenticated = "authenticated" // The provider accepted the key
+	testKeyNotAdded   = "key-not-added" // The host was reached but rejected the key
+	testUnreachable   = "unreachable"   // The host could not be reached at all
+	testFailed        = "failed"        // Anything else (ssh missing, host key mismatch, ...)
+)
+
+// sshTestTimeout bounds the whole connection test
+const sshTestTimeout = 30 * time.Second
+
+// connectionTest is the outcome of testSSHConnection
+type connectionTest struct {
+	Host   string `json:"host"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+}
+
+// Phrases in ssh's output that tell the outcomes apart. Providers word their
+// greeting differently, so the success phrases cover the common ones.
+var (
+	sshAuthenticatedPhrases = []string{"successfully authenticated", "welcome to gitlab", "authenticated via ssh key", "logged in as"}
+	sshRejectedPhrases      = []string{"permission denied"}
+	sshUnreachablePhrases   = []string{"connection refused", "could not resolve hostname", "connection timed out", "operation timed out", "network is unreachable", "no route to host"}
+)
+
+// testHost returns the host the connection test should use for data
+func testHost(data FormData) string {
+	if data.TestHost != "" {
+		return data.TestHost
+	}
+	return sshHostName(data)
+}
+
+// testSSHConnection runs "ssh -T git@host" with only privateKeyPath offered and
+// classifies the result. Providers never grant a shell, so the exit status
+// alone says little: GitHub exits 1 even when authentication succeeds.
+// hostKeyOpts are the known_hosts options of core.sshCommand, so the test
+// trusts the same host keys git will.
+func testSSHConnection(host, privateKeyPath string, hasPassphrase bool, hostKeyOpts []string) connectionTest {
+	result := connectionTest{Host: host}
+
+	args := []string{
+		"-T",
+		"-i", privateKeyPath,
+		"-o", "IdentitiesOnly=yes",
+		"-o", "ConnectTimeout=10",
+	}
+	for _, option := range hostKeyOpts {
+		args = append(args, "-o", option)
+	}
+	// ssh uses the first value it sees, so this only applies without --strict-host-key-checking
+	args = append(args, "-o", "StrictHostKeyChecking=accept-new")
+	// A passphrase-protected key needs a prompt, which is only possible on a terminal
+	interactive := hasPassphrase && term.IsTerminal(int(os.Stdin.Fd()))
+	if !interactive {
+		args = append(args, "-o", "BatchMode=yes")
+	}
+	args = append(args, "git@"+host)
+
+	ctx, cancel := context.WithTimeout(context.Background(), sshTestTimeout)
+	defer cancel()
+	cmd := execCommandContext(ctx, "ssh", args...)
+	if interactive {
+		cmd.Stdin = os.Stdin
+	}
+	output, err := cmd.CombinedOutput()
+	result.Output = strings.TrimSpace(string(output))
+
+	lower := strings.ToLower(result.Output)
+	containsAny := func(phrases []string) bool {
+		for _, phrase := range phrases {
+			if strings.Contains(lower, phrase) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err != nil && !errors.As(err, &exitErr):
+		result.Status = testFailed
+		if result.Output == "" {
+			result.Output = err.Error()
+		}
+	case containsAny(sshAuthenticatedPhrases) || err == nil:
+		result.Status = testAuthenticated
+	case containsAny(sshRejectedPhrases):
+		result.Status = testKeyNotAdded
+	case containsAny(sshUnreachablePhrases) || ctx.Err() != nil:
+		result.Status = testUnreachable
+	default:
+		result.Status = testFailed
+	}
+	return result
+}
+
+// renderConnectionTest describes a connection test result for the text output
+func renderConnectionTest(test *connectionTest) []string {
+	var messages []string
+	switch test.Status {
+	case testAuthenticated:
+		messages = append(messages, styleGood.Render("SSH connection to "+test.Host+" works: the key is accepted"))
+	case testKeyNotAdded:
+		messages = append(messages, styleWarn.Render("Reached "+test.Host+" but the key was rejected."))
+		messages = append(messages, styleWarn.Render("Add the public key to your account and run the test again."))
+	case testUnreachable:
+		messages = append(messages, styleError.Render("Could not connect to "+test.Host+"; check the host name and your network."))
+	default:
+		messages = append(messages, styleError.Render("SSH connection test to "+test.Host+" failed."))
+	}
+	if test.Output != "" {
+		messages = append(messages, styleKeyText.Render(test.Output))
+	}
+	return messages
+}
+
+// runConnectionTest performs the --test step for a finished setup. When
+// guided is set the user is asked to add the key first and may skip the test
+// or retry it, with each outcome shown as it comes (see verifyKeyAdded).
+func runConnectionTest(result *setupResult, guided bool) error {
+	data := result.data
+	run := func() connectionTest {
+		return testSSHConnection(testHost(data), result.PrivateKeyPath, data.Passphrase != "", hostKeyOptions(data, data.KnownHostsFile))
+	}
+	if !guided {
+		test := run()
+		result.ConnectionTest = &test
+		return nil
+	}
+
+	ask := func(question string) (bool, error) { return confirm(question, false) }
+	show := func(test *connectionTest) {
+		if verbosity > levelQuiet {
+			printBorderedMessages(renderConnectionTest(test))
+		}
+	}
+	test, err := verifyKeyAdded(providerName(data), ask, run, show)
+	result.ConnectionTest = test
+	return err
+}
+
+// verifyKeyAdded asks whether the key was added to provider and, if so, tests
+// the connection with run and shows the outcome. Until the key is accepted it
+// offers to try again, so the user can fix the key and check once more. It
+// returns the last test, or nil when the user skipped testing.
+func verifyKeyAdded(provider string, ask func(question string) (bool, error), run func() connectionTest, show func(*connectionTest)) (*connectionTest, error) {
+	var last *connectionTest
+	question := "Have you added this key to " + provider + "? Test the SSH connection now?"
+	for {
+		ok, err := ask(question)
+		if err != nil || !ok {
+			return last, err
+		}
+		test := run()
+		last = &test
+		show(last)
+		if test.Status == testAuthenticated {
+			return last, nil
+		}
+		question = "Test the SSH connection again?"
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// lastValuesFileMode keeps the remembered answers private, as they include the email
+const lastValuesFileMode os.FileMode = 0600
+
+// appConfigDir returns $XDG_CONFIG_HOME/git-config, or ~/.config/git-config
+func appConfigDir() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		homeDir, err := userHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, appName), nil
+}
+
+// lastValuesPath returns the file the last answers are remembered in
+func lastValuesPath() (string, error) {
+	dir, err := appConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "last.json"), nil
+}
+
+// rememberedValues returns the part of data worth reusing for the next
+// directory. Values tied to a single directory or repository are dropped, and
+// the passphrase is never written (its json tag already skips it).
+func rememberedValues(data FormData) FormData {
+	data.DirectoryName = ""
+	data.KeyName = ""
+	data.RemoteURL = ""
+	data.Branch = ""
+	data.IncludeMatch = ""
+	data.Remote = ""
+	data.Passphrase = ""
+	return data
+}
+
+// saveLastValues remembers data for the next run's form
+func saveLastValues(data FormData) error {
+	path, err := lastValuesPath()
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(rememberedValues(data), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return fmt.Errorf("failed to create '%s': %w", stylePath.Render(filepath.Dir(path)), err)
+	}
+	if err := os.WriteFile(path, append(content, '\n'), lastValuesFileMode); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", stylePath.Render(path), err)
+	}
+	return nil
+}
+
+// loadLastValues reads the remembered answers. A missing or unreadable file
+// just means there is nothing to prefill.
+func loadLastValues() (FormData, bool) {
+	var last FormData
+	path, err := lastValuesPath()
+	if err != nil {
+		return last, false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return last, false
+	}
+	if err := json.Unmarshal(content, &last); err != nil {
+		return last, false
+	}
+	return rememberedValues(last), true
+}
+
+// resetLastValues forgets the remembered answers
+func resetLastValues() error {
+	path, err := lastValuesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove '%s': %w", stylePath.Render(path), err)
+	}
+	return nil
+}
+
+// globalIdentity returns the user.name and user.email of the global git
+// config, if it sets them; an invalid email is left out
+func globalIdentity() (string, string) {
+	globalGitConfigPath, err := resolveGlobalGitConfigPath()
+	if err != nil {
+		return "", ""
+	}
+	cfg, err := loadGitConfig(globalGitConfigPath)
+	if err != nil {
+		return "", ""
+	}
+	name, email := cfg.Section("user").Key("name").String(), cfg.Section("user").Key("email").String()
+	if validateEmail(email) != nil {
+		email = ""
+	}
+	return name, email
+}
+
+// applyGlobalIdentity fills in the username and email that are still empty
+// from the global git config, so the form can be accepted with Enter
+func applyGlobalIdentity(data *FormData) {
+	if data.GitUsername != "" && data.GitEmail != "" {
+		return
+	}
+	name, email := globalIdentity()
+	if data.GitUsername == "" && name != "" {
+		logDetail("using user.name %s from the global git config", name)
+		data.GitUsername = name
+	}
+	if data.GitEmail == "" && email != "" {
+		logDetail("using user.email %s from the global git config", email)
+		data.GitEmail = email
+	}
+}
+
+// applyLastValues prefills data with the remembered answers for every value
+// that was not passed as a flag, so the form starts from them
+func applyLastValues(data *FormData, last FormData, set map[string]bool) {
+	fileExists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	if !set[flagUsername] && last.GitUsername != "" {
+		data.GitUsername = last.GitUsername
+	}
+	if !set[flagEmail] && last.GitEmail != "" {
+		data.GitEmail = last.GitEmail
+	}
+	if !set[flagKeyType] && last.KeyType != "" && validateKeyType(last.KeyType) == nil {
+		data.KeyType = last.KeyType
+	}
+	if !set[flagCurve] && last.ECDSACurve != 0 {
+		data.ECDSACurve = last.ECDSACurve
+	}
+	if !set[flagSKResident] && !set[flagSKVerify] && len(last.SKOptions) > 0 {
+		data.SKOptions = last.SKOptions
+	}
+	if !set[flagRSABits] && last.RSABits != 0 && validateRSABits(last.RSABits) == nil {
+		data.RSABits = last.RSABits
+	}
+	if !set[flagComment] && last.KeyComment != "" {
+		data.KeyComment = last.KeyComment
+	}
+	if !set[flagKDFRounds] && last.KDFRounds > 0 {
+		data.KDFRounds = last.KDFRounds
+	}
+	// An HTTPS context from last time must not override SSH-only flags
+	if !set[flagAuth] && last.Auth != "" && validateAuthMethod(last.Auth) == nil && !slices.ContainsFunc(httpsConflicts, func(name string) bool { return set[name] }) {
+		data.Auth = last.Auth
+		data.CredentialHelper = last.CredentialHelper
+	}
+	if !set[flagEditor] && last.Editor != "" {
+		data.Editor = last.Editor
+	}
+	if !set[flagSSHDir] && last.SSHDir != "" {
+		data.SSHDir = last.SSHDir
+	}
+	// Keys may have been deleted since; the form cannot preselect a missing one
+	if !set[flagExisting] && last.ExistingKey != "" && fileExists(last.ExistingKey) {
+		data.ExistingKey = last.ExistingKey
+	}
+	if !set[flagSign] {
+		data.SignCommits = last.SignCommits
+		if !set[flagSignCommits] && !set[flagSignTags] && !set[flagSignPushes] {
+			data.SignScopes = last.SignScopes
+		}
+	}
+	if !set[flagSignMethod] && last.SignMethod != "" && validateSignMethod(last.SignMethod) == nil {
+		data.SignMethod = last.SignMethod
+		if !set[flagGPGKey] {
+			data.GPGKey = last.GPGKey
+		}
+		if !set[flagGPGProgram] {
+			data.GPGProgram = last.GPGProgram
+		}
+	}
+	if !set[flagSeparate] {
+		data.SeparateSigningKey = last.SeparateSigningKey
+		if last.SigningKey != "" && fileExists(last.SigningKey) {
+			data.SigningKey = last.SigningKey
+		}
+	}
+	if !set[flagProvider] && last.Provider != "" && validateProvider(last.Provider) == nil {
+		data.Provider = last.Provider
+		if !set[flagProviderHost] {
+			data.ProviderHost = last.ProviderHost
+		}
+	}
+	if !set[flagHostAlias] && last.SSHHostAlias != "" {
+		data.SSHHostAlias = last.SSHHostAlias
+		if !set[flagHostName] && last.SSHHostName != "" {
+			data.SSHHostName = last.SSHHostName
+		}
+	}
+	if !set[flagGitInit] {
+		data.GitInit = last.GitInit
+		if !set[flagInitialBranch] {
+			data.InitialBranch = last.InitialBranch
+		}
+	}
+	if !set[flagRepoLocal] {
+		data.RepoLocal = last.RepoLocal
+	}
+	if !set[flagTest] {
+		data.TestConnection = last.TestConnection
+		if !set[flagTestHost] {
+			data.TestHost = last.TestHost
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// statusKeys are the settings status reports, in display order
+var statusKeys = []struct {
+	section, key, label string
+}{
+	{"user", "name", "user.name"},
+	{"user", "email", "user.email"},
+	{"core", "sshCommand", "core.sshCommand"},
+	{"commit", "gpgsign", "commit.gpgsign"},
+	{"tag", "gpgsign", "tag.gpgsign"},
+	{"push", "gpgsign", "push.gpgsign"},
+	{"gpg", "format", "gpg.format"},
+	{"user", "signingkey", "user.signingkey"},
+}
+
+// gitdirMatches reports whether dir lies inside the directory of an
+// includeIf "gitdir:" or "gitdir/i:" condition. Only the trailing-slash prefix
+// form this tool writes is understood, not arbitrary glob patterns.
+func gitdirMatches(condition, dir string) bool {
+	pattern, ok := strings.CutPrefix(condition, "gitdir:")
+	foldCase := false
+	if !ok {
+		if pattern, ok = strings.CutPrefix(condition, "gitdir/i:"); !ok {
+			return false
+		}
+		foldCase = true
+	}
+	if rest, ok := strings.CutPrefix(pattern, "~/"); ok {
+		if homeDir, err := userHomeDir(); err == nil {
+			pattern = convertToLinuxPath(filepath.Join(homeDir, rest)) + "/"
+		}
+	}
+	if !strings.HasSuffix(pattern, "/") {
+		return false
+	}
+	// Compare in one style, whichever one the condition was written in
+	pattern = convertToLinuxPath(convertFromLinuxPath(pattern))
+
+	dir = convertToLinuxPath(dir) + "/"
+	if foldCase {
+		return strings.HasPrefix(strings.ToLower(dir), strings.ToLower(pattern))
+	}
+	return strings.HasPrefix(dir, pattern)
+}
+
+// hasconfigPrefix starts the includeIf conditions that match on a remote URL
+const hasconfigPrefix = "hasconfig:remote.*.url:"
+
+// onbranchPrefix starts the includeIf conditions that match on the checked-out branch
+const onbranchPrefix = "onbranch:"
+
+// remoteURLMatches reports whether any of urls fits the glob of an includeIf
+// "hasconfig:remote.*.url:" condition
+func remoteURLMatches(condition string, urls []string) bool {
+	glob, ok := strings.CutPrefix(condition, hasconfigPrefix)
+	if !ok {
+		return false
+	}
+	re, err := compileGlob(glob)
+	return err == nil && slices.ContainsFunc(urls, re.MatchString)
+}
+
+// branchMatches reports whether branch fits the glob of an includeIf
+// "onbranch:" condition; like git, a trailing slash matches everything below
+func branchMatches(condition, branch string) bool {
+	glob, ok := strings.CutPrefix(condition, onbranchPrefix)
+	if !ok || branch == "" {
+		return false
+	}
+	if strings.HasSuffix(glob, "/") {
+		glob += "**"
+	}
+	re, err := compileGlob(glob)
+	return err == nil && re.MatchString(branch)
+}
+
+// compileGlob turns a git wildmatch pattern into a regexp ("**" crosses
+// slashes, "*" and "?" don't)
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			pattern.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			pattern.WriteString("[^/]*")
+		case glob[i] == '?':
+			pattern.WriteString("[^/]")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.Compile(pattern.String())
+}
+
+// currentBranch returns the branch checked out in the repository containing
+// dir, or "" outside a repository or on a detached HEAD
+func currentBranch(dir string) string {
+	output, err := execCommand("git", "-C", dir, "symbolic-ref", "--quiet", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// repoRemoteURLs returns the remote URLs of the repository containing dir, if any
+func repoRemoteURLs(dir string) []string {
+	output, err := execCommand("git", "-C", dir, "config", "--get-regexp", `^remote\..*\.url$`).Output()
+	if err != nil {
+		return nil // Not a repository, no remotes, or no git
+	}
+	urls := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if _, url, ok := strings.Cut(line, " "); ok {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// newStatusFlagSet defines the flags of the status subcommand
+func newStatusFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" status", flag.ContinueOnError)
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	addNoBorderFlag(fs)
+	addHomeFlag(fs)
+	return fs
+}
+
+// runStatus implements the status subcommand, showing which context applies
+// to the current directory and the identity it results in
+func runStatus(args []string) error {
+	fs := newStatusFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+	if fs.NArg() > 0 {
+		return usageError(fmt.Errorf("usage: %s status", appName))
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	// git compares against the real path, so try both when cwd is a symlink
+	dirs := []string{cwd}
+	if resolved, err := filepath.EvalSymlinks(cwd); err == nil && resolved != cwd {
+		dirs = append(dirs, resolved)
+	}
+
+	remoteURLs := repoRemoteURLs(cwd)
+	branch := currentBranch(cwd)
+
+	globalGitConfigPath, contexts, err := loadContexts()
+	if err != nil {
+		return err
+	}
+	globalCfg, err := loadGitConfig(globalGitConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load global .gitconfig '%s': %w", stylePath.Render(globalGitConfigPath), err)
+	}
+
+	// Later includes override earlier ones, and all of them override the global values
+	values := map[string]string{}
+	origins := map[string]string{}
+	for _, k := range statusKeys {
+		if key, err := globalCfg.Section(k.section).GetKey(k.key); err == nil {
+			values[k.label], origins[k.label] = key.String(), globalGitConfigPath
+		}
+	}
+	matched := []configContext{}
+	for _, ctx := range contexts {
+		if !slices.ContainsFunc(dirs, func(dir string) bool { return gitdirMatches(ctx.Condition, dir) }) && !remoteURLMatches(ctx.Condition, remoteURLs) && !branchMatches(ctx.Condition, branch) {
+			continue
+		}
+		matched = append(matched, ctx)
+		if ctx.Missing {
+			continue
+		}
+		local, err := loadGitConfig(ctx.ConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load '%s': %w", stylePath.Render(ctx.ConfigPath), err)
+		}
+		for _, k := range statusKeys {
+			if key, err := local.Section(k.section).GetKey(k.key); err == nil {
+				values[k.label], origins[k.label] = key.String(), ctx.ConfigPath
+			}
+		}
+	}
+
+	if len(matched) == 0 {
+		messages := []string{
+			styleWarn.Render("No context matches") + " " + stylePath.Render(cwd),
+			"",
+			styleInfo.Render("Contexts are read from") + " " + stylePath.Render(globalGitConfigPath),
+			fmt.Sprintf("Run %s list to see them, or %s --dir <directory> to set one up.", appName, appName),
+		}
+		printBorderedMessages(messages)
+		return nil
+	}
+
+	messages := []string{styleInfo.Render("Directory:") + " " + stylePath.Render(cwd), ""}
+	for _, ctx := range matched {
+		line := styleGood.Render("Matched ["+ctx.Section+"]") + " -> " + stylePath.Render(ctx.ConfigPath)
+		if ctx.Missing {
+			line += " " + styleError.Render("(missing)")
+		}
+		messages = append(messages, line)
+	}
+	messages = append(messages, "")
+	for _, k := range statusKeys {
+		value, ok := values[k.label]
+		if !ok {
+			messages = append(messages, fmt.Sprintf("%-16s %s", k.label, styleWarn.Render("(not set)")))
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("%-16s %s", k.label, styleKeyText.Render(value)))
+		messages = append(messages, fmt.Sprintf("%-16s from %s", "", stylePath.Render(origins[k.label])))
+	}
+
+	signed := []string{}
+	if values["commit.gpgsign"] == "true" {
+		signed = append(signed, signScopeCommits)
+	}
+	if values["tag.gpgsign"] == "true" {
+		signed = append(signed, signScopeTags)
+	}
+	if push := values["push.gpgsign"]; push == "true" || push == "if-asked" {
+		signed = append(signed, signScopePushes)
+	}
+	messages = append(messages, "")
+	if len(signed) > 0 {
+		format := values["gpg.format"]
+		if format == "" {
+			format = "openpgp"
+		}
+		messages = append(messages, styleGood.Render("Signed: "+strings.Join(signed, ", ")+" ("+format+")"))
+	} else {
+		messages = append(messages, styleInfo.Render("Commits are not signed"))
+	}
+
+	printBorderedMessages(messages)
+	return nil
+}
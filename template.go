@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// defaultCommitTemplateName is the file --commit-template-text is written to
+// inside the directory unless --commit-template names another one
+const defaultCommitTemplateName = ".gitmessage"
+
+// commitTemplateFile returns the commit message template of the context in
+// absPath, taken relative to the directory unless it is absolute or a ~/ path
+// like localConfigFile, or "" when the context has none
+func commitTemplateFile(absPath string, data FormData) (string, error) {
+	path := data.CommitTemplate
+	if path == "" {
+		if data.CommitTemplateText == "" {
+			return "", nil
+		}
+		path = defaultCommitTemplateName
+	}
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "~") {
+		return resolveTargetDir(path)
+	}
+	return filepath.Join(absPath, path), nil
+}
+
+// validateCommitTemplate checks the path given with --commit-template
+func validateCommitTemplate(s string) error {
+	if s == "" {
+		return fmt.Errorf("path cannot be empty")
+	}
+	if strings.HasSuffix(s, "/") || strings.HasSuffix(s, string(filepath.Separator)) {
+		return fmt.Errorf("'%s' must name a file, not a directory", s)
+	}
+	return validatePathName(s)
+}
+
+// validateEditor checks the command given with --editor
+func validateEditor(s string) error {
+	if strings.TrimSpace(s) == "" {
+		return fmt.Errorf("editor command cannot be empty")
+	}
+	if strings.ContainsAny(s, "\r\n") {
+		return fmt.Errorf("editor command must be a single line")
+	}
+	return nil
+}
+
+// autoCRLFValues lists the values accepted by --autocrlf
+var autoCRLFValues = []string{"true", "input", "false"}
+
+// fileModeValues lists the values accepted by --filemode
+var fileModeValues = []string{"true", "false"}
+
+// validateAutoCRLF checks the value given with --autocrlf
+func validateAutoCRLF(s string) error {
+	if !slices.Contains(autoCRLFValues, s) {
+		return fmt.Errorf("unsupported value '%s' (supported: %s)", s, strings.Join(autoCRLFValues, ", "))
+	}
+	return nil
+}
+
+// validateFileMode checks the value given with --filemode
+func validateFileMode(s string) error {
+	if !slices.Contains(fileModeValues, s) {
+		return fmt.Errorf("unsupported value '%s' (supported: %s)", s, strings.Join(fileModeValues, ", "))
+	}
+	return nil
+}
+
+// gitBoolValues maps the spellings git accepts for a boolean to true or false
+var gitBoolValues = map[string]string{
+	"true": "true", "yes": "true", "on": "true", "1": "true",
+	"false": "false", "no": "false", "off": "false", "0": "false",
+}
+
+// pullRebaseModes lists the values of --pull-rebase besides a boolean
+var pullRebaseModes = []string{"merges", "interactive"}
+
+// canonicalGitBool returns s as true or false if it is one of git's boolean
+// spellings, and unchanged otherwise
+func canonicalGitBool(s string) string {
+	if b, ok := gitBoolValues[strings.ToLower(s)]; ok {
+		return b
+	}
+	return s
+}
+
+// validateFetchPrune checks the value given with --fetch-prune
+func validateFetchPrune(s string) error {
+	if _, ok := gitBoolValues[strings.ToLower(s)]; !ok {
+		return fmt.Errorf("unsupported value '%s' (supported: true, false, yes, no, on, off, 1, 0)", s)
+	}
+	return nil
+}
+
+// validatePullRebase checks the value given with --pull-rebase
+func validatePullRebase(s string) error {
+	if _, ok := gitBoolValues[strings.ToLower(s)]; !ok && !slices.Contains(pullRebaseModes, s) {
+		return fmt.Errorf("unsupported value '%s' (supported: true, false, %s)", s, strings.Join(pullRebaseModes, ", "))
+	}
+	return nil
+}
+
+// checkCommitTemplate makes sure the template at path can be used: it either
+// exists as a file or can be created from text
+func checkCommitTemplate(path, text string) error {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("commit template '%s' is a directory", stylePath.Render(path))
+	case err == nil:
+		return nil
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to check commit template '%s': %w", stylePath.Render(path), err)
+	case text == "":
+		return fmt.Errorf("commit template '%s' does not exist; create it first or pass --commit-template-text to have it created", stylePath.Render(path))
+	}
+	return nil
+}
+
+// writeCommitTemplate creates the template at path from text unless the file
+// already exists, which is then used as is. It reports whether it was created.
+func writeCommitTemplate(path, text string) (bool, error) {
+	if _, err := os.Stat(path); err == nil {
+		if text != "" {
+			logDetail("%s exists, keeping it instead of the given text", stylePath.Render(path))
+		}
+		return false, nil
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	if err := os.WriteFile(path, []byte(text), configFileMode); err != nil {
+		return false, fmt.Errorf("failed to write commit template '%s': %w", stylePath.Render(path), err)
+	}
+	return true, nil
+}
+
+// loadTemplateConfig reads the shared defaults given with --template-config,
+// a ~/ path or one relative to the current directory. Unlike loadGitConfig it
+// fails on a missing file, and on content git could not parse either.
+func loadTemplateConfig(s string) (*ini.File, error) {
+	path, err := resolveTargetDir(s)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("template config not found: %w", err)
+	} else if info.IsDir() {
+		return nil, fmt.Errorf("template config '%s' is a directory", stylePath.Render(path))
+	}
+	cfg, err := ini.LoadSources(ini.LoadOptions{AllowBooleanKeys: true}, path)
+	if err != nil {
+		return nil, fmt.Errorf("template config '%s' is not a valid git config: %w", stylePath.Render(path), err)
+	}
+	return cfg, nil
+}
+
+// validateTemplateConfig checks the file given with --template-config
+func validateTemplateConfig(s string) error {
+	_, err := loadTemplateConfig(s)
+	return err
+}
+
+// applyTemplateConfig lays cfg over the template config of data, so the
+// context's own identity and keys win over the shared defaults. Without a
+// template cfg is returned as is.
+func applyTemplateConfig(cfg *ini.File, data FormData) (*ini.File, error) {
+	if data.TemplateConfig == "" {
+		return cfg, nil
+	}
+	base, err := loadTemplateConfig(data.TemplateConfig)
+	if err != nil {
+		return nil, err
+	}
+	mergeGitConfig(base, cfg)
+	return base, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Themes accepted by --theme
+const (
+	themeCharm   = "charm"   // The original hex colors, with huh's Charm form theme
+	themeDracula = "dracula" // The Dracula palette
+	themeBase16  = "base16"  // The terminal's own 16 colors, which follow its color scheme
+	themeMono    = "mono"    // No colors, only bold and italic
+)
+
+// themeNames lists the values accepted by --theme
+var themeNames = []string{themeCharm, themeDracula, themeBase16, themeMono}
+
+// theme is the set of styles for the output and the forms
+type theme struct {
+	Good    lipgloss.Style
+	Warn    lipgloss.Style
+	Info    lipgloss.Style
+	Key     lipgloss.Style
+	Error   lipgloss.Style
+	Path    lipgloss.Style
+	KeyText lipgloss.Style
+	Border  lipgloss.Style
+	Form    func() *huh.Theme
+}
+
+// colorTheme builds a theme whose output styles use the given colors
+func colorTheme(good, warn, info, key, errorColor, keyText, border lipgloss.TerminalColor, form func() *huh.Theme) theme {
+	return theme{
+		Good:    lipgloss.NewStyle().Foreground(good),
+		Warn:    lipgloss.NewStyle().Foreground(warn),
+		Info:    lipgloss.NewStyle().Foreground(info),
+		Key:     lipgloss.NewStyle().Foreground(key),
+		Error:   lipgloss.NewStyle().Foreground(errorColor),
+		Path:    lipgloss.NewStyle().Italic(true),
+		KeyText: lipgloss.NewStyle().Foreground(keyText),
+		Border:  lipgloss.NewStyle().Foreground(border),
+		Form:    form,
+	}
+}
+
+// newTheme returns the theme called name
+func newTheme(name string) theme {
+	switch name {
+	case themeDracula:
+		return colorTheme(lipgloss.Color("#50FA7B"), lipgloss.Color("#FFB86C"), lipgloss.Color("#BD93F9"), lipgloss.Color("#8BE9FD"),
+			lipgloss.Color("#FF5555"), lipgloss.Color("#F8F8F2"), lipgloss.Color("#BD93F9"), huh.ThemeDracula)
+	case themeBase16:
+		// ANSI color numbers, which the terminal maps to its own palette
+		return colorTheme(lipgloss.Color("2"), lipgloss.Color("3"), lipgloss.Color("4"), lipgloss.Color("6"),
+			lipgloss.Color("1"), lipgloss.NoColor{}, lipgloss.Color("2"), huh.ThemeBase16)
+	case themeMono:
+		bold := lipgloss.NewStyle().Bold(true)
+		plain := lipgloss.NewStyle()
+		return theme{
+			Good: plain, Warn: bold, Info: plain, Key: bold, Error: bold,
+			Path: lipgloss.NewStyle().Italic(true), KeyText: plain, Border: plain,
+			Form: huh.ThemeBase,
+		}
+	default:
+		return colorTheme(lipgloss.Color("#04B575"), lipgloss.Color("#FFA500"), lipgloss.Color("#00BFFF"), lipgloss.Color("#00FFFF"),
+			lipgloss.Color("#FF0000"), lipgloss.Color("#E5E5E5"), lipgloss.Color("#04B575"), huh.ThemeCharm)
+	}
+}
+
+// themeName is the theme of the current run, set by --theme
+var themeName = themeCharm
+
+// validateTheme checks the value of --theme
+func validateTheme(s string) error {
+	if !slices.Contains(themeNames, s) {
+		return fmt.Errorf("unsupported theme '%s' (supported: %s)", s, strings.Join(themeNames, ", "))
+	}
+	return nil
+}
+
+// formTheme returns the huh theme of the current run for the forms
+func formTheme() *huh.Theme {
+	return newTheme(themeName).Form()
+}
+
+// runField runs a single form field, as huh.Run does, in the theme of the current run
+func runField(field huh.Field) error {
+	return huh.NewForm(huh.NewGroup(field)).WithShowHelp(false).WithTheme(formTheme()).Run()
+}
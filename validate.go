@@ -0,0 +1,597 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// windowsReservedNames are device names Windows refuses as a file or
+// directory name, with or without an extension
+var windowsReservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// validatePathName checks that the host OS can create the path s. Unix only
+// forbids NUL; Windows also reserves :*?"<>|, control characters, device
+// names such as CON and names ending in a dot or space.
+func validatePathName(s string) error {
+	if strings.ContainsRune(s, 0) {
+		return fmt.Errorf("'%s' contains a NUL character", s)
+	}
+	if hostOS != "windows" {
+		return nil
+	}
+	// A colon is only valid as a drive letter (e.g. C:\work)
+	rest := s
+	if len(rest) >= 2 && rest[1] == ':' && ((rest[0] >= 'a' && rest[0] <= 'z') || (rest[0] >= 'A' && rest[0] <= 'Z')) {
+		rest = rest[2:]
+	}
+	if strings.ContainsAny(rest, `:*?"<>|`) || strings.IndexFunc(rest, func(r rune) bool { return r < 0x20 }) >= 0 {
+		return fmt.Errorf("'%s' contains characters Windows does not allow in names (:*?\"<>| or control characters)", s)
+	}
+	for _, name := range strings.FieldsFunc(rest, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if name == "." || name == ".." || name == "~" {
+			continue
+		}
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			return fmt.Errorf("'%s' ends in a dot or space, which Windows drops from names", name)
+		}
+		base, _, _ := strings.Cut(name, ".")
+		if slices.Contains(windowsReservedNames, strings.ToUpper(strings.TrimRight(base, " "))) {
+			return fmt.Errorf("'%s' is a reserved name on Windows", name)
+		}
+	}
+	return nil
+}
+
+// validateDirectoryName checks the directory name entered in the form or passed via --dir.
+// Separators are allowed so absolute, nested and ~ paths work.
+func validateDirectoryName(s string) error {
+	if s == "" {
+		return fmt.Errorf("directory name cannot be empty")
+	}
+	// git and ssh would read a leading dash as an option
+	if strings.HasPrefix(s, "-") {
+		return fmt.Errorf("directory name cannot start with '-'")
+	}
+	return validatePathName(s)
+}
+
+// validateKeygenTimeout checks the value of --keygen-timeout
+func validateKeygenTimeout(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("timeout must be positive, e.g. 30s or 10m")
+	}
+	return nil
+}
+
+// validateUsername checks the Git username
+func validateUsername(s string) error {
+	if s == "" {
+		return fmt.Errorf("git username cannot be empty")
+	}
+	return nil
+}
+
+// validateEmail checks the Git email: a bare address (no display name) whose
+// domain has at least two non-empty labels. Plus-addressing and subdomains are fine.
+func validateEmail(s string) error {
+	invalid := fmt.Errorf("please enter a valid email address, like jane@example.com")
+	if s == "" {
+		return fmt.Errorf("email cannot be empty")
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return invalid
+	}
+	at := strings.LastIndex(s, "@")
+	local, domain := s[:at], s[at+1:]
+	if local == "" || strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") {
+		return invalid
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("the email domain needs a dot, like example.com")
+	}
+	for _, label := range labels {
+		if label == "" || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return invalid
+		}
+	}
+	return nil
+}
+
+// parseEmails splits the value of --emails into the primary email, the first,
+// and the others
+func parseEmails(s string) (string, []string, error) {
+	emails := []string{}
+	for _, email := range strings.Split(s, ",") {
+		email = strings.TrimSpace(email)
+		if err := validateEmail(email); err != nil {
+			return "", nil, fmt.Errorf("'%s': %w", email, err)
+		}
+		if !slices.ContainsFunc(emails, func(e string) bool { return strings.EqualFold(e, email) }) {
+			emails = append(emails, email)
+		}
+	}
+	return emails[0], emails[1:], nil
+}
+
+// identityEmails returns every email of the identity, the primary first
+func identityEmails(data FormData) []string {
+	return append([]string{data.GitEmail}, data.AlternateEmails...)
+}
+
+// validateKeyType checks that the key type is one the tool knows how to generate
+func validateKeyType(s string) error {
+	if !slices.Contains(keyTypes, s) {
+		return fmt.Errorf("unsupported key type '%s' (supported: %s)", s, strings.Join(keyTypes, ", "))
+	}
+	return nil
+}
+
+// validateECDSACurve checks that the curve size is one ssh-keygen accepts for ecdsa keys
+func validateECDSACurve(bits int) error {
+	if !slices.Contains(ecdsaCurves, bits) {
+		return fmt.Errorf("unsupported ecdsa curve size %d (supported: 256, 384, 521)", bits)
+	}
+	return nil
+}
+
+// validateRSABits checks an RSA key size: a multiple of 8 that ssh-keygen accepts
+func validateRSABits(bits int) error {
+	if bits < minRSABits || bits > maxRSABits || bits%8 != 0 {
+		return fmt.Errorf("unsupported rsa key size %d (use a multiple of 8 from %d to %d, e.g. 2048, 3072, 4096 or 8192)", bits, minRSABits, maxRSABits)
+	}
+	return nil
+}
+
+// validateKDFRounds checks the number of key derivation rounds for ssh-keygen -a
+func validateKDFRounds(rounds int) error {
+	if rounds <= 0 {
+		return fmt.Errorf("KDF rounds must be a positive number, e.g. 100")
+	}
+	return nil
+}
+
+// validateKeyName checks a user-chosen key file name. Unlike the generated
+// default it may collide with an existing key, which is reported up front.
+func validateKeyName(s, keyDir string) error {
+	if s == "" {
+		return fmt.Errorf("key name cannot be empty")
+	}
+	if strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".pub") || strings.ContainsAny(s, `/\:*?"<>| `) {
+		return fmt.Errorf("key name must be a plain file name without spaces, e.g. github-work")
+	}
+	_, privateKeyPath, publicKeyPath, err := sshKeyPaths(keyDir, s)
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{privateKeyPath, publicKeyPath} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("a key named '%s' already exists (%s); choose another name or reuse it with --%s", s, path, flagExisting)
+		}
+	}
+	return nil
+}
+
+// validateLocalConfig checks the file given with --local-config; one outside
+// the directory must be creatable where it is
+func validateLocalConfig(s string) error {
+	if s == "" {
+		return fmt.Errorf("path cannot be empty")
+	}
+	if strings.HasSuffix(s, "/") || strings.HasSuffix(s, string(filepath.Separator)) || filepath.Base(s) == "." || filepath.Base(s) == ".." {
+		return fmt.Errorf("'%s' must name a file, not a directory", s)
+	}
+	if err := validatePathName(s); err != nil {
+		return err
+	}
+	// Relative paths depend on the directory, which may not exist yet
+	if !filepath.IsAbs(s) && !strings.HasPrefix(s, "~") {
+		return nil
+	}
+	path, err := resolveTargetDir(s)
+	if err != nil {
+		return err
+	}
+	if isDir(path) {
+		return fmt.Errorf("'%s' is a directory", path)
+	}
+	return checkWritableDir(nearestExistingDir(filepath.Dir(path)))
+}
+
+// validateSSHDir checks the directory given for new keys; a missing one is
+// fine as it is created, an existing one must be a writable directory
+func validateSSHDir(s string) error {
+	if s == "" {
+		return fmt.Errorf("directory cannot be empty")
+	}
+	dir, err := resolveTargetDir(s)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", dir)
+	}
+	return checkWritableDir(dir)
+}
+
+// validateKeyComment checks the comment stored with a new key
+func validateKeyComment(s string) error {
+	if strings.ContainsAny(s, "\r\n") {
+		return fmt.Errorf("key comment must be a single line")
+	}
+	return nil
+}
+
+// validateSignScopes checks the signing scopes chosen in a batch file
+func validateSignScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(signScopes, scope) {
+			return fmt.Errorf("unsupported signing scope '%s' (supported: %s)", scope, strings.Join(signScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// validateRemoteURL checks a remote URL glob for an includeIf "hasconfig:remote.*.url:" condition
+func validateRemoteURL(s string) error {
+	if s == "" {
+		return fmt.Errorf("remote URL pattern cannot be empty")
+	}
+	if strings.ContainsAny(s, "\"\r\n ") {
+		return fmt.Errorf("remote URL pattern cannot contain quotes or whitespace")
+	}
+	return nil
+}
+
+// validateBranchPattern checks a branch glob for an includeIf "onbranch:" condition
+func validateBranchPattern(s string) error {
+	if s == "" {
+		return fmt.Errorf("branch pattern cannot be empty")
+	}
+	if strings.ContainsAny(s, "\"\r\n\t ") {
+		return fmt.Errorf("branch pattern cannot contain quotes or whitespace")
+	}
+	if strings.HasPrefix(s, "/") || strings.HasPrefix(s, "refs/") || strings.Contains(s, "..") {
+		return fmt.Errorf("'%s' is not a branch pattern; give the short name, e.g. release/*", s)
+	}
+	return nil
+}
+
+// validateBranchMatch checks the branch glob of data, which replaces the
+// directory and remote matching: git applies an include when any of its
+// conditions matches, so they cannot narrow each other down
+func validateBranchMatch(data FormData) error {
+	if err := validateBranchPattern(data.Branch); err != nil {
+		return err
+	}
+	if data.RemoteURL != "" || data.IncludeMatch != "" {
+		return fmt.Errorf("--%s cannot be combined with --%s or --%s", flagBranch, flagRemoteURL, flagMatch)
+	}
+	return nil
+}
+
+// validateGitdirPattern checks a glob for an includeIf "gitdir:" condition,
+// which is written as given
+func validateGitdirPattern(s string) error {
+	if strings.TrimSpace(s) == "" {
+		return fmt.Errorf("gitdir pattern cannot be empty")
+	}
+	if strings.ContainsAny(s, "\"\r\n") {
+		return fmt.Errorf("gitdir pattern cannot contain quotes or line breaks")
+	}
+	return nil
+}
+
+// validateGitdirMatch checks the gitdir pattern of data, which replaces the
+// directory condition and so needs the context to have one
+func validateGitdirMatch(data FormData) error {
+	if err := validateGitdirPattern(data.GitdirPattern); err != nil {
+		return err
+	}
+	if data.Branch != "" || data.IncludeMatch == matchRemote || data.RepoLocal {
+		return fmt.Errorf("--%s replaces the directory match, so it cannot be combined with --%s, --%s %s or --%s",
+			flagGitdirPat, flagBranch, flagMatch, matchRemote, flagRepoLocal)
+	}
+	return nil
+}
+
+// validateIncludeMatch checks the include matching mode, which needs a remote
+// URL unless it matches by directory only
+func validateIncludeMatch(match, remoteURL string) error {
+	if !slices.Contains(includeMatches, match) {
+		return fmt.Errorf("unsupported match '%s' (supported: %s)", match, strings.Join(includeMatches, ", "))
+	}
+	if match != matchGitdir && remoteURL == "" {
+		return fmt.Errorf("matching by remote needs a remote URL pattern (--%s)", flagRemoteURL)
+	}
+	return nil
+}
+
+// validateSSHHost checks a host alias or hostname for an ssh config Host block
+func validateSSHHost(s string) error {
+	if s == "" {
+		return fmt.Errorf("host cannot be empty")
+	}
+	if strings.ContainsAny(s, " \t*?!,") {
+		return fmt.Errorf("host must be a single name without spaces or wildcards")
+	}
+	return nil
+}
+
+// validateBranchName checks a branch name for git init -b, following the main
+// rules of git check-ref-format
+func validateBranchName(s string) error {
+	if s == "" {
+		return fmt.Errorf("branch name cannot be empty")
+	}
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "/") || strings.HasSuffix(s, "/") || strings.HasSuffix(s, ".") || strings.HasSuffix(s, ".lock") {
+		return fmt.Errorf("branch name cannot start with '-' or '/', or end with '/', '.' or '.lock'")
+	}
+	if strings.Contains(s, "..") || strings.Contains(s, "//") || strings.Contains(s, "@{") || strings.Contains(s, "/.") || strings.HasPrefix(s, ".") {
+		return fmt.Errorf("branch name cannot contain '..', '//', '@{' or a component starting with '.'")
+	}
+	if strings.ContainsAny(s, " ~^:?*[\\\x7f") || strings.IndexFunc(s, func(r rune) bool { return r < 0x20 }) >= 0 {
+		return fmt.Errorf("branch name cannot contain spaces, control characters or any of ~^:?*[\\")
+	}
+	return nil
+}
+
+// validateGitRemote checks a URL for git remote add
+func validateGitRemote(s string) error {
+	if s == "" {
+		return fmt.Errorf("remote URL cannot be empty")
+	}
+	if strings.HasPrefix(s, "-") || strings.ContainsAny(s, " \t\r\n") {
+		return fmt.Errorf("remote URL cannot start with '-' or contain whitespace")
+	}
+	return nil
+}
+
+// validateBoxWidth checks the value of --width
+func validateBoxWidth(width int) error {
+	if width < minBoxWidth {
+		return fmt.Errorf("width must be at least %d", minBoxWidth)
+	}
+	return nil
+}
+
+// validateFormData applies the field validators to a complete set of answers,
+// for inputs that did not go through the form (e.g. batch files)
+func validateFormData(data FormData) error {
+	if data.Scope != "" {
+		if err := validateScope(data.Scope); err != nil {
+			return err
+		}
+	}
+	if err := checkScopeFields(data); err != nil {
+		return err
+	}
+	if data.Scope != scopeGlobalOnly {
+		if err := validateDirectoryName(data.DirectoryName); err != nil {
+			return err
+		}
+	}
+	if err := validateUsername(data.GitUsername); err != nil {
+		return err
+	}
+	if err := validateEmail(data.GitEmail); err != nil {
+		return err
+	}
+	for _, email := range data.AlternateEmails {
+		if err := validateEmail(email); err != nil {
+			return fmt.Errorf("alternate email '%s': %w", email, err)
+		}
+	}
+	if err := validateSignScopes(data.SignScopes); err != nil {
+		return err
+	}
+	if data.InitialBranch != "" {
+		if err := validateBranchName(data.InitialBranch); err != nil {
+			return err
+		}
+	}
+	if data.Remote != "" {
+		if err := validateGitRemote(data.Remote); err != nil {
+			return err
+		}
+	}
+	if data.LocalConfig != "" {
+		if err := validateLocalConfig(data.LocalConfig); err != nil {
+			return err
+		}
+	}
+	if data.TemplateConfig != "" {
+		if err := validateTemplateConfig(data.TemplateConfig); err != nil {
+			return err
+		}
+	}
+	if data.OnIncludeConflict != "" {
+		if err := validateOnIncludeConflict(data.OnIncludeConflict); err != nil {
+			return err
+		}
+	}
+	if data.OnConflict != "" {
+		if err := validateOnConflict(data.OnConflict); err != nil {
+			return err
+		}
+	}
+	if data.CommitTemplate != "" {
+		if err := validateCommitTemplate(data.CommitTemplate); err != nil {
+			return err
+		}
+	}
+	if data.Editor != "" {
+		if err := validateEditor(data.Editor); err != nil {
+			return err
+		}
+	}
+	if data.AutoCRLF != "" {
+		if err := validateAutoCRLF(data.AutoCRLF); err != nil {
+			return err
+		}
+	}
+	if data.FileMode != "" {
+		if err := validateFileMode(data.FileMode); err != nil {
+			return err
+		}
+	}
+	if data.PullRebase != "" {
+		if err := validatePullRebase(data.PullRebase); err != nil {
+			return err
+		}
+	}
+	if data.FetchPrune != "" {
+		if err := validateFetchPrune(data.FetchPrune); err != nil {
+			return err
+		}
+	}
+	if data.DefaultBranch != "" {
+		if err := validateBranchName(data.DefaultBranch); err != nil {
+			return err
+		}
+	}
+	if err := checkProxyFields(data); err != nil {
+		return err
+	}
+	if err := validateSignMethod(data.SignMethod); err != nil {
+		return err
+	}
+	if data.Auth != "" {
+		if err := validateAuthMethod(data.Auth); err != nil {
+			return err
+		}
+	}
+	if data.CredentialHelper != "" {
+		if err := validateCredentialHelper(data.CredentialHelper); err != nil {
+			return err
+		}
+	}
+	if err := validateHTTPSData(data); err != nil {
+		return err
+	}
+	if signsWithGPG(data) {
+		if data.SeparateSigningKey || data.SigningKey != "" {
+			return fmt.Errorf("separate_signing_key and signing_key only apply to SSH signing")
+		}
+		if data.GPGProgram != "" {
+			if err := validateGPGProgram(data.GPGProgram); err != nil {
+				return err
+			}
+		}
+		if data.GPGKey != "" {
+			if err := validateGPGKey(data.GPGProgram, data.GPGKey); err != nil {
+				return err
+			}
+		}
+	}
+	if data.SigningKey != "" {
+		if err := validateExistingKey(data.SigningKey); err != nil {
+			return err
+		}
+	}
+	if data.ExistingKey != "" {
+		if err := validateExistingKey(data.ExistingKey); err != nil {
+			return err
+		}
+	} else if err := validateKeyGeneration(data); err != nil {
+		return err
+	}
+	if data.SSHHostAlias != "" {
+		if err := validateSSHHost(data.SSHHostAlias); err != nil {
+			return err
+		}
+	}
+	if data.SSHHostName != "" {
+		if err := validateSSHHost(data.SSHHostName); err != nil {
+			return err
+		}
+	}
+	if err := validateProvider(data.Provider); err != nil {
+		return err
+	}
+	if data.Provider == providerCustom && data.ProviderHost == "" {
+		return fmt.Errorf("the custom provider needs provider_host")
+	}
+	if data.ProviderHost != "" {
+		if err := validateSSHHost(data.ProviderHost); err != nil {
+			return err
+		}
+	}
+	if data.RemoteURL != "" {
+		if err := validateRemoteURL(data.RemoteURL); err != nil {
+			return err
+		}
+	}
+	if data.IncludeMatch != "" {
+		if err := validateIncludeMatch(data.IncludeMatch, data.RemoteURL); err != nil {
+			return err
+		}
+	}
+	if data.Branch != "" {
+		if err := validateBranchMatch(data); err != nil {
+			return err
+		}
+	}
+	if data.GitdirPattern != "" {
+		if err := validateGitdirMatch(data); err != nil {
+			return err
+		}
+	}
+	if data.HostKeyChecking != "" {
+		if err := validateHostKeyCheck(data.HostKeyChecking); err != nil {
+			return err
+		}
+	}
+	if data.TestHost != "" {
+		return validateSSHHost(data.TestHost)
+	}
+	return nil
+}
+
+// validateKeyGeneration checks the fields of data that only apply when a key
+// is generated, which an existing_key entry skips
+func validateKeyGeneration(data FormData) error {
+	if err := validateKeyType(data.KeyType); err != nil {
+		return err
+	}
+	if data.SSHDir != "" {
+		if err := validateSSHDir(data.SSHDir); err != nil {
+			return err
+		}
+	}
+	if data.KeyName != "" {
+		if err := validateKeyName(data.KeyName, data.SSHDir); err != nil {
+			return err
+		}
+	}
+	if err := validateKeyComment(data.KeyComment); err != nil {
+		return err
+	}
+	if err := validateKeySize(data); err != nil {
+		return err
+	}
+	if err := validateSKOptions(data); err != nil {
+		return err
+	}
+	if data.KDFRounds != 0 {
+		return validateKDFRounds(data.KDFRounds)
+	}
+	return nil
+}
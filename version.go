@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Where --check-update looks for the latest release
+const (
+	releasesPageURL    = "https://github.com/nobleknightt/git-config/releases"
+	updateCheckTimeout = 3 * time.Second
+)
+
+// latestReleaseURL is the GitHub API endpoint of the latest release; a
+// variable so tests can point it at a local server
+var latestReleaseURL = defaultGitHubAPIURL + "/repos/nobleknightt/git-config/releases/latest"
+
+// versionOptions holds the flags of the version subcommand
+type versionOptions struct {
+	CheckUpdate bool
+}
+
+// newVersionFlagSet defines the flags of the version subcommand, storing their values in opts
+func newVersionFlagSet(opts *versionOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" version", flag.ContinueOnError)
+	addNoColorFlag(fs)
+	addThemeFlag(fs)
+	fs.BoolVar(&opts.CheckUpdate, "check-update", false, "ask GitHub whether a newer release exists (skipped silently when offline)")
+	return fs
+}
+
+// toolVersion runs name with args and returns the first line it prints, or
+// "not found" when it cannot be run. ssh -V prints to stderr, hence both streams.
+func toolVersion(name string, args ...string) string {
+	output, err := execCommand(name, args...).CombinedOutput()
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	if err != nil || line == "" {
+		return "not found"
+	}
+	return line
+}
+
+// latestRelease returns the tag of the latest release on GitHub. Any failure,
+// such as being offline, returns an empty tag, as the check is only a courtesy.
+func latestRelease() string {
+	req, err := http.NewRequest(http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", githubAPIVersion)
+	req.Header.Set("User-Agent", appName+"/"+appVersion)
+
+	client := &http.Client{Timeout: updateCheckTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return ""
+	}
+	return release.TagName
+}
+
+// newerRelease reports whether tag names a later version than current
+func newerRelease(tag, current string) bool {
+	latest, ok := parseGitVersion(tag)
+	if !ok {
+		return false
+	}
+	installed, ok := parseGitVersion(current)
+	return ok && compareVersions(latest, installed) > 0
+}
+
+// runVersion implements the version subcommand, printing the version of the
+// tool and of what it runs, for bug reports
+func runVersion(args []string) error {
+	var opts versionOptions
+	fs := newVersionFlagSet(&opts)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return usageError(fmt.Errorf("usage: %s version [--check-update]", appName))
+	}
+
+	fmt.Printf("%s version %s\n", appName, appVersion)
+	fmt.Printf("%-12s %s\n", "go:", runtime.Version())
+	fmt.Printf("%-12s %s/%s\n", "platform:", runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("%-12s %s\n", "git:", toolVersion("git", "--version"))
+	// ssh-keygen has no version flag; it ships with ssh, which has
+	fmt.Printf("%-12s %s\n", "ssh-keygen:", toolVersion("ssh", "-V"))
+
+	if !opts.CheckUpdate {
+		return nil
+	}
+	tag := latestRelease()
+	switch {
+	case tag == "":
+		// Offline or rate limited: say nothing rather than fail a version check
+	case newerRelease(tag, appVersion):
+		fmt.Println()
+		fmt.Println(styleWarn.Render("A newer release is available: " + tag))
+		fmt.Println("Upgrade with: go install github.com/nobleknightt/git-config@latest")
+		fmt.Printf("or download it from %s\n", releasesPageURL)
+	default:
+		fmt.Println()
+		fmt.Println(styleGood.Render("This is the latest release"))
+	}
+	return nil
+}